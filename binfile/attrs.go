@@ -0,0 +1,133 @@
+package binfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recordAttrs in place of content size marks a record with attributes, it is followed by
+// int32 attributes size, attributes, int32 content size and content.
+// Readers not knowing attributes reject such records as invalid documents.
+const recordAttrs int32 = -2
+
+// attribute names filled by package
+const (
+	AttrMTime    = "mtime"    // modification time in RFC3339 format
+	AttrMode     = "mode"     // permission bits in octal
+	AttrSize     = "size"     // size of the source file in bytes
+	AttrCompress = "compress" // compression type of the source file
+)
+
+// encodeAttrs encodes attributes as nodes of name and value in name order
+func encodeAttrs(attrs map[string][]byte) []byte {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf := bytes.Buffer{}
+	for _, name := range names {
+		_, _ = writeNode(&buf, []byte(name))
+		_, _ = writeNode(&buf, attrs[name])
+	}
+	return buf.Bytes()
+}
+
+func decodeAttrs(data []byte) (map[string][]byte, error) {
+	attrs := make(map[string][]byte)
+	for len(data) > 0 {
+		name, rest, err := decodeAttrNode(data)
+		if err != nil {
+			return nil, err
+		}
+		value, rest, err := decodeAttrNode(rest)
+		if err != nil {
+			return nil, err
+		}
+		attrs[string(name)] = value
+		data = rest
+	}
+	return attrs, nil
+}
+
+func decodeAttrNode(data []byte) ([]byte, []byte, error) {
+	if len(data) < 4 {
+		return nil, nil, ErrReadDoc
+	}
+	size := int32(binary.LittleEndian.Uint32(data))
+	if size < 0 || int(size) > len(data)-4 {
+		return nil, nil, ErrReadDoc
+	}
+	return data[4 : 4+size], data[4+size:], nil
+}
+
+// fileAttrs attributes of file, compression is recorded if the content is decompressed when packaging
+func fileAttrs(mtime time.Time, mode fs.FileMode, size int64, compress int) map[string][]byte {
+	attrs := map[string][]byte{
+		AttrMTime: []byte(mtime.UTC().Format(time.RFC3339Nano)),
+		AttrMode:  []byte(strconv.FormatUint(uint64(mode.Perm()), 8)),
+		AttrSize:  []byte(strconv.FormatInt(size, 10)),
+	}
+	if compress != NONE {
+		attrs[AttrCompress] = []byte(CompressTypeName(compress))
+	}
+	return attrs
+}
+
+// AttrTime modification time in attributes
+func AttrTime(attrs map[string][]byte) (time.Time, bool) {
+	value, ok := attrs[AttrMTime]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, string(value))
+	return t, err == nil
+}
+
+// AttrFileMode permission bits in attributes
+func AttrFileMode(attrs map[string][]byte) (fs.FileMode, bool) {
+	value, ok := attrs[AttrMode]
+	if !ok {
+		return 0, false
+	}
+	mode, err := strconv.ParseUint(string(value), 8, 32)
+	return fs.FileMode(mode).Perm(), err == nil
+}
+
+// FormatAttrs formats attributes as name=value pairs in name order, values not printable are quoted
+func FormatAttrs(attrs map[string][]byte) string {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		value := string(attrs[name])
+		if strings.ContainsAny(value, " ,=") || strconv.Quote(value) != `"`+value+`"` {
+			value = strconv.Quote(value)
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, value))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// restoreFileAttrs sets mode and modification time of file from attributes if they exist
+func restoreFileAttrs(filename string, attrs map[string][]byte) error {
+	if mode, ok := AttrFileMode(attrs); ok {
+		if err := os.Chmod(filename, mode); err != nil {
+			return err
+		}
+	}
+	if mtime, ok := AttrTime(attrs); ok {
+		return os.Chtimes(filename, mtime, mtime)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package binfile
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAttrsRecord(t *testing.T) {
+	root := getTestDir("attrs")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "attrs.bin")
+	// seeking reads a window of key size limit, documents around are large enough for it to slide,
+	// uncompressed letters never look like document headers
+	docs := []*Doc{
+		{Key: []byte("plain"), Content: []byte(GenerateRandomString(2000))},
+		{Key: []byte("attrs"), Content: []byte("a"), Attrs: map[string][]byte{AttrMode: []byte("600"), "x": {0, 1}}},
+		{Key: []byte("last"), Content: []byte(GenerateRandomString(2000))},
+	}
+	if err := writeTestDocs(filename, NONE, docs...); err != nil {
+		t.Fatal(err)
+	}
+	got := readTestDocs(t, filename, NONE)
+	if len(got) != len(docs) {
+		t.Fatalf("expect %d docs, got %d", len(docs), len(got))
+	}
+	if got[0].Attrs != nil || string(got[1].Attrs["x"]) != "\x00\x01" || string(got[1].Attrs[AttrMode]) != "600" {
+		t.Errorf("unexpected attributes %v, %v", got[0].Attrs, got[1].Attrs)
+	}
+	if string(got[2].Content) != string(docs[2].Content) {
+		t.Errorf("unexpected content of last doc %s", got[2].Content)
+	}
+
+	// readers seeking documents one by one agree with the iterator
+	rd, err := NewBinReader(filename, NONE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+	br := rd.(*binReader)
+	offset := int64(0)
+	for i := range docs {
+		doc, err := br.Read(offset, true)
+		if err != nil {
+			t.Fatalf("read doc %d error: %v", i, err)
+		}
+		if string(doc.Content) != string(docs[i].Content) || len(doc.Attrs) != len(docs[i].Attrs) {
+			t.Errorf("doc %d: expect %s with %d attributes, got %s with %d", i, docs[i].Content, len(docs[i].Attrs), doc.Content, len(doc.Attrs))
+		}
+		size, err := recordSizeAt(br.file, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset += size
+	}
+	if offset != fileSize(br.file) {
+		t.Errorf("expect records end at %d, got %d", fileSize(br.file), offset)
+	}
+	if count := rd.Count(&CountOption{End: -1, KeyOnly: true}); count != int64(len(docs)) {
+		t.Errorf("expect %d counted, got %d", len(docs), count)
+	}
+	// attributes record is found when seeking from the middle of the first document
+	pos, doc := rd.Next(&SeekOption{Offset: 1, End: -1})
+	if doc == nil || string(doc.Key) != "attrs" || pos <= 0 {
+		t.Errorf("expect attrs found by seeking, got %v at %d", doc, pos)
+	}
+}
+
+func TestFormatAttrs(t *testing.T) {
+	s := FormatAttrs(map[string][]byte{"b": []byte("x y"), "a": []byte("1"), "c": {0xff}})
+	if expected := `a=1,b="x y",c="\xff"`; s != expected {
+		t.Errorf("expect %s, got %s", expected, s)
+	}
+}
+
+func TestPackageAttrs(t *testing.T) {
+	root := getTestDir("attrs-package")
+	src := filepath.Join(root, "src")
+	_ = os.MkdirAll(src, 0755)
+	defer os.RemoveAll(root)
+	file := filepath.Join(src, "a.txt")
+	if err := os.WriteFile(file, []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(file, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(root, "dst.bin")
+	opt := &PackageOption{Path: src, WorkerCount: 1, InputCompress: NONE, Attrs: true}
+	if err := Package(opt, NewBinWriter(dst, NONE)); err != nil {
+		t.Fatal(err)
+	}
+	docs := readTestDocs(t, dst, NONE)
+	if len(docs) != 1 {
+		t.Fatalf("expect 1 doc, got %d", len(docs))
+	}
+	if mode, ok := AttrFileMode(docs[0].Attrs); !ok || mode != 0600 {
+		t.Errorf("expect mode 600, got %o", mode)
+	}
+	if string(docs[0].Attrs[AttrSize]) != "5" {
+		t.Errorf("expect size 5, got %s", docs[0].Attrs[AttrSize])
+	}
+
+	out := filepath.Join(root, "out")
+	if _, err := Extract(&ExtractOption{Input: dst, Output: out, CompressType: NONE, OutCompress: NONE, WorkerCount: 1}); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(filepath.Join(out, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode().Perm() != 0600 || !stat.ModTime().Equal(mtime) {
+		t.Errorf("expect mode 600 and mtime %v restored, got %o and %v", mtime, stat.Mode().Perm(), stat.ModTime())
+	}
+}
+
+func TestDecodeHeaderSources(t *testing.T) {
+	buf := &bytes.Buffer{}
+	docs := []*Doc{
+		{Key: []byte("plain"), Content: []byte("content")},
+		{Key: []byte("attrs"), Content: []byte("content"), Attrs: map[string][]byte{AttrMode: []byte("644")}},
+		{Key: []byte("gone"), Deleted: true},
+	}
+	for _, doc := range docs {
+		if _, err := doc.writeDoc(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := buf.Bytes()
+	r := bytes.NewReader(data)
+	var pos int64
+	for i, doc := range docs {
+		// headers are read by whole records, at positions and by header readers alike
+		var read Doc
+		n, err := readRecord(io.NewSectionReader(r, pos, int64(len(data))-pos), &read)
+		if err != nil || string(read.Key) != string(doc.Key) || read.Deleted != doc.Deleted || len(read.Attrs) != len(doc.Attrs) {
+			t.Fatalf("record %d: unexpected %+v, %v", i, read, err)
+		}
+		_, _, size, err := recordHeaderAt(r, pos)
+		if err != nil || size != int64(n) {
+			t.Fatalf("record %d: expect size %d, got %d, %v", i, n, size, err)
+		}
+		dk := &DocKey{}
+		if _, err = readHeader(io.NewSectionReader(r, pos, int64(len(data))-pos), dk); err != nil || string(dk.Key) != string(doc.Key) {
+			t.Fatalf("record %d: unexpected header %+v, %v", i, dk, err)
+		}
+		pos += size
+	}
+	// the head of a reserved region and an unfilled record
+	for _, head := range [][]byte{{0xfd, 0xff, 0xff, 0xff, 0, 0, 0, 1}, make([]byte, 8)} {
+		if _, _, _, err := recordHeaderAt(bytes.NewReader(head), 0); err != ErrUnfilled {
+			t.Errorf("expect unfilled of %v, got %v", head, err)
+		}
+		if _, err := readHeader(bytes.NewReader(head), &DocKey{}); err != ErrUnfilled {
+			t.Errorf("expect unfilled header of %v, got %v", head, err)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package binfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/skiloop/binfiles/binfile/filelock"
+)
+
+// bytes of records buffered by batch writers by default
+const defaultBatchSize = 4 * 1024 * 1024
+
+// bytes at the head of a batch written last, the shortest record is a tombstone of empty key in 8 bytes
+const batchHeadSize = 8
+
+// recordReserved in place of key size marks the head of a region reserved by a batch writer, the region size follows
+// as uint32. The head is replaced by the first record of the batch once the rest of the batch is written.
+const recordReserved int32 = -3
+
+// region locks of batch writers are taken at this offset plus the region start, far beyond the end of file,
+// so they never block reading the region where range locks are mandatory, nor conflict with the file lock
+const regionLockBase = filelock.RangeBase
+
+// BatchWriter writes documents in batches for processes appending to the same file. A batch reserves its region by
+// extending the file under the file lock, then records are written into the region by positioned writes without
+// the file lock, so the file lock is taken once a batch instead of once a document. A reserved region starts with a
+// head of recordReserved and the region size, and the region is locked until the batch is written: committed
+// readers stop there and followers wait while the lock is held. The head is replaced by the first record when the
+// batch is written. If writing fails, the reserved head is kept and the batch is written again by the next flush;
+// if the writer crashes, its region lock is released with the file. Either way readers step over the region
+// once its lock is released. Where range locks are held by the process rather than the open file, as on darwin
+// and BSD, regions locked by the process could not be told from abandoned ones, so regions are not reserved
+// there and batches are written at the end of file holding the file lock instead.
+type BatchWriter interface {
+	BinWriter
+	// Flush writes buffered documents as a batch
+	Flush() error
+}
+
+type batchWriter struct {
+	filename     string
+	compressType int
+	batchSize    int
+	file         *os.File
+	mu           sync.Mutex
+	buf          bytes.Buffer
+	bufTombs     bool // whether buf has tombstones
+	tombs        tombstoneFlag
+}
+
+// NewBatchWriter create a batch writer, documents are buffered until batchSize bytes, defaultBatchSize if 0.
+// batchSize is at most MaxDocSize, so the size of a region fits in its reserved head.
+func NewBatchWriter(filename string, compressType int, batchSize int) BatchWriter {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	if batchSize > MaxDocSize {
+		batchSize = MaxDocSize
+	}
+	return &batchWriter{filename: filename, compressType: compressType, batchSize: batchSize}
+}
+
+func (bw *batchWriter) Filename() string {
+	return bw.filename
+}
+
+func (bw *batchWriter) Open() error {
+	if bw.file != nil {
+		return nil
+	}
+	// positioned writes are not allowed to files opened for appending
+	file, err := os.OpenFile(bw.filename, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	bw.file = file
+	return nil
+}
+
+// Close flushes buffered documents and closes file
+func (bw *batchWriter) Close() error {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	if bw.file == nil {
+		return nil
+	}
+	err := bw.flush()
+	if er := bw.file.Close(); err == nil {
+		err = er
+	}
+	bw.file = nil
+	return err
+}
+
+func (bw *batchWriter) Write(doc *Doc) (int, error) {
+	if bw.file == nil {
+		return 0, errors.New("not opened yet")
+	}
+	start := time.Now()
+	compressedDoc := doc
+	var err error
+	if !doc.Deleted {
+		if compressedDoc, err = CompressDoc(doc, bw.compressType); err != nil {
+			return 0, err
+		}
+	}
+	compressed := time.Now()
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	locked := time.Now()
+	n, err := compressedDoc.writeDoc(&bw.buf)
+	if err == nil && doc.Deleted {
+		bw.bufTombs = true
+	}
+	if s := activeStats.Load(); s != nil && err == nil {
+		s.addWrite(doc, compressedDoc, bw.compressType, n, compressed.Sub(start), locked.Sub(compressed), time.Since(locked))
+	}
+	if err == nil && bw.buf.Len() >= bw.batchSize {
+		err = bw.flush()
+	}
+	return n, err
+}
+
+func (bw *batchWriter) Delete(key []byte) (int, error) {
+	return bw.Write(tombstone(key))
+}
+
+func (bw *batchWriter) Flush() error {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	return bw.flush()
+}
+
+// flush reserves a region and writes the buffer into it, the buffer is kept for retrying if it is not written
+func (bw *batchWriter) flush() error {
+	if bw.buf.Len() == 0 || bw.file == nil {
+		return nil
+	}
+	data := bw.buf.Bytes()
+	if !filelock.RangeLocksPerOpenFile {
+		if err := bw.append(data); err != nil {
+			return err
+		}
+		bw.resetBuf()
+		return nil
+	}
+	size := int64(len(data))
+	pos, err := bw.reserve(size)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = filelock.UnLockRange(bw.file, regionLockBase+pos, 1)
+	}()
+	if _, err = bw.file.WriteAt(data[batchHeadSize:], pos+batchHeadSize); err != nil {
+		return &DocError{Offset: pos, Err: err}
+	}
+	if _, err = bw.file.WriteAt(data[:batchHeadSize], pos); err != nil {
+		// a head partially written is restored, so readers still step over the region
+		_, _ = bw.file.WriteAt(reservedHead(size), pos)
+		return &DocError{Offset: pos, Err: err}
+	}
+	bw.resetBuf()
+	return nil
+}
+
+func (bw *batchWriter) resetBuf() {
+	bw.buf.Reset()
+	bw.bufTombs = false
+}
+
+// append writes data at the end of file holding the file lock
+func (bw *batchWriter) append(data []byte) error {
+	if err := lockWriterFile(bw.file, bw.filename); err != nil {
+		return err
+	}
+	defer func() {
+		_ = filelock.UnLock(bw.file)
+	}()
+	if err := bw.tombs.update(bw.file, bw.bufTombs); err != nil {
+		return err
+	}
+	stat, err := bw.file.Stat()
+	if err != nil {
+		return err
+	}
+	pos := stat.Size()
+	if _, err = bw.file.WriteAt(data, pos); err != nil {
+		_ = bw.file.Truncate(pos)
+		return &DocError{Offset: pos, Err: err}
+	}
+	return nil
+}
+
+// reserve extends file by size bytes holding the file lock and returns start of the region.
+// The region is locked and its reserved head is written before the file lock is released.
+func (bw *batchWriter) reserve(size int64) (pos int64, err error) {
+	if err = lockWriterFile(bw.file, bw.filename); err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = filelock.UnLock(bw.file)
+	}()
+	if err = bw.tombs.update(bw.file, bw.bufTombs); err != nil {
+		return 0, err
+	}
+	stat, err := bw.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	pos = stat.Size()
+	if err = filelock.LockRange(bw.file, regionLockBase+pos, 1); err != nil {
+		return 0, err
+	}
+	if err = bw.file.Truncate(pos + size); err == nil {
+		_, err = bw.file.WriteAt(reservedHead(size), pos)
+	}
+	if err != nil {
+		// other writers wait for the file lock, so the file is still pos bytes before extending
+		_ = bw.file.Truncate(pos)
+		_ = filelock.UnLockRange(bw.file, regionLockBase+pos, 1)
+		return 0, err
+	}
+	return pos, nil
+}
+
+// reservedHead head of a region of size bytes reserved and not written yet
+func reservedHead(size int64) []byte {
+	var head bytes.Buffer
+	_ = binary.Write(&head, binary.LittleEndian, recordReserved)
+	_ = binary.Write(&head, binary.LittleEndian, uint32(size))
+	return head.Bytes()
+}
+
+// abandonedRegion size of the region reserved at pos of file by a batch writer which released its region lock
+// without writing it, because writing failed or the writer crashed. 0 if there is no such region at pos.
+func abandonedRegion(file *os.File, pos int64) int64 {
+	var head [batchHeadSize]byte
+	reserved := func() bool {
+		_, err := file.ReadAt(head[:], pos)
+		return err == nil && int32(binary.LittleEndian.Uint32(head[:])) == recordReserved
+	}
+	if !reserved() {
+		return 0
+	}
+	ok, err := filelock.TryRLockRange(file, regionLockBase+pos, 1)
+	if err != nil || !ok {
+		return 0
+	}
+	_ = filelock.UnLockRange(file, regionLockBase+pos, 1)
+	// the batch may be written after the head is read and before the lock is taken
+	if !reserved() {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint32(head[4:]))
+}
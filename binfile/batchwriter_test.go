@@ -0,0 +1,222 @@
+package binfile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skiloop/binfiles/binfile/filelock"
+)
+
+func TestBatchWriters(t *testing.T) {
+	root := getTestDir("batch_writer")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+
+	// batch writers appending together with a writer locking every document
+	writers := []BinWriter{
+		NewBatchWriter(filename, GZIP, 1000),
+		NewBatchWriter(filename, GZIP, 0),
+		NewBinWriter(filename, GZIP),
+	}
+	var wg sync.WaitGroup
+	for no, bw := range writers {
+		if err := bw.Open(); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(no int, bw BinWriter) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				if _, err := bw.Write(&Doc{Key: []byte(fmt.Sprintf("%d-%d", no, i)), Content: []byte(fmt.Sprintf("content %d", i))}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+			if err := bw.Close(); err != nil {
+				t.Error(err)
+			}
+		}(no, bw)
+	}
+	wg.Wait()
+	docs := readTestDocs(t, filename, GZIP)
+	keys := make(map[string]bool)
+	for _, doc := range docs {
+		keys[string(doc.Key)] = true
+	}
+	if len(docs) != 600 || len(keys) != 600 {
+		t.Errorf("expect 600 docs of different keys, got %d docs of %d keys", len(docs), len(keys))
+	}
+}
+
+func TestBatchUnfilledRegion(t *testing.T) {
+	if !filelock.RangeLocksPerOpenFile {
+		t.Skip("regions are not reserved where range locks are held by the process")
+	}
+	root := getTestDir("batch_unfilled")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+	if err := writeTestDocs(filename, NONE, &Doc{Key: []byte("a"), Content: []byte("a1")}); err != nil {
+		t.Fatal(err)
+	}
+	committed := fileSizeOf(filename)
+
+	bw := NewBatchWriter(filename, NONE, 0).(*batchWriter)
+	if err := bw.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer bw.Close()
+	for _, key := range []string{"", "b"} {
+		if _, err := bw.Write(&Doc{Key: []byte(key), Content: []byte(key + "1")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := bw.buf.Bytes()
+	pos, err := bw.reserve(int64(len(data)))
+	if err != nil || pos != committed {
+		t.Fatalf("expect region reserved at %d, got %d, %v", committed, pos, err)
+	}
+	check := func(want int64, count int) {
+		t.Helper()
+		if size, err := CommittedSize(filename, false); err != nil || size != want {
+			t.Errorf("expect committed size %d, got %d, %v", want, size, err)
+		}
+		it, err := NewDocIterator(filename, NONE, &IterOption{End: -1, Committed: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer it.Close()
+		n := 0
+		for it.Next() {
+			n += 1
+		}
+		if n != count || it.Err() != nil {
+			t.Errorf("expect %d committed docs, got %d, %v", count, n, it.Err())
+		}
+	}
+	check(committed, 1)
+	if _, err = bw.file.WriteAt(data[batchHeadSize:], pos+batchHeadSize); err != nil {
+		t.Fatal(err)
+	}
+	// the head is not written yet
+	check(committed, 1)
+	it, err := NewDocIterator(filename, NONE, &IterOption{End: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for it.Next() {
+	}
+	if !errors.Is(it.Err(), ErrUnfilled) {
+		t.Errorf("expect unfilled error, got %v", it.Err())
+	}
+	it.Close()
+	if _, err = bw.file.WriteAt(data[:batchHeadSize], pos); err != nil {
+		t.Fatal(err)
+	}
+	check(fileSizeOf(filename), 3)
+}
+
+func TestBatchAbandonedRegion(t *testing.T) {
+	if !filelock.RangeLocksPerOpenFile {
+		t.Skip("regions are not reserved where range locks are held by the process")
+	}
+	root := getTestDir("batch_abandoned")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+	if err := writeTestDocs(filename, NONE, &Doc{Key: []byte("a"), Content: []byte("a1")}); err != nil {
+		t.Fatal(err)
+	}
+	bw := NewBatchWriter(filename, NONE, 0).(*batchWriter)
+	if err := bw.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer bw.Close()
+	if _, err := bw.Write(&Doc{Key: []byte("b"), Content: []byte("b1")}); err != nil {
+		t.Fatal(err)
+	}
+	data := bw.buf.Bytes()
+	pos, err := bw.reserve(int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// documents appended after the region by another writer
+	if err = writeTestDocs(filename, NONE, &Doc{Key: []byte("c"), Content: []byte("c1")}); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := CommittedSize(filename, false); err != nil || size != pos {
+		t.Errorf("expect committed size %d while the region is locked, got %d, %v", pos, size, err)
+	}
+	countDocs := func() int64 {
+		br, err := NewBinReader(filename, NONE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer br.Close()
+		return br.Count(&CountOption{End: -1, WorkerCount: 1})
+	}
+	// readers without iterators stop at the region being written
+	if count := countDocs(); count != 1 {
+		t.Errorf("expect 1 doc counted while the region is locked, got %d", count)
+	}
+	// the writer gives up the region without writing it
+	if err = filelock.UnLockRange(bw.file, regionLockBase+pos, 1); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := CommittedSize(filename, false); err != nil || size != fileSizeOf(filename) {
+		t.Errorf("expect committed size %d after the region is abandoned, got %d, %v", fileSizeOf(filename), size, err)
+	}
+	if s := testDocContents(readTestDocs(t, filename, NONE)); s != "a1 c1 " {
+		t.Errorf("unexpected docs %s", s)
+	}
+	if count := countDocs(); count != 2 {
+		t.Errorf("expect 2 docs counted stepping over the region, got %d", count)
+	}
+	br, err := NewBinReader(filename, NONE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer br.Close()
+	found := br.Search(SearchOption{Key: "c"})
+	if found <= pos {
+		t.Errorf("expect c found after the region at %d, got %d", pos, found)
+	}
+	if next, doc := br.Next(&SeekOption{Offset: pos, End: -1}); doc == nil || string(doc.Key) != "c" || next != found {
+		t.Errorf("expect c seeked after the region at %d, got %d, %v", pos, next, doc)
+	}
+	var followed string
+	ctx, cancel := context.WithCancel(context.Background())
+	err = Follow(ctx, filename, NONE, &FollowOption{Interval: time.Millisecond}, func(doc *Doc, offset int64) error {
+		if followed += string(doc.Content) + " "; doc.Key[0] == 'c' {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil || followed != "a1 c1 " {
+		t.Errorf("expect a1 and c1 followed, got %s, %v", followed, err)
+	}
+
+	// the buffer is kept when a batch is not written
+	file := bw.file
+	if bw.file, err = os.Open(filename); err != nil {
+		t.Fatal(err)
+	}
+	if err = bw.Flush(); err == nil {
+		t.Error("expect error flushing to a file opened for reading")
+	}
+	_ = bw.file.Close()
+	bw.file = file
+	if err = bw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if s := testDocContents(readTestDocs(t, filename, NONE)); s != "a1 c1 b1 " {
+		t.Errorf("unexpected docs %s", s)
+	}
+}
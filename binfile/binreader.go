@@ -2,6 +2,7 @@ package binfile
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -31,6 +32,7 @@ type CountOption struct {
 	Input       string
 	KeyOnly     bool
 	SkipError   bool
+	Deleted     bool // count documents deleted by tombstones as well, tombstones are never counted
 }
 type BinReader interface {
 	Close()
@@ -39,6 +41,10 @@ type BinReader interface {
 	Count(opt *CountOption) int64
 	List(opt *ReadOption, keyOnly bool)
 	Search(opt SearchOption) int64
+	// Get the latest live document of key, ErrNotFound if not found
+	Get(key []byte) (*Doc, error)
+	// GetAll live documents of key in position order, ErrNotFound if none
+	GetAll(key []byte) ([]*Doc, error)
 	// Next seek for next doc
 	Next(opt *SeekOption) (pos int64, doc *Doc)
 }
@@ -65,6 +71,10 @@ type ReadOption struct {
 
 	Repack    bool `help:"repack"`
 	SkipError bool `help:"skip error"`
+	Attrs     bool `help:"show document attributes"`
+	Deleted   bool `help:"show deleted documents and tombstones"`
+	Lock      bool `help:"read documents written before taking a shared lock of file"`
+	Committed bool `help:"read documents completely written when reading starts"`
 }
 
 type SearchOption struct {
@@ -138,9 +148,24 @@ func (br *binReader) ReadDocs(opt *ReadOption) {
 		}()
 	}
 
+	end := int64(-1)
+	if opt.Lock || opt.Committed {
+		if end, err = committedSize(br.file, opt.Lock); err != nil {
+			LogError("get committed size error: %v\n", err)
+			return
+		}
+	}
+	deletes := br.tombstones(opt.Deleted)
+	if size := fileSize(br.file); size > opt.Offset {
+		addProgressTotal(size - opt.Offset)
+	}
+	last := opt.Offset
 	for {
 		offset, _ = br.docSeeker.Seek(0, io.SeekCurrent)
-		doc, err = br.docSeeker.Read(true)
+		if end >= 0 && offset >= end {
+			break
+		}
+		offset, doc, err = br.read(true)
 		if err == io.EOF {
 			break
 		}
@@ -157,6 +182,13 @@ func (br *binReader) ReadDocs(opt *ReadOption) {
 			LogError("fail to read doc at %d, skipped, error: %v\n", offset, err)
 			offset, doc = pos, dc
 		}
+		if pos, er := br.current(); er == nil {
+			addProgress(1, pos-last)
+			last = pos
+		}
+		if !opt.Deleted && (doc.Deleted || deletes.Deleted(doc.Key, offset)) {
+			continue
+		}
 		if Verbose {
 			_, _ = fmt.Fprintf(w, "%-20s\t%s\n", string(doc.Key), string(doc.Content))
 		} else {
@@ -178,7 +210,7 @@ func (br *binReader) ReadDocs(opt *ReadOption) {
 // skipDocs skip next N valid docs
 func (br *binReader) skipDocs(count int32) (err error) {
 	for count > 0 {
-		err = br.skipNext()
+		_, err = br.skipNext()
 		if err != nil {
 			if err == io.EOF {
 				err = nil
@@ -195,9 +227,9 @@ func (br *binReader) skipDocs(count int32) (err error) {
 
 // Count how many documents in file start from offset
 func (br *binReader) Count(opt *CountOption) int64 {
-
+	deletes := br.tombstones(opt.Deleted)
 	if opt.WorkerCount <= 1 {
-		return br.simpleCount(opt.Offset, opt.End, 0, opt.VerboseStep, opt.KeyOnly, opt.SkipError)
+		return br.simpleCount(opt.Offset, opt.End, 0, opt.VerboseStep, opt.KeyOnly, opt.SkipError, deletes)
 	}
 	remainSize, err := br.docSeeker.Seek(opt.Offset, io.SeekEnd)
 	if err != nil {
@@ -210,7 +242,7 @@ func (br *binReader) Count(opt *CountOption) int64 {
 	countCh := make(chan int64, opt.WorkerCount)
 	start := opt.Offset
 	for no := 0; no < opt.WorkerCount; no++ {
-		go br.conCount(countCh, start, start+workerReadSize, no, opt.VerboseStep, opt.KeyOnly, opt.SkipError)
+		go br.conCount(countCh, start, start+workerReadSize, no, opt.VerboseStep, opt.KeyOnly, opt.SkipError, deletes)
 		start += workerReadSize
 		if start-opt.Offset > remainSize {
 			break
@@ -229,7 +261,7 @@ func (br *binReader) Count(opt *CountOption) int64 {
 }
 
 // count concurrently
-func (br *binReader) conCount(ch chan int64, start, end int64, no int, verboseStep uint32, keyOnly bool, skipError bool) {
+func (br *binReader) conCount(ch chan int64, start, end int64, no int, verboseStep uint32, keyOnly bool, skipError bool, deletes *lazyTombstones) {
 	// TODO: fix concurrent count error: count mismatch
 	brd, err := NewBinReader(br.filename, br.docSeeker.CompressType())
 	if err != nil {
@@ -242,10 +274,10 @@ func (br *binReader) conCount(ch chan int64, start, end int64, no int, verboseSt
 		ch <- 0
 		return
 	}
-	ch <- dr.simpleCount(start, end, no, verboseStep, keyOnly, skipError)
+	ch <- dr.simpleCount(start, end, no, verboseStep, keyOnly, skipError, deletes)
 }
 
-func (br *binReader) simpleCount(start, end int64, no int, verboseStep uint32, keyOnly bool, skipError bool) (count int64) {
+func (br *binReader) simpleCount(start, end int64, no int, verboseStep uint32, keyOnly bool, skipError bool, deletes *lazyTombstones) (count int64) {
 	count = 0
 	curPos, doc := br.Next(&SeekOption{
 		Offset:     start,
@@ -268,10 +300,20 @@ func (br *binReader) simpleCount(start, end int64, no int, verboseStep uint32, k
 		LogInfo("[%d] start doc position: %d\n", no, curPos)
 	}
 	var err error
-	count += 1
+	var dk *DocKey
+	if !doc.Deleted && !deletes.Deleted(doc.Key, curPos) {
+		count += 1
+	}
+	addProgress(1, 0)
+	if end >= 0 {
+		addProgressTotal(end - start)
+	} else if size := fileSize(br.file); size > start {
+		addProgressTotal(size - start)
+	}
+	last := start
 	for {
 		curPos, _ = br.current()
-		err = br.skipNext()
+		dk, err = br.skipNext()
 		if err == io.EOF {
 			break
 		}
@@ -286,7 +328,9 @@ func (br *binReader) simpleCount(start, end int64, no int, verboseStep uint32, k
 			_ = br.resetOffset(pos)
 			continue
 		}
-		count++
+		if dk.ContentSize != recordTombstone && !deletes.Deleted(dk.Key, curPos) {
+			count++
+		}
 		if Verbose && uint32(count) == nextVerbose {
 			LogInfo("[%d] got %10d documents from %20d to position %20d\n", no, count, start, curPos)
 			if verboseStep == 0 {
@@ -296,6 +340,8 @@ func (br *binReader) simpleCount(start, end int64, no int, verboseStep uint32, k
 			}
 		}
 		curPos, err = br.current()
+		addProgress(1, curPos-last)
+		last = curPos
 		if err == io.EOF || end >= 0 && curPos >= end {
 			break
 		}
@@ -313,6 +359,52 @@ func (br *binReader) simpleCount(start, end int64, no int, verboseStep uint32, k
 	return count
 }
 
+// readKey reads the header of the next document and returns its position, regions abandoned by batch writers
+// are stepped over, and a region reserved and not written yet ends reading like the end of file
+func (br *binReader) readKey(dk *DocKey) (pos int64, n int, err error) {
+	for {
+		pos, _ = br.current()
+		if n, err = br.docSeeker.ReadKey(dk); err == nil || !br.stepOver(pos) {
+			break
+		}
+	}
+	if err == ErrUnfilled {
+		err = io.EOF
+	}
+	return pos, n, err
+}
+
+// read reads the next document and returns its position like readKey
+func (br *binReader) read(decompress bool) (pos int64, doc *Doc, err error) {
+	for {
+		pos, _ = br.current()
+		if doc, err = br.docSeeker.Read(decompress); err == nil || !br.stepOver(pos) {
+			break
+		}
+	}
+	if err == ErrUnfilled {
+		err = io.EOF
+	}
+	return pos, doc, err
+}
+
+// abandonedAt size of the region abandoned by a batch writer at pos, buff holds bytes at pos
+func (br *binReader) abandonedAt(buff []byte, pos int64) int64 {
+	if int32(binary.LittleEndian.Uint32(buff)) != recordReserved {
+		return 0
+	}
+	return abandonedRegion(br.file, pos)
+}
+
+// stepOver moves to the end of the region abandoned by a batch writer at pos, false if there is none
+func (br *binReader) stepOver(pos int64) bool {
+	size := abandonedRegion(br.file, pos)
+	if size <= 0 {
+		return false
+	}
+	return br.resetOffset(pos+size) == nil
+}
+
 func (br *binReader) resetOffset(offset int64) (err error) {
 	_, err = br.docSeeker.Seek(offset, io.SeekStart)
 	return err
@@ -341,9 +433,16 @@ func (br *binReader) List(opt *ReadOption, keyOnly bool) {
 		}
 	}
 
+	deletes := br.tombstones(false)
+	if size := fileSize(br.file); size > opt.Offset {
+		addProgressTotal(size - opt.Offset)
+	}
+	last := opt.Offset
 	for opt.Limit == 0 || count < opt.Limit {
 		current, _ = br.current()
-		_, err = br.docSeeker.ReadKey(doc)
+		addProgress(0, current-last)
+		last = current
+		current, _, err = br.readKey(doc)
 		if err == io.EOF {
 			break
 		}
@@ -363,13 +462,32 @@ func (br *binReader) List(opt *ReadOption, keyOnly bool) {
 			}
 			_ = br.resetOffset(pos)
 			doc.Key = CloneBytes(document.Key)
+			doc.Attrs = document.Attrs
+			doc.ContentSize = int32(len(document.Content))
+			if document.Deleted {
+				doc.ContentSize = recordTombstone
+			}
 			current = pos
 		}
+		attrs := ""
+		switch {
+		case doc.ContentSize == recordTombstone:
+			attrs = "\t(tombstone)"
+		case deletes.Deleted(doc.Key, current):
+			attrs = "\t(deleted)"
+		}
+		if attrs != "" && !opt.Deleted {
+			continue
+		}
 		count++
+		addProgress(1, 0)
+		if opt.Attrs && len(doc.Attrs) > 0 {
+			attrs += "\t" + FormatAttrs(doc.Attrs)
+		}
 		if keyOnly {
-			fmt.Println(string(doc.Key))
+			fmt.Printf("%s%s\n", string(doc.Key), attrs)
 		} else {
-			fmt.Printf("[%d]\t%20d\t%s\n", count, current, string(doc.Key))
+			fmt.Printf("[%d]\t%20d\t%s%s\n", count, current, string(doc.Key), attrs)
 		}
 		if opt.Step > 0 {
 			_ = br.skipDocs(opt.Step)
@@ -404,9 +522,13 @@ func (br *binReader) Search(opt SearchOption) int64 {
 		LogInfo("skip: %d\n", skip)
 	}
 	doc := &DocKey{}
+	deletes := br.tombstones(false)
+	if size := fileSize(br.file); size > opt.Offset {
+		addProgressTotal(size - opt.Offset)
+	}
+	last := opt.Offset
 	for {
-		docPos, _ = br.docSeeker.Seek(0, io.SeekCurrent)
-		_, err = br.docSeeker.ReadKey(doc)
+		docPos, _, err = br.readKey(doc)
 		if err == io.EOF {
 			break
 		}
@@ -416,6 +538,16 @@ func (br *binReader) Search(opt SearchOption) int64 {
 				break
 			}
 			docPos, doc = pos, &DocKey{Key: dc.Key, KeySize: int32(len(dc.Key)), ContentSize: int32(len(dc.Content))}
+			if dc.Deleted {
+				doc.ContentSize = recordTombstone
+			}
+		}
+		if pos, er := br.current(); er == nil {
+			addProgress(1, pos-last)
+			last = pos
+		}
+		if doc.ContentSize == recordTombstone || deletes.Deleted(doc.Key, docPos) {
+			continue
 		}
 		if reg.MatchString(string(doc.Key)) {
 			found = docPos
@@ -429,13 +561,13 @@ func (br *binReader) Search(opt SearchOption) int64 {
 	return found
 }
 
-// skipNext skip next doc, include invalid doc
-func (br *binReader) skipNext() (err error) {
+// skipNext skip next doc, include invalid doc, the header of skipped doc is returned
+func (br *binReader) skipNext() (dk *DocKey, err error) {
 
 	var offset int64
 	offset, err = br.docSeeker.Seek(0, io.SeekCurrent)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer func() {
 		if err != nil {
@@ -443,14 +575,22 @@ func (br *binReader) skipNext() (err error) {
 		}
 	}()
 	// read key size
-	dk := &DocKey{}
+	dk = &DocKey{}
 	var n int
-	n, err = br.docSeeker.ReadKey(dk)
+	offset, n, err = br.readKey(dk)
 	offset += int64(n)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return err
+	return dk, err
+}
+
+// tombstones of the file loaded at the first check, nil if deleted documents are shown
+func (br *binReader) tombstones(show bool) *lazyTombstones {
+	if show {
+		return nil
+	}
+	return &lazyTombstones{filename: br.filename}
 }
 
 // next seek next valid doc, return position and document
@@ -477,6 +617,16 @@ func (br *binReader) next(start, end int64, keySize, docSize int, regex *regexp.
 	}
 	var docKey *DocKey
 	for {
+		if size := br.abandonedAt(buff, pos); size > 0 {
+			pos += size
+			if err = br.resetOffset(pos); err != nil {
+				break
+			}
+			if _, err = br.file.Read(buff); err != nil {
+				break
+			}
+			continue
+		}
 		docKey, err = br.checkKey(buff, regex, keySize, docSize)
 		if err != nil {
 			break
@@ -529,48 +679,33 @@ func (br *binReader) Next(opt *SeekOption) (pos int64, doc *Doc) {
 
 func (br *binReader) checkKey(buff []byte, pattern *regexp.Regexp,
 	keyLimit, contentLimit int) (*DocKey, error) {
-	var size int32
-	r := bytes.NewBuffer(buff)
-	_, _ = readInt32(r, &size)
-	ks := size + 4
-	if size <= 0 || size > int32(len(buff)-8) || keyLimit > 0 && int32(keyLimit) < size ||
-		pattern != nil && !pattern.MatchString(string(buff[4:ks])) {
+	h := &recordHead{}
+	err := decodeHeader(&headerReader{r: bytes.NewReader(buff)}, h)
+	// buff holds the largest key and the content size after it, attributes may go beyond it
+	if err != nil && !(h.contentSize == recordAttrs && (err == io.EOF || err == io.ErrUnexpectedEOF)) {
 		return nil, nil
 	}
-	doc := &DocKey{
-		KeySize:     size,
-		ContentSize: 0,
-		Key:         buff[4:ks],
-	}
-	ks += 4
-	if ks < int32(len(buff)) {
-		r = bytes.NewBuffer(buff[ks:])
-		_, _ = readInt32(r, &size)
-		if size < 0 || contentLimit > 0 && int32(contentLimit) < size {
-			return nil, nil
-		}
-		doc.ContentSize = size
-		return doc, nil
-	}
-	buff = append(buff, make([]byte, int(ks)-len(buff))...)
-	_, err := br.file.Read(buff[ks:])
-	if err != nil {
-		return nil, err
-	}
-	_, _ = readInt32(r, &size)
-	if contentLimit > 0 && int32(contentLimit) < size {
-		_, _ = br.file.Seek(-4, io.SeekCurrent)
+	if h.keySize == 0 || keyLimit > 0 && int32(keyLimit) < h.keySize || contentLimit > 0 && int32(contentLimit) < h.contentSize ||
+		pattern != nil && !pattern.Match(h.key) {
 		return nil, nil
 	}
-	doc.ContentSize = size
-	return doc, nil
+	return &DocKey{KeySize: h.keySize, ContentSize: h.contentSize, Key: h.key, Attrs: h.attrs}, nil
 }
 func (br *binReader) readByte(buff []byte) ([]byte, error) {
 	buff = buff[1:]
 	buff = append(buff, make([]byte, 1)...)
-	_, err := br.file.Read(buff[:1])
+	_, err := br.file.Read(buff[len(buff)-1:])
 	if err != nil {
 		return nil, err
 	}
 	return buff, nil
 }
+
+// fileSize size of file, -1 if failed
+func fileSize(file *os.File) int64 {
+	stat, err := file.Stat()
+	if err != nil {
+		return -1
+	}
+	return stat.Size()
+}
@@ -2,9 +2,11 @@ package binfile
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/skiloop/binfiles/binfile/filelock"
 )
@@ -13,6 +15,8 @@ var errWorkersStopped = errors.New("workers stopped")
 
 type BinWriter interface {
 	DocWriter
+	// Delete writes a tombstone of key, documents of the key written before are deleted
+	Delete(key []byte) (int, error)
 	// Close writer
 	Close() error
 	Open() error
@@ -29,6 +33,9 @@ type binWriter struct {
 	file         *os.File
 	mu           sync.Mutex
 	writer       io.Writer
+	compressed   bool // documents are already in compressType and written as they are
+	temp         bool // temporary file, documents are not counted in write statistics
+	tombs        tombstoneFlag
 }
 
 func createBinWriter(filename string, compressType int) *binWriter {
@@ -63,12 +70,13 @@ func (dw *binWriter) Open() error {
 	}
 	dw.file = file
 	dw.writer = dw.file
+	dw.tombs = tombstoneFlag{}
 	return nil
 }
 
 func (dw *binWriter) lock() error {
 	dw.mu.Lock()
-	err := filelock.Lock(*dw.file)
+	err := lockWriterFile(dw.file, dw.filename)
 	if err != nil {
 		dw.mu.Unlock()
 		return err
@@ -76,8 +84,20 @@ func (dw *binWriter) lock() error {
 	return nil
 }
 
+// lockWriterFile takes the exclusive file lock shared with writers of other processes, waiting at most WriteLockTimeout
+func lockWriterFile(file *os.File, filename string) error {
+	if WriteLockTimeout <= 0 {
+		return filelock.Lock(file)
+	}
+	err := filelock.LockTimeout(file, WriteLockTimeout)
+	if errors.Is(err, filelock.ErrTimeout) {
+		return fmt.Errorf("%s is locked for more than %v, another process may be stuck holding it: %w", filename, WriteLockTimeout, err)
+	}
+	return err
+}
+
 func (dw *binWriter) unlock() error {
-	err := filelock.UnLock(*dw.file)
+	err := filelock.UnLock(dw.file)
 	if err != nil {
 		return err
 	}
@@ -91,14 +111,48 @@ type oldBinWriter struct {
 }
 
 func (dw *oldBinWriter) Write(doc *Doc) (int, error) {
+	return dw.compressAndWrite(doc, dw.compressType, dw.oldCompressor.CompressDoc, dw.writeDoc)
+}
+
+func (dw *binWriter) Write(doc *Doc) (int, error) {
+	return dw.compressAndWrite(doc, dw.compressType, CompressDoc, dw.writeDoc)
+}
+
+func (dw *binWriter) Delete(key []byte) (int, error) {
+	return dw.compressAndWrite(tombstone(key), dw.compressType, CompressDoc, dw.writeDoc)
+}
+
+func (dw *binWriter) writeDoc(doc *Doc) (int, error) {
+	return doc.writeDoc(dw.writer)
+}
+
+// compressAndWrite compress document and write it while holding the lock,
+// statistics are collected when there is an active one
+func (dw *binWriter) compressAndWrite(doc *Doc, compressType int, compress func(doc *Doc, compressType int) (*Doc, error), write func(doc *Doc) (int, error)) (int, error) {
 	if dw.file == nil {
 		return 0, errors.New("not opened yet")
 	}
-	compressedDoc, err := dw.oldCompressor.CompressDoc(doc, dw.compressType)
-	if err != nil {
-		return 0, err
+	start := time.Now()
+	compressedDoc := doc
+	var err error
+	if dw.compressed {
+		compress = keepCompressed
+	}
+	if !doc.Deleted {
+		if compressedDoc, err = compress(doc, compressType); err != nil {
+			return 0, err
+		}
 	}
-	// LogInfo("write doc: %s, %d -> %d\n", string(compressedDoc.Key), len(doc.Content), len(compressedDoc.Content))
+	rawSize := len(doc.Content)
+	s := activeStats.Load()
+	if dw.temp {
+		s = nil
+	}
+	if s != nil && compressedDoc == doc {
+		// documents written as they are are counted by their decompressed size
+		rawSize = rawContentSize(doc, compressType)
+	}
+	compressed := time.Now()
 	if err = dw.lock(); err != nil {
 		LogError("lock file error: %v\n", err)
 		return 0, err
@@ -106,26 +160,47 @@ func (dw *oldBinWriter) Write(doc *Doc) (int, error) {
 	defer func() {
 		_ = dw.unlock()
 	}()
-	return compressedDoc.writeDoc(dw.writer)
+	locked := time.Now()
+	// package compressed files are not walked for tombstones
+	if dw.writer == io.Writer(dw.file) {
+		if err = dw.tombs.update(dw.file, doc.Deleted); err != nil {
+			return 0, err
+		}
+	}
+	n, err := write(compressedDoc)
+	if s != nil && err == nil {
+		s.addRecord(len(doc.Key), rawSize, len(compressedDoc.Content), compressType, n, compressed.Sub(start), locked.Sub(compressed), time.Since(locked))
+	}
+	return n, err
 }
 
-func (dw *binWriter) Write(doc *Doc) (int, error) {
-	if dw.file == nil {
-		return 0, errors.New("not opened yet")
+// writeCompressed makes bw write documents as they are, they are already in the compression type of bw,
+// statistics still record the compression type
+func writeCompressed(bw BinWriter) {
+	switch w := bw.(type) {
+	case *binWriter:
+		w.compressed = true
+	case *oldBinWriter:
+		w.compressed = true
+	case *ccBinWriter:
+		w.compressed = true
+	case *oldCCBinWriter:
+		w.compressed = true
 	}
-	compressedDoc, err := CompressDoc(doc, dw.compressType)
-	if err != nil {
-		return 0, err
-	}
-	// LogInfo("write doc: %s, %d -> %d\n", string(compressedDoc.Key), len(doc.Content), len(compressedDoc.Content))
-	if err = dw.lock(); err != nil {
-		LogError("lock file error: %v\n", err)
-		return 0, err
+}
+
+// writeTemp marks bw as a writer of a temporary file, its documents are not counted in write statistics
+func writeTemp(bw BinWriter) {
+	switch w := bw.(type) {
+	case *binWriter:
+		w.temp = true
+	case *oldBinWriter:
+		w.temp = true
+	case *ccBinWriter:
+		w.temp = true
+	case *oldCCBinWriter:
+		w.temp = true
 	}
-	defer func() {
-		_ = dw.unlock()
-	}()
-	return compressedDoc.writeDoc(dw.writer)
 }
 
 type ccBinWriter struct {
@@ -160,6 +235,7 @@ func (dw *ccBinWriter) Open() error {
 	}
 	dw.compressor = nil
 	dw.file = file
+	dw.tombs = tombstoneFlag{}
 	var pw io.Writer
 	if dw.packageCompressType == NONE {
 		pw = dw.file
@@ -212,43 +288,22 @@ type oldCCBinWriter struct {
 }
 
 func (dw *oldCCBinWriter) Write(doc *Doc) (int, error) {
-	if dw.file == nil {
-		return 0, errors.New("not opened yet")
-	}
-	compressedDoc, err := dw.oldCompressor.CompressDoc(doc, dw.compressType)
-	if err != nil {
-		return 0, err
-	}
-	if err = dw.lock(); err != nil {
-		LogError("lock file error: %v\n", err)
-		return 0, err
-	}
-	defer func() {
-		_ = dw.unlock()
-	}()
-	return compressedDoc.writeDoc(dw.writer)
+	return dw.compressAndWrite(doc, dw.compressType, dw.oldCompressor.CompressDoc, dw.writeDoc)
 }
 
 func (dw *ccBinWriter) Write(doc *Doc) (int, error) {
-	if dw.file == nil {
-		return 0, errors.New("not opened yet")
-	}
-	compressedDoc, err := CompressDoc(doc, dw.compressType)
-	if err != nil {
-		return 0, err
-	}
-	if err = dw.lock(); err != nil {
-		LogError("lock file error: %v\n", err)
-		return 0, err
-	}
+	return dw.compressAndWrite(doc, dw.compressType, CompressDoc, dw.writeFlush)
+}
 
-	defer func() {
-		_ = dw.unlock()
-	}()
+func (dw *ccBinWriter) Delete(key []byte) (int, error) {
+	return dw.compressAndWrite(tombstone(key), dw.compressType, CompressDoc, dw.writeFlush)
+}
+
+func (dw *ccBinWriter) writeFlush(doc *Doc) (int, error) {
 	if dw.packageCompressType != NONE {
 		defer func() {
 			_ = dw.compressor.Flush()
 		}()
 	}
-	return compressedDoc.writeDoc(dw.writer)
+	return doc.writeDoc(dw.writer)
 }
@@ -0,0 +1,47 @@
+package binfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/skiloop/binfiles/binfile/filelock"
+)
+
+func TestWriteLockTimeout(t *testing.T) {
+	root := getTestDir("write_lock")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+	bw := NewBinWriter(filename, NONE)
+	if err := bw.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer bw.Close()
+	// a stuck process holding the lock
+	stuck, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stuck.Close()
+	if err = filelock.Lock(stuck); err != nil {
+		t.Fatal(err)
+	}
+	timeout := WriteLockTimeout
+	WriteLockTimeout = 30 * time.Millisecond
+	defer func() {
+		WriteLockTimeout = timeout
+	}()
+	if _, err = bw.Write(&Doc{Key: []byte("a"), Content: []byte("a1")}); !errors.Is(err, filelock.ErrTimeout) {
+		t.Fatalf("expect lock timeout, got %v", err)
+	}
+	_ = filelock.UnLock(stuck)
+	if _, err = bw.Write(&Doc{Key: []byte("a"), Content: []byte("a1")}); err != nil {
+		t.Fatal(err)
+	}
+	if docs := readTestDocs(t, filename, NONE); len(docs) != 1 {
+		t.Errorf("expect 1 doc, got %d", len(docs))
+	}
+}
@@ -0,0 +1,65 @@
+package binfile
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/skiloop/binfiles/binfile/filelock"
+)
+
+// committedWindow bytes before the end of file walked first for the last complete record
+const committedWindow = 64 * 1024
+
+// CommittedSize size of file up to the end of its last completely written record.
+// With shared set, the size is taken holding a shared lock of file: writers hold the exclusive lock while writing
+// a record, so no record is half written then. Otherwise record headers are walked from a record found shortly
+// before the end of file, and a trailing record not completely written or a region reserved by batch writers and
+// not written yet is excluded, this also works with writers not locking the file. Invalid records before are skipped.
+func CommittedSize(filename string, shared bool) (int64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	return committedSize(file, shared)
+}
+
+func committedSize(file *os.File, shared bool) (int64, error) {
+	if shared {
+		return lockedSize(file)
+	}
+	size := fileSize(file)
+	for window := int64(committedWindow); ; window *= 2 {
+		// no record found in the window if start is size
+		if start := recordInWindow(file, window, size); start < size || start == 0 {
+			return walkRecords(file, start, size, func(int64, []byte, int32) error {
+				return nil
+			}, nil)
+		}
+	}
+}
+
+// lockedSize size of file taken under a shared lock
+func lockedSize(file *os.File) (int64, error) {
+	if err := filelock.RLock(file); err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = filelock.UnLock(file)
+	}()
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+// incompleteRecord checks whether the record at pos is not completely written in size bytes of file,
+// regions reserved by batch writers and not written yet are incomplete as well
+func incompleteRecord(r io.ReaderAt, pos, size int64) bool {
+	_, _, rs, err := recordHeaderAt(r, pos)
+	return errors.Is(err, io.EOF) || errors.Is(err, ErrUnfilled) || err == nil && pos+rs > size
+}
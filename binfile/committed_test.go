@@ -0,0 +1,128 @@
+package binfile
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skiloop/binfiles/binfile/filelock"
+)
+
+func TestCommittedReading(t *testing.T) {
+	root := getTestDir("committed")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+	if err := writeTestDocs(filename, NONE,
+		&Doc{Key: []byte("a"), Content: []byte("a1")},
+		&Doc{Key: []byte("b"), Content: []byte("b1")},
+	); err != nil {
+		t.Fatal(err)
+	}
+	complete := fileSizeOf(filename)
+	// a record half written by a writer
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	head := make([]byte, 4)
+	binary.LittleEndian.PutUint32(head, 1)
+	_, _ = file.Write(append(head, 'c'))
+	binary.LittleEndian.PutUint32(head, 10)
+	_, _ = file.Write(append(head, "c1"...))
+
+	if size, err := CommittedSize(filename, false); err != nil || size != complete {
+		t.Errorf("expect committed size %d, got %d, %v", complete, size, err)
+	}
+	it, err := NewDocIterator(filename, NONE, &IterOption{End: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for it.Next() {
+	}
+	if it.Err() == nil {
+		t.Errorf("expect error of the half written record")
+	}
+	it.Close()
+	it, err = NewDocIterator(filename, NONE, &IterOption{End: -1, Committed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for it.Next() {
+		count += 1
+	}
+	if count != 2 || it.Err() != nil {
+		t.Errorf("expect 2 committed docs, got %d, %v", count, it.Err())
+	}
+	it.Close()
+
+	// the writer holds the exclusive lock until the record is written
+	if err = filelock.Lock(file); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = file.Write([]byte("12345678"))
+		_ = filelock.UnLock(file)
+	}()
+	if size, err := CommittedSize(filename, true); err != nil || size != fileSizeOf(filename) {
+		t.Errorf("expect size %d after the record written, got %d, %v", fileSizeOf(filename), size, err)
+	}
+	docs := readTestDocs(t, filename, NONE)
+	if len(docs) != 3 || string(docs[2].Content) != "c112345678" {
+		t.Errorf("unexpected docs %v", docs)
+	}
+}
+
+func TestCommittedSizeInvalidRecords(t *testing.T) {
+	root := getTestDir("committed-invalid")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+	appendBytes := func(data []byte) {
+		file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = file.Write(data)
+		_ = file.Close()
+	}
+	if err := writeTestDocs(filename, NONE, &Doc{Key: []byte("a"), Content: []byte("a1")}); err != nil {
+		t.Fatal(err)
+	}
+	appendBytes([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	if err := writeTestDocs(filename, NONE,
+		&Doc{Key: []byte("bbbb"), Content: []byte("b1" + testTombstonePadding)},
+		&Doc{Key: []byte("c"), Content: []byte("c1" + testTombstonePadding)},
+	); err != nil {
+		t.Fatal(err)
+	}
+	complete := fileSizeOf(filename)
+	// a record half written after the invalid bytes
+	head := make([]byte, 4)
+	binary.LittleEndian.PutUint32(head, 1)
+	appendBytes(append(head, 'd'))
+
+	if size, err := CommittedSize(filename, false); err != nil || size != complete {
+		t.Errorf("expect committed size %d, got %d, %v", complete, size, err)
+	}
+	rd, err := NewBinReader(filename, NONE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+	output := filepath.Join(root, "docs.txt")
+	rd.ReadDocs(&ReadOption{Committed: true, SkipError: true, Output: output, OutCompress: NONE})
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.TrimRight(string(data), ".\n"); !strings.HasPrefix(s, "a1\nb1") || !strings.HasSuffix(s, "\nc1") {
+		t.Errorf("expect committed docs a1, b1 and c1 read, got %q", s)
+	}
+}
@@ -3,6 +3,7 @@ package binfile
 import (
 	"io"
 	"os"
+	"time"
 )
 
 var Verbose = false
@@ -19,6 +20,9 @@ const (
 )
 
 var KeySizeLimit int32 = 1000
+
+// WriteLockTimeout max time writers wait for the file lock, 0 to wait forever
+var WriteLockTimeout time.Duration
 var EmptyDocKey = "empty-doc."
 
 const MaxDocSize = 0x40000000 // 1GB
@@ -0,0 +1,263 @@
+package binfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+var ErrSameFile = errors.New("input and output are the same file")
+
+// CompactOption is the option for compacting bin file
+type CompactOption struct {
+	Input           string // source bin file
+	Output          string // compacted bin file, documents are appended if exists
+	SourceCompress  int    // document compression type of source
+	TargetCompress  int    // document compression type of output
+	PackageCompress int    // package compression type of output
+	Sort            bool   // write documents in key order instead of the original order
+	MemoryLimit     int64  // bytes of documents or keys held in memory while sorting, 256M if 0
+	WorkerCount     int    // number of workers sorting runs
+	TempDir         string // directory for temporary files, system temp directory if empty
+}
+
+// CompactResult is the summary of compaction
+type CompactResult struct {
+	Docs        int64 // number of documents written
+	Overwritten int64 // number of documents dropped because of later documents of the same key
+	Deleted     int64 // number of documents dropped because of tombstones
+	Tombstones  int64 // number of tombstones dropped
+	InputSize   int64 // bytes of input
+	OutputSize  int64 // bytes written to output
+}
+
+// Reclaimed bytes saved by compaction, negative if output is larger
+func (r *CompactResult) Reclaimed() int64 {
+	return r.InputSize - r.OutputSize
+}
+
+// Compact rewrites bin file with only the latest live document of each key, tombstones are dropped.
+// Keys are never held in memory all together: in original order, keys and positions of documents are
+// sorted externally to find the latest document of each key, then documents at those positions are copied;
+// in key order, documents are sorted externally keeping the last one of each key.
+func Compact(opt *CompactOption) (*CompactResult, error) {
+	same, err := sameFile(opt.Input, opt.Output)
+	if err != nil {
+		return nil, err
+	}
+	if same {
+		return nil, ErrSameFile
+	}
+	tmp, err := os.MkdirTemp(opt.TempDir, "bincompact")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.RemoveAll(tmp)
+	}()
+	deletes, err := LoadTombstones(opt.Input)
+	if err != nil {
+		return nil, err
+	}
+	res, live, err := compactCounts(opt.Input, deletes)
+	if err != nil {
+		return nil, err
+	}
+
+	var source, offsets string
+	if opt.Sort {
+		source = filepath.Join(tmp, "sorted.bin")
+		err = Sort(opt.sortOption(opt.Input, source, opt.SourceCompress, true))
+	} else {
+		source = opt.Input
+		offsets, err = latestOffsets(opt, tmp, deletes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var before int64
+	if stat, err := os.Stat(opt.Output); err == nil {
+		before = stat.Size()
+	}
+	if err = compactWrite(opt, source, offsets, deletes, res); err != nil {
+		return res, err
+	}
+	stat, err := os.Stat(opt.Output)
+	if err != nil {
+		return res, err
+	}
+	res.OutputSize = stat.Size() - before
+	res.Overwritten = live - res.Docs
+	return res, nil
+}
+
+func (opt *CompactOption) sortOption(input, output string, ct int, latest bool) *SortOption {
+	return &SortOption{
+		Input:        input,
+		Output:       output,
+		CompressType: ct,
+		MemoryLimit:  opt.MemoryLimit,
+		WorkerCount:  opt.WorkerCount,
+		TempDir:      filepath.Dir(output),
+		Latest:       latest,
+	}
+}
+
+func sameFile(a, b string) (bool, error) {
+	sa, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	sb, err := os.Stat(b)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(sa, sb), nil
+}
+
+// compactCounts counts tombstones, deleted and live documents by walking record headers
+func compactCounts(filename string, deletes Tombstones) (res *CompactResult, live int64, err error) {
+	res = &CompactResult{}
+	file, err := os.Open(filename)
+	if err != nil {
+		return res, 0, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	res.InputSize = fileSize(file)
+	_, err = walkRecords(file, 0, res.InputSize, func(pos int64, key []byte, contentSize int32) error {
+		switch {
+		case contentSize == recordTombstone:
+			res.Tombstones += 1
+		case deletes.Deleted(key, pos):
+			res.Deleted += 1
+		default:
+			live += 1
+		}
+		return nil
+	}, nil)
+	return res, live, err
+}
+
+// latestOffsets writes positions of the latest live document of each key in position order to a temporary bin file,
+// positions are big endian keys so that sorting by key sorts by position
+func latestOffsets(opt *CompactOption, tmp string, deletes Tombstones) (string, error) {
+	it, err := NewDocIterator(opt.Input, opt.SourceCompress, &IterOption{End: -1, Progress: true, Deletes: deletes})
+	if err != nil {
+		return "", err
+	}
+	index := filepath.Join(tmp, "index.bin")
+	err = writeIndex(index, func(write func(doc *Doc) error) error {
+		defer it.Close()
+		for it.Next() {
+			if err := write(&Doc{Key: it.Doc().Key, Content: offsetKey(it.Offset())}); err != nil {
+				return err
+			}
+		}
+		return it.Err()
+	})
+	if err != nil {
+		return "", err
+	}
+	latest := filepath.Join(tmp, "latest.bin")
+	if err = Sort(opt.sortOption(index, latest, NONE, true)); err != nil {
+		return "", err
+	}
+	positions := filepath.Join(tmp, "positions.bin")
+	err = writeIndex(positions, func(write func(doc *Doc) error) error {
+		lt, err := NewDocIterator(latest, NONE, &IterOption{End: -1, ShowDeleted: true})
+		if err != nil {
+			return err
+		}
+		defer lt.Close()
+		for lt.Next() {
+			if err := write(&Doc{Key: lt.Doc().Content, Content: []byte{1}}); err != nil {
+				return err
+			}
+		}
+		return lt.Err()
+	})
+	if err != nil {
+		return "", err
+	}
+	offsets := filepath.Join(tmp, "offsets.bin")
+	return offsets, Sort(opt.sortOption(positions, offsets, NONE, false))
+}
+
+func offsetKey(offset int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(offset))
+	return key
+}
+
+// writeIndex writes documents produced by fill to a temporary bin file
+func writeIndex(filename string, fill func(write func(doc *Doc) error) error) error {
+	bw := createBinWriter(filename, NONE)
+	bw.temp = true
+	if err := bw.Open(); err != nil {
+		return err
+	}
+	defer func() {
+		_ = bw.Close()
+	}()
+	return fill(func(doc *Doc) error {
+		_, err := bw.Write(doc)
+		return err
+	})
+}
+
+// compactWrite writes documents of source to output, only those at offsets if offsets is not empty
+func compactWrite(opt *CompactOption, source, offsets string, deletes Tombstones, res *CompactResult) error {
+	st := opt.SourceCompress
+	bw, err := newSplitWriter(opt.Output, opt.PackageCompress)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = bw.Close()
+	}()
+	var ot *DocIterator
+	if offsets != "" {
+		if ot, err = NewDocIterator(offsets, NONE, &IterOption{End: -1, ShowDeleted: true}); err != nil {
+			return err
+		}
+		defer ot.Close()
+		if !ot.Next() {
+			return ot.Err()
+		}
+	} else {
+		// sorted documents are all latest
+		deletes = Tombstones{}
+	}
+	it, err := NewDocIterator(source, st, &IterOption{End: -1, Progress: offsets != "", Deletes: deletes})
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.Next() {
+		if ot != nil {
+			offset := int64(binary.BigEndian.Uint64(ot.Doc().Key))
+			if it.Offset() != offset {
+				continue
+			}
+		}
+		doc, err := recode(it.Doc(), st, opt.TargetCompress)
+		if err != nil {
+			return &DocError{Offset: it.Offset(), Err: err}
+		}
+		if _, err = bw.Write(doc); err != nil {
+			return err
+		}
+		res.Docs += 1
+		if ot != nil && !ot.Next() {
+			return ot.Err()
+		}
+	}
+	return it.Err()
+}
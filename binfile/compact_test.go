@@ -0,0 +1,85 @@
+package binfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	root := getTestDir("compact")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	src := filepath.Join(root, "src.bin")
+
+	// expected latest live document of each key in original order
+	var order []string
+	latest := map[string]string{}
+	write := func(key, content string) {
+		if err := writeTestDocs(src, GZIP, &Doc{Key: []byte(key), Content: []byte(content)}); err != nil {
+			t.Fatal(err)
+		}
+		for i, k := range order {
+			if k == key {
+				order = append(order[:i], order[i+1:]...)
+				break
+			}
+		}
+		order = append(order, key)
+		latest[key] = content
+	}
+	for i := 0; i < 300; i++ {
+		write(fmt.Sprintf("key-%03d", (i*7)%100), fmt.Sprintf("%d", i))
+		if i%50 == 49 {
+			key := fmt.Sprintf("key-%03d", i%100)
+			bw := NewBinWriter(src, GZIP)
+			if err := bw.Open(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := bw.Delete([]byte(key)); err != nil {
+				t.Fatal(err)
+			}
+			_ = bw.Close()
+			for i, k := range order {
+				if k == key {
+					order = append(order[:i], order[i+1:]...)
+					break
+				}
+			}
+			delete(latest, key)
+		}
+	}
+	sorted := append([]string(nil), order...)
+	sort.Strings(sorted)
+
+	for _, sortKeys := range []bool{false, true} {
+		out := filepath.Join(root, fmt.Sprintf("compacted-%v.bin", sortKeys))
+		// small memory limit to spill many runs
+		res, err := Compact(&CompactOption{Input: src, Output: out, SourceCompress: GZIP, TargetCompress: NONE, PackageCompress: NONE,
+			Sort: sortKeys, MemoryLimit: 1024, WorkerCount: 2, TempDir: root})
+		if err != nil {
+			t.Fatalf("compact error: %v", err)
+		}
+		if res.Docs != int64(len(order)) || res.Tombstones != 6 || res.Docs+res.Overwritten+res.Deleted != 300 || res.Reclaimed() <= 0 {
+			t.Errorf("unexpected result %+v", res)
+		}
+		expected := order
+		if sortKeys {
+			expected = sorted
+		}
+		docs := readTestDocs(t, out, NONE)
+		if len(docs) != len(expected) {
+			t.Fatalf("expect %d docs, got %d", len(expected), len(docs))
+		}
+		for i, doc := range docs {
+			if string(doc.Key) != expected[i] || string(doc.Content) != latest[expected[i]] {
+				t.Errorf("doc %d: expect %s %s, got %s %s", i, expected[i], latest[expected[i]], doc.Key, doc.Content)
+			}
+		}
+	}
+	if _, err := Compact(&CompactOption{Input: src, Output: src}); err != ErrSameFile {
+		t.Errorf("expect %v, got %v", ErrSameFile, err)
+	}
+}
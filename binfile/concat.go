@@ -1,21 +1,156 @@
 package binfile
 
-//func FilesConcat(dst string, files ...string) error {
-//if len(files) <= 1 {
-//	return nil
-//}
-//target, err := os.OpenFile(dst, os.O_CREATE|os.O_APPEND, 0644)
-//if err != nil {
-//	return err
-//}
-//offset, _ := target.Seek(0, 2)
-//for _, file := range files {
-//	src, err := os.OpenFile(file, os.O_RDONLY, 0644)
-//	if err != nil {
-//		LogError("read file %s error: %v\n", file, err)
-//		continue
-//	}
-//
-//}
-//return nil
-//}
+import (
+	"io"
+	"os"
+)
+
+// FilesConcat appends files to dst byte by byte, no document is decoded
+func FilesConcat(dst string, files ...string) (int64, error) {
+	bw := createBinWriter(dst, NONE)
+	if err := bw.Open(); err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = bw.Close()
+	}()
+	var total int64
+	for _, file := range files {
+		n, err := bw.appendFile(file)
+		total += n
+		if err != nil {
+			LogError("append file %s error: %v\n", file, err)
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// appendFile copy the whole file to the end of writer while holding the lock
+func (dw *binWriter) appendFile(filename string) (int64, error) {
+	src, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+	if err = dw.lock(); err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = dw.unlock()
+	}()
+	if err = dw.tombs.update(dw.file, !hasNoTombstones(src)); err != nil {
+		return 0, err
+	}
+	return io.Copy(dw.writer, src)
+}
+
+// copyRecords copies records of a bin file to the end of writer byte by byte while holding the lock. Record headers
+// are validated before their bytes are copied in chunks, output of the file is truncated away when an invalid one is
+// found. Statistics are collected when there is an active one, contents are read and decompressed only for their
+// sizes then.
+func (dw *binWriter) copyRecords(filename string, compressType int) (docs, n int64, err error) {
+	src, err := os.Open(filename)
+	if err != nil {
+		return 0, 0, &inputError{err: err}
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+	size := fileSize(src)
+	addProgressTotal(size)
+	if err = dw.lock(); err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		_ = dw.unlock()
+	}()
+	start := fileSize(dw.file)
+	if err = dw.tombs.update(dw.file, false); err != nil {
+		return 0, 0, err
+	}
+	rw := &recordWalker{file: src, end: size}
+	rw.reset(0)
+	// records validated in [copied, rw.off) are not copied yet
+	copied := int64(0)
+	flush := func() error {
+		nc, err := io.CopyN(dw.writer, io.NewSectionReader(src, copied, rw.off-copied), rw.off-copied)
+		n += nc
+		copied += nc
+		return err
+	}
+	for rw.off < size {
+		pos := rw.off
+		key, contentSize, er := rw.next()
+		if er != nil {
+			if region := abandonedRegion(src, pos); region > 0 {
+				// copied as it is, readers of output step over it as well
+				rw.reset(pos + region)
+				continue
+			}
+			if er == io.EOF || er == io.ErrUnexpectedEOF {
+				er = ErrReadDoc
+			}
+			err = &inputError{err: &DocError{Offset: pos, Err: er}}
+			break
+		}
+		docs += 1
+		addProgress(1, rw.off-pos)
+		if contentSize == recordTombstone {
+			if err = dw.tombs.update(dw.file, true); err != nil {
+				break
+			}
+		}
+		if s := activeStats.Load(); s != nil {
+			doc := &Doc{Key: key, Deleted: contentSize == recordTombstone}
+			if !doc.Deleted {
+				doc.Content = make([]byte, contentSize)
+				if _, er = src.ReadAt(doc.Content, rw.off-int64(contentSize)); er != nil {
+					err = &inputError{err: &DocError{Offset: pos, Err: er}}
+					break
+				}
+			}
+			s.addRecord(len(key), rawContentSize(doc, compressType), len(doc.Content), compressType, int(rw.off-pos), 0, 0, 0)
+		}
+		if rw.off-copied >= iteratorBufferSize {
+			if err = flush(); err != nil {
+				return docs, n, err
+			}
+		}
+	}
+	if err == nil {
+		return docs, n, flush()
+	}
+	if er := dw.file.Truncate(start); er != nil {
+		LogError("truncate %s error: %v\n", dw.filename, er)
+	}
+	return docs, 0, err
+}
+
+// rawContentSize size of decompressed content, the stored size if it fails to decompress
+func rawContentSize(doc *Doc, compressType int) int {
+	if doc.Deleted || compressType == NONE {
+		return len(doc.Content)
+	}
+	buf := GlobalMemoryPool.GetCompressorBuffer()
+	defer GlobalMemoryPool.PutCompressorBuffer(buf)
+	if err := GlobalMemoryPool.DecompressToBuffer(doc.Content, compressType, buf); err != nil {
+		return len(doc.Content)
+	}
+	return buf.Len()
+}
+
+// inputError error of reading an input file, the file is invalid
+type inputError struct {
+	err error
+}
+
+func (e *inputError) Error() string {
+	return e.err.Error()
+}
+
+func (e *inputError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,241 @@
+package binfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// kinds of differences
+const (
+	DiffOnlyA   = "only-a"  // key only in the first file
+	DiffOnlyB   = "only-b"  // key only in the second file
+	DiffChanged = "changed" // key in both files with different content
+)
+
+const (
+	// bytes of keys and hashes held in memory by default
+	defaultDiffMemory = 256 * 1024 * 1024
+	// bytes of memory held for each key besides the key when a partition is compared
+	diffKeyOverhead = 128
+	// number of records at the start of files sampled to estimate the number of keys
+	diffSampleRecords = 10000
+)
+
+var errSampled = errors.New("enough records sampled")
+
+// DiffOption is the option for comparing two bin files by key
+type DiffOption struct {
+	A           string // first bin file
+	B           string // second bin file
+	CompressA   int    // document compression type of the first file
+	CompressB   int    // document compression type of the second file
+	Raw         bool   // compare stored content without decompressing, only for files of the same compression type
+	Partitions  int    // number of key hash partitions, hashes of one partition are held in memory at a time; by MemoryLimit if 0
+	MemoryLimit int64  // bytes of keys and hashes held in memory, used to size partitions, 256M if 0
+	WorkerCount int    // number of workers hashing documents
+	TempDir     string // directory for partitions, system temp directory if empty
+}
+
+// DiffEntry a key different in the two files, offset is -1 if the key is absent from the file.
+// Keys not valid utf8 are base64 encoded.
+type DiffEntry struct {
+	Kind        string `json:"kind"`
+	Key         string `json:"key"`
+	KeyEncoding string `json:"key_encoding,omitempty"`
+	OffsetA     int64  `json:"offset_a"`
+	OffsetB     int64  `json:"offset_b"`
+}
+
+// DiffResult is the summary of comparing
+type DiffResult struct {
+	OnlyA   int64 `json:"only_a"`
+	OnlyB   int64 `json:"only_b"`
+	Changed int64 `json:"changed"`
+	Same    int64 `json:"same"`
+}
+
+// Diff compares the latest live documents of each key in two bin files by content hashes.
+// Keys and hashes are split into partitions by key hash on disk first, then partitions are compared one by one,
+// so memory is bounded by the size of a partition. Differences are reported in key order within a partition.
+func Diff(opt *DiffOption, handler func(e *DiffEntry) error) (*DiffResult, error) {
+	parts := opt.Partitions
+	if parts <= 0 {
+		limit := opt.MemoryLimit
+		if limit <= 0 {
+			limit = defaultDiffMemory
+		}
+		// keys of both files in a partition are held at the same time
+		parts = 1 + int((estimateKeyMemory(opt.A)+estimateKeyMemory(opt.B))/limit)
+	}
+	tmp, err := os.MkdirTemp(opt.TempDir, "bindiff")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.RemoveAll(tmp)
+	}()
+	partsA, err := partitionHashes(opt, opt.A, opt.CompressA, filepath.Join(tmp, "a"), parts)
+	if err != nil {
+		return nil, err
+	}
+	partsB, err := partitionHashes(opt, opt.B, opt.CompressB, filepath.Join(tmp, "b"), parts)
+	if err != nil {
+		return nil, err
+	}
+	res := &DiffResult{}
+	for no := 0; no < parts; no++ {
+		if err = diffPartition(partsA[no], partsB[no], res, handler); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+func fileSizeOf(filename string) int64 {
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return 0
+	}
+	return stat.Size()
+}
+
+// estimateKeyMemory estimates bytes of memory holding keys of file when compared, the number of keys is estimated
+// by the average record size of records at the start of file
+func estimateKeyMemory(filename string) int64 {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	size := fileSize(file)
+	var count, keyBytes int64
+	sampled, err := walkRecords(file, 0, size, func(pos int64, key []byte, contentSize int32) error {
+		if count == diffSampleRecords {
+			return errSampled
+		}
+		count += 1
+		keyBytes += int64(len(key))
+		return nil
+	}, nil)
+	if err != nil && err != errSampled || count == 0 || sampled <= 0 {
+		return 0
+	}
+	return int64(float64(keyBytes+count*diffKeyOverhead) * float64(size) / float64(sampled))
+}
+
+// partitionHashes writes key, content hash and position of documents into partitions named prefix.N
+func partitionHashes(opt *DiffOption, filename string, ct int, prefix string, parts int) ([]string, error) {
+	files := make([]string, parts)
+	writers := make([]*binWriter, parts)
+	defer func() {
+		for _, bw := range writers {
+			if bw != nil {
+				_ = bw.Close()
+			}
+		}
+	}()
+	for no := range writers {
+		files[no] = fmt.Sprintf("%s.%d", prefix, no)
+		writers[no] = createBinWriter(files[no], NONE)
+		writers[no].temp = true
+		if err := writers[no].Open(); err != nil {
+			return nil, err
+		}
+	}
+	var stop atomic.Bool
+	err := scanRanges(filename, ct, &scanOption{workerCount: opt.WorkerCount, stop: &stop}, func(doc *Doc, offset int64) error {
+		if !opt.Raw {
+			var err error
+			if doc, err = DecompressDoc(doc, ct, Verbose); err != nil {
+				return &DocError{Offset: offset, Err: err}
+			}
+		}
+		sum := sha256.Sum256(doc.Content)
+		entry := &Doc{Key: doc.Key, Content: append(sum[:], offsetKey(offset)...)}
+		_, err := writers[KeyShard(doc.Key, parts)].Write(entry)
+		return err
+	})
+	return files, err
+}
+
+type diffItem struct {
+	hash   []byte
+	offset int64
+}
+
+// loadPartition loads hashes of the latest document of each key in partition
+func loadPartition(filename string) (map[string]diffItem, error) {
+	it, err := NewDocIterator(filename, NONE, &IterOption{End: -1, ShowDeleted: true})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	items := make(map[string]diffItem)
+	for it.Next() {
+		doc := it.Doc()
+		item := diffItem{hash: doc.Content[:sha256.Size], offset: int64(binary.BigEndian.Uint64(doc.Content[sha256.Size:]))}
+		// documents are hashed in parallel, the latest is the one at the largest position
+		if old, ok := items[string(doc.Key)]; !ok || item.offset > old.offset {
+			items[string(doc.Key)] = item
+		}
+	}
+	return items, it.Err()
+}
+
+func diffPartition(fileA, fileB string, res *DiffResult, handler func(e *DiffEntry) error) error {
+	a, err := loadPartition(fileA)
+	if err != nil {
+		return err
+	}
+	b, err := loadPartition(fileB)
+	if err != nil {
+		return err
+	}
+	var entries []*DiffEntry
+	for key, ia := range a {
+		ib, ok := b[key]
+		switch {
+		case !ok:
+			res.OnlyA += 1
+			entries = append(entries, &DiffEntry{Kind: DiffOnlyA, Key: key, OffsetA: ia.offset, OffsetB: -1})
+		case !bytes.Equal(ia.hash, ib.hash):
+			res.Changed += 1
+			entries = append(entries, &DiffEntry{Kind: DiffChanged, Key: key, OffsetA: ia.offset, OffsetB: ib.offset})
+		default:
+			res.Same += 1
+		}
+	}
+	for key, ib := range b {
+		if _, ok := a[key]; !ok {
+			res.OnlyB += 1
+			entries = append(entries, &DiffEntry{Kind: DiffOnlyB, Key: key, OffsetA: -1, OffsetB: ib.offset})
+		}
+	}
+	if handler == nil {
+		return nil
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	for _, e := range entries {
+		if !utf8.ValidString(e.Key) {
+			e.Key = base64.StdEncoding.EncodeToString([]byte(e.Key))
+			e.KeyEncoding = EncodingBase64
+		}
+		if err = handler(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package binfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	root := getTestDir("diff")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	a := filepath.Join(root, "a.bin")
+	b := filepath.Join(root, "b.bin")
+	var docsA, docsB []*Doc
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%03d", i))
+		content := []byte(fmt.Sprintf("content %d", i))
+		if i < 90 {
+			docsA = append(docsA, &Doc{Key: key, Content: content})
+		}
+		switch {
+		case i < 5:
+			// only in a
+		case i < 10:
+			docsB = append(docsB, &Doc{Key: key, Content: []byte("changed")})
+		default:
+			docsB = append(docsB, &Doc{Key: key, Content: content})
+		}
+	}
+	// overwritten in a with the same content as b
+	docsA = append(docsA, &Doc{Key: []byte("key-007"), Content: []byte("changed")})
+	if err := writeTestDocs(a, GZIP, docsA...); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTestDocs(b, NONE, docsB...); err != nil {
+		t.Fatal(err)
+	}
+	var entries []*DiffEntry
+	res, err := Diff(&DiffOption{A: a, B: b, CompressA: GZIP, CompressB: NONE, Partitions: 3, WorkerCount: 2, TempDir: root}, func(e *DiffEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.OnlyA != 5 || res.OnlyB != 10 || res.Changed != 4 || res.Same != 81 || len(entries) != 19 {
+		t.Errorf("unexpected result %+v with %d entries", res, len(entries))
+	}
+	for _, e := range entries {
+		var no int
+		_, _ = fmt.Sscanf(e.Key, "key-%d", &no)
+		expected := DiffOnlyB
+		switch {
+		case no < 5:
+			expected = DiffOnlyA
+		case no < 10:
+			expected = DiffChanged
+		}
+		if e.Kind != expected || no == 7 || (e.OffsetA < 0) != (e.Kind == DiffOnlyB) || (e.OffsetB < 0) != (e.Kind == DiffOnlyA) {
+			t.Errorf("unexpected entry %+v", e)
+		}
+	}
+	// compressed content differs from uncompressed one
+	if res, err = Diff(&DiffOption{A: a, B: b, CompressA: GZIP, CompressB: NONE, Raw: true}, nil); err != nil || res.Same != 0 {
+		t.Errorf("expect nothing same without decompressing, got %+v, %v", res, err)
+	}
+}
+
+func TestDiffMemoryLimit(t *testing.T) {
+	root := getTestDir("diff-memory")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	a := filepath.Join(root, "a.bin")
+	b := filepath.Join(root, "b.bin")
+	var docs []*Doc
+	for i := 0; i < 1000; i++ {
+		docs = append(docs, &Doc{Key: []byte(fmt.Sprintf("key-%04d", i)), Content: []byte("content")})
+	}
+	if err := writeTestDocs(a, NONE, docs...); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTestDocs(b, NONE, &Doc{Key: []byte{0xff, 'k'}, Content: []byte("binary key")}); err != nil {
+		t.Fatal(err)
+	}
+	if size := estimateKeyMemory(a); size < 1000*diffKeyOverhead || size > 1000*(diffKeyOverhead+20) {
+		t.Errorf("unexpected estimated memory %d of 1000 keys", size)
+	}
+	var entries []*DiffEntry
+	res, err := Diff(&DiffOption{A: a, B: b, CompressA: NONE, CompressB: NONE, MemoryLimit: 16 * 1024, WorkerCount: 2, TempDir: root}, func(e *DiffEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.OnlyA != 1000 || res.OnlyB != 1 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	for _, e := range entries {
+		if e.Kind == DiffOnlyB && (e.KeyEncoding != EncodingBase64 || e.Key != "/2s=") {
+			t.Errorf("expect key not utf8 base64 encoded, got %+v", e)
+		}
+	}
+}
@@ -14,6 +14,7 @@ var (
 	ErrInvalidKey      = errors.New("invalid key")
 	ErrReadKey         = errors.New("key read error")
 	ErrReadDoc         = errors.New("doc read error")
+	ErrUnfilled        = errors.New("reserved region not written yet")
 	ErrFileExists      = errors.New("file already exists")
 	//ErrNotSupport      = errors.New("not support for this compression type")
 )
@@ -21,12 +22,15 @@ var (
 type Doc struct {
 	Key     []byte
 	Content []byte
+	Attrs   map[string][]byte // optional attributes, nil if the record has none
+	Deleted bool              // tombstone without content, documents of the key written before are deleted
 }
 
 type DocKey struct {
 	KeySize     int32
 	ContentSize int32
 	Key         []byte
+	Attrs       map[string][]byte
 }
 
 type Node struct {
@@ -40,6 +44,11 @@ func ReadDoc(r io.Reader, doc *Doc) (int, error) {
 	if err != nil {
 		return nr, err
 	}
+	if dc.ContentSize == recordTombstone {
+		doc.Key = dc.Key
+		doc.Deleted = true
+		return nr, nil
+	}
 	if dc.ContentSize > MaxDocSize || dc.ContentSize <= 0 {
 		return nr, ErrReadDoc
 	}
@@ -79,6 +88,7 @@ func ReadDoc(r io.Reader, doc *Doc) (int, error) {
 		return nr, ErrReadDoc
 	}
 	doc.Key = dc.Key
+	doc.Attrs = dc.Attrs
 	return nr, nil
 }
 
@@ -111,6 +121,24 @@ func (doc *Doc) writeDoc(w io.Writer) (int, error) {
 	if err != nil {
 		return n, err
 	}
+	if doc.Deleted {
+		err = binary.Write(w, binary.LittleEndian, recordTombstone)
+		if err != nil {
+			return n, err
+		}
+		return n + int(unsafe.Sizeof(recordTombstone)), nil
+	}
+	if len(doc.Attrs) > 0 {
+		if err = binary.Write(w, binary.LittleEndian, recordAttrs); err != nil {
+			return n, err
+		}
+		n += int(unsafe.Sizeof(recordAttrs))
+		nb, err = writeNode(w, encodeAttrs(doc.Attrs))
+		n += nb
+		if err != nil {
+			return n, err
+		}
+	}
 	nb, err = writeNode(w, doc.Content)
 	return n + nb, err
 }
@@ -122,50 +150,146 @@ func writeNode(w io.Writer, data []byte) (n int, err error) {
 		return 0, err
 	}
 	n, err = w.Write(data)
-	return n + int(keySize), err
+	return n + int(unsafe.Sizeof(keySize)), err
 }
 
-func readNode(reader io.Reader, node *Node) (nr int, err error) {
-	nr, err = readInt32(reader, &node.Size)
-	if err == io.EOF {
-		return nr, err
+// recordHead fields of a record before its content
+type recordHead struct {
+	keySize     int32
+	key         []byte
+	contentSize int32 // recordTombstone for tombstones, recordAttrs if the header ends in attributes
+	attrs       map[string][]byte
+	size        int64 // bytes of the header, content follows
+}
+
+// headerSource reads fields of a record header one by one for decodeHeader,
+// key and attributes are skipped by sources not needing them
+type headerSource interface {
+	readSize() (int32, error)
+	readKey(size int32) ([]byte, error)
+	readAttrs(size int32) (map[string][]byte, error)
+}
+
+// decodeHeader decodes the header of the next record from src, errors of src are returned as they are.
+// ErrUnfilled is returned for regions reserved by batch writers and not written yet, ErrReadKey and
+// ErrReadDoc for invalid key and content sizes. Fields are set as they are read.
+func decodeHeader(src headerSource, h *recordHead) (err error) {
+	if h.keySize, err = src.readSize(); err != nil {
+		return err
+	}
+	if h.keySize == recordReserved {
+		return ErrUnfilled
 	}
+	if h.keySize < 0 || h.keySize > KeySizeLimit {
+		return ErrReadKey
+	}
+	if h.key, err = src.readKey(h.keySize); err != nil {
+		return err
+	}
+	if h.contentSize, err = src.readSize(); err != nil {
+		return err
+	}
+	h.size = 8 + int64(h.keySize)
+	switch {
+	case h.keySize == 0 && h.contentSize == 0:
+		return ErrUnfilled
+	case h.contentSize == recordTombstone:
+		return nil
+	case h.contentSize == recordAttrs:
+		attrsSize, err := src.readSize()
+		if err != nil {
+			return err
+		}
+		if attrsSize < 0 || attrsSize > MaxDocSize {
+			return ErrReadDoc
+		}
+		if h.attrs, err = src.readAttrs(attrsSize); err != nil {
+			return err
+		}
+		contentSize, err := src.readSize()
+		if err != nil {
+			return err
+		}
+		h.contentSize = contentSize
+		h.size += 8 + int64(attrsSize)
+	}
+	if h.contentSize <= 0 || h.contentSize > MaxDocSize {
+		return ErrReadDoc
+	}
+	return nil
+}
+
+// headerReader reads record headers from r sequentially, n is the number of bytes read
+type headerReader struct {
+	r    io.Reader
+	n    int
+	head [4]byte
+}
+
+func (hr *headerReader) readSize() (int32, error) {
+	n, err := io.ReadFull(hr.r, hr.head[:])
+	hr.n += n
 	if err != nil {
-		LogError("read int error: %v\n", err)
-		return nr, ErrReadKey
+		return 0, err
 	}
-	if node.Size < 0 || node.Size > MaxDocSize || node.Size > KeySizeLimit {
-		// LogError("read node size error: %d\n", node.Size)
-		return nr, ErrReadKey
+	return int32(binary.LittleEndian.Uint32(hr.head[:])), nil
+}
+
+func (hr *headerReader) readKey(size int32) ([]byte, error) {
+	key := make([]byte, size)
+	n, err := io.ReadFull(hr.r, key)
+	hr.n += n
+	if err != nil {
+		return nil, err
 	}
-	node.Data = make([]byte, node.Size)
-	var n int
-	n, err = reader.Read(node.Data)
-	nr += n
+	return key, nil
+}
 
-	if err == io.EOF && int32(n) < node.Size {
-		return nr, ErrInvalidDocument
+func (hr *headerReader) readAttrs(size int32) (map[string][]byte, error) {
+	data := make([]byte, size)
+	n, err := io.ReadFull(hr.r, data)
+	hr.n += n
+	if err != nil {
+		return nil, err
 	}
+	return decodeAttrs(data)
+}
 
-	if err != nil && err != io.EOF {
-		LogError("read node data error: %v\n", err)
-		return nr, ErrReadDoc
+// headerReaderAt reads record headers from r at pos, keys and attributes are skipped
+type headerReaderAt struct {
+	r    io.ReaderAt
+	pos  int64
+	head [4]byte
+}
+
+func (hr *headerReaderAt) readSize() (int32, error) {
+	if _, err := hr.r.ReadAt(hr.head[:], hr.pos); err != nil {
+		return 0, err
 	}
-	return nr, nil
+	hr.pos += 4
+	return int32(binary.LittleEndian.Uint32(hr.head[:])), nil
+}
+
+func (hr *headerReaderAt) readKey(size int32) ([]byte, error) {
+	hr.pos += int64(size)
+	return nil, nil
+}
+
+func (hr *headerReaderAt) readAttrs(size int32) (map[string][]byte, error) {
+	hr.pos += int64(size)
+	return nil, nil
 }
 
 func readHeader(reader io.Reader, doc *DocKey) (int, error) {
-	node := &Node{}
-	nr, err := readNode(reader, node)
+	src := &headerReader{r: reader}
+	h := &recordHead{}
+	err := decodeHeader(src, h)
 	if err != nil {
-		return nr, err
-	}
-	if int32(len(string(doc.Key))) > KeySizeLimit {
-		return nr, ErrInvalidKey
+		if err == io.EOF && src.n > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return src.n, err
 	}
-	n, err := readInt32(reader, &doc.ContentSize)
-	nr += n
-	doc.Key = node.Data
-	doc.KeySize = node.Size
-	return nr, err
+	doc.KeySize, doc.Key, doc.ContentSize, doc.Attrs = h.keySize, h.key, h.contentSize, h.attrs
+	return src.n, nil
 }
@@ -26,7 +26,7 @@ func (c OptimizedDocCompressor) Decompress(doc *Doc, compressType int, verbose b
 		}
 		return nil, err
 	}
-	return &Doc{Key: CloneBytes(doc.Key), Content: data}, nil
+	return &Doc{Key: CloneBytes(doc.Key), Content: data, Attrs: doc.Attrs}, nil
 }
 
 func (c OptimizedDocCompressor) CompressDoc(doc *Doc, compressType int) (dst *Doc, err error) {
@@ -37,7 +37,7 @@ func (c OptimizedDocCompressor) CompressDoc(doc *Doc, compressType int) (dst *Do
 	if err != nil {
 		return nil, err
 	}
-	return &Doc{Key: CloneBytes(doc.Key), Content: buf}, nil
+	return &Doc{Key: CloneBytes(doc.Key), Content: buf, Attrs: doc.Attrs}, nil
 }
 
 // CompressDoc 原始的文档压缩实现，保留作为备用
@@ -49,7 +49,7 @@ func (c oldCompressor) CompressDoc(doc *Doc, compressType int) (dst *Doc, err er
 	if err != nil {
 		return nil, err
 	}
-	return &Doc{Key: CloneBytes(doc.Key), Content: buf}, nil
+	return &Doc{Key: CloneBytes(doc.Key), Content: buf, Attrs: doc.Attrs}, nil
 }
 
 func (c oldCompressor) Decompress(doc *Doc, compressType int, verbose bool) (dst *Doc, err error) {
@@ -72,18 +72,18 @@ func (c oldCompressor) Decompress(doc *Doc, compressType int, verbose bool) (dst
 		}
 		return nil, ErrValueDecompress
 	}
-	return &Doc{Key: CloneBytes(doc.Key), Content: data}, nil
+	return &Doc{Key: CloneBytes(doc.Key), Content: data, Attrs: doc.Attrs}, nil
 }
 
 func DecompressDoc(doc *Doc, compressType int, verbose bool) (dst *Doc, err error) {
-	if NONE == compressType {
+	if NONE == compressType || doc.Deleted {
 		return doc, nil
 	}
 	return GlobalMemoryPool.DecompressDocWithPool(doc, compressType)
 }
 
 func CompressDoc(doc *Doc, compressType int) (dst *Doc, err error) {
-	if NONE == compressType {
+	if NONE == compressType || doc.Deleted {
 		return doc, nil
 	}
 	return GlobalMemoryPool.CompressDocWithPool(doc, compressType)
@@ -0,0 +1,166 @@
+package binfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/skiloop/binfiles/workers"
+)
+
+// collision policies when files of the same name exist
+const (
+	CollisionRename    = "rename"
+	CollisionOverwrite = "overwrite"
+	CollisionSkip      = "skip"
+)
+
+// ExtractOption is the option for extracting documents to files
+type ExtractOption struct {
+	Input        string // source bin file
+	Output       string // output directory
+	CompressType int    // document compression type of source
+	OutCompress  int    // compression type of extracted files, suffix like .gz is appended
+	Pattern      string // key regex pattern, only matched documents are extracted if not empty
+	Collision    string // what to do if the file exists: rename, overwrite or skip
+	WorkerCount  int    // number of workers, documents are extracted by one worker for overwrite
+}
+
+// ExtractResult is the summary of extracting
+type ExtractResult struct {
+	Files   int64 // number of files written
+	Renamed int64 // number of files renamed because of collision
+	Skipped int64 // number of documents skipped because of collision
+	Failed  int64 // number of documents failed to write
+}
+
+// Extract writes each document as a file named by its key, key with slashes are extracted into sub directories.
+// Mode and modification time are restored from document attributes if they exist.
+func Extract(opt *ExtractOption) (*ExtractResult, error) {
+	var pattern *regexp.Regexp
+	if opt.Pattern != "" {
+		var err error
+		if pattern, err = regexp.Compile(opt.Pattern); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(opt.Output, 0755); err != nil {
+		return nil, err
+	}
+	wc := opt.WorkerCount
+	if opt.Collision == CollisionOverwrite {
+		// documents are extracted in file order, so the last one of the same file wins
+		wc = 1
+	}
+	bounds, err := docRanges(opt.Input, wc)
+	if err != nil {
+		return nil, err
+	}
+	deletes, err := LoadTombstones(opt.Input)
+	if err != nil {
+		return nil, err
+	}
+	var files, renamed, skipped, failed atomic.Int64
+	errs := make([]error, len(bounds)-1)
+	workers.RunJobs(len(errs), nil, func(no int) {
+		it, err := NewDocIterator(opt.Input, opt.CompressType, &IterOption{Offset: bounds[no], End: bounds[no+1], Decompress: true, Progress: true, Deletes: deletes})
+		if err != nil {
+			errs[no] = err
+			return
+		}
+		defer it.Close()
+		for it.Next() {
+			doc := it.Doc()
+			if pattern != nil && !pattern.Match(doc.Key) {
+				continue
+			}
+			name := SafeFilename(doc.Key, it.Offset())
+			written, err := extractDoc(opt, name, doc)
+			switch {
+			case err != nil:
+				LogError("extract %s at %d error: %v\n", doc.Key, it.Offset(), err)
+				failed.Add(1)
+			case written == "":
+				skipped.Add(1)
+			default:
+				if written != filepath.Join(opt.Output, name)+getPackageSuffix(opt.OutCompress) {
+					renamed.Add(1)
+				}
+				files.Add(1)
+			}
+		}
+		errs[no] = it.Err()
+	}, nil)
+	res := &ExtractResult{Files: files.Load(), Renamed: renamed.Load(), Skipped: skipped.Load(), Failed: failed.Load()}
+	for _, err = range errs {
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// SafeFilename converts key to a relative path which stays inside the output directory.
+// Parent references are dropped, control characters and characters invalid on windows are replaced by '_',
+// and empty keys are named by the document offset.
+func SafeFilename(key []byte, offset int64) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7F || strings.ContainsRune(`\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, string(key))
+	var parts []string
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." {
+			continue
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("%s%d", EmptyDocKey, offset)
+	}
+	return filepath.Join(parts...)
+}
+
+// extractDoc writes document to file, the filename written is returned, empty if skipped
+func extractDoc(opt *ExtractOption, name string, doc *Doc) (string, error) {
+	content, err := Compress(doc.Content, opt.OutCompress)
+	if err != nil {
+		return "", err
+	}
+	base := filepath.Join(opt.Output, name)
+	suffix := getPackageSuffix(opt.OutCompress)
+	if err = os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return "", err
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if opt.Collision == CollisionOverwrite {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	filename := base + suffix
+	for no := 1; ; no++ {
+		file, err := os.OpenFile(filename, flag, 0644)
+		if err == nil {
+			_, err = file.Write(content)
+			if er := file.Close(); err == nil {
+				err = er
+			}
+			if err == nil {
+				err = restoreFileAttrs(filename, doc.Attrs)
+			}
+			return filename, err
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+		if opt.Collision == CollisionSkip {
+			return "", nil
+		}
+		filename = fmt.Sprintf("%s.%d%s", base, no, suffix)
+	}
+}
@@ -0,0 +1,79 @@
+package binfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSafeFilename(t *testing.T) {
+	cases := map[string]string{
+		"a.json":         "a.json",
+		"dir/a.json":     filepath.Join("dir", "a.json"),
+		"../../etc/pass": filepath.Join("etc", "pass"),
+		"/abs//./x":      filepath.Join("abs", "x"),
+		"a:b*c?\x01":     "a_b_c__",
+		"..":             EmptyDocKey + "42",
+		"":               EmptyDocKey + "42",
+	}
+	for key, expected := range cases {
+		if got := SafeFilename([]byte(key), 42); got != expected {
+			t.Errorf("%q: expect %q, got %q", key, expected, got)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	root := getTestDir("extract")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	src := filepath.Join(root, "src.bin")
+	err := writeTestDocs(src, GZIP,
+		&Doc{Key: []byte("a.txt"), Content: []byte("a1")},
+		&Doc{Key: []byte("sub/b.txt"), Content: []byte("b")},
+		&Doc{Key: []byte("a.txt"), Content: []byte("a2")},
+		&Doc{Key: []byte("c.log"), Content: []byte("c")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(root, "out")
+	res, err := Extract(&ExtractOption{Input: src, Output: out, CompressType: GZIP, OutCompress: NONE, Pattern: `\.txt$`, Collision: CollisionRename, WorkerCount: 1})
+	if err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if res.Files != 3 || res.Renamed != 1 || res.Failed != 0 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	for name, expected := range map[string]string{"a.txt": "a1", "a.txt.1": "a2", filepath.Join("sub", "b.txt"): "b"} {
+		content, err := os.ReadFile(filepath.Join(out, name))
+		if err != nil || string(content) != expected {
+			t.Errorf("%s: expect %s, got %s, %v", name, expected, content, err)
+		}
+	}
+	if CheckFileExists(filepath.Join(out, "c.log")) {
+		t.Errorf("c.log should be filtered")
+	}
+
+	// extract again with compression and skip existing files
+	res, err = Extract(&ExtractOption{Input: src, Output: out, CompressType: GZIP, OutCompress: GZIP, Collision: CollisionSkip, WorkerCount: 2})
+	if err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if res.Files != 3 || res.Skipped != 1 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	data, _ := os.ReadFile(filepath.Join(out, "c.log.gz"))
+	if content, err := Decompress(data, GZIP); err != nil || string(content) != "c" {
+		t.Fatalf("unexpected compressed content: %s, %v", content, err)
+	}
+
+	// the last document of the same file wins when overwriting
+	res, err = Extract(&ExtractOption{Input: src, Output: out, CompressType: GZIP, OutCompress: NONE, Pattern: `^a\.txt$`, Collision: CollisionOverwrite, WorkerCount: 4})
+	if err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(out, "a.txt")); err != nil || string(content) != "a2" || res.Files != 2 {
+		t.Fatalf("unexpected overwritten content: %s, %v, %+v", content, err, res)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build linux
+
+package filelock
+
+import "golang.org/x/sys/unix"
+
+// open file description locks, which are held by the open file like flock rather than by the process
+const (
+	setLock     = unix.F_OFD_SETLK
+	setLockWait = unix.F_OFD_SETLKW
+)
+
+// RangeLocksPerOpenFile range locks of different open files conflict even in the same process
+const RangeLocksPerOpenFile = true
@@ -0,0 +1,14 @@
+//go:build darwin || dragonfly || freebsd || illumos || netbsd || openbsd
+
+package filelock
+
+import "golang.org/x/sys/unix"
+
+// process associated record locks, they are released when any descriptor of the file is closed by the process
+const (
+	setLock     = unix.F_SETLK
+	setLockWait = unix.F_SETLKW
+)
+
+// RangeLocksPerOpenFile range locks of different open files conflict even in the same process
+const RangeLocksPerOpenFile = false
@@ -1,15 +1,141 @@
 package filelock
 
-import "os"
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
 
-func Lock(f os.File) error {
+// ErrTimeout the lock is not taken before timeout
+var ErrTimeout = errors.New("timeout waiting for file lock")
+
+// max interval of retrying to take a lock with context
+const maxRetryInterval = 100 * time.Millisecond
+
+// RangeBase range locks from this offset on never conflict with whole file locks,
+// whole file locks are locks of bytes below it on windows
+const RangeBase = 1 << 62
+
+// Lock takes an exclusive lock of file, it blocks until the lock is taken
+func Lock(f *os.File) error {
 	return lock(f, writeLock)
 }
 
-//func RLock(f os.File) error {
-//	return lock(f, readLock)
-//}
+// RLock takes a shared lock of file, it blocks while an exclusive lock is held by others
+func RLock(f *os.File) error {
+	return lock(f, readLock)
+}
+
+// TryLock takes an exclusive lock of file without blocking, false if the file is locked by others
+func TryLock(f *os.File) (bool, error) {
+	return tryLock(f, writeLock)
+}
+
+// TryRLock takes a shared lock of file without blocking, false if an exclusive lock is held by others
+func TryRLock(f *os.File) (bool, error) {
+	return tryLock(f, readLock)
+}
+
+// LockContext takes an exclusive lock of file until context is done,
+// ErrTimeout is returned if the deadline of context is exceeded
+func LockContext(ctx context.Context, f *os.File) error {
+	return lockContext(ctx, f, func() (bool, error) {
+		return tryLock(f, writeLock)
+	})
+}
+
+// RLockContext takes a shared lock of file until context is done,
+// ErrTimeout is returned if the deadline of context is exceeded
+func RLockContext(ctx context.Context, f *os.File) error {
+	return lockContext(ctx, f, func() (bool, error) {
+		return tryLock(f, readLock)
+	})
+}
+
+// LockTimeout takes an exclusive lock of file, ErrTimeout is returned if it is not taken in timeout
+func LockTimeout(f *os.File, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return LockContext(ctx, f)
+}
+
+// RLockTimeout takes a shared lock of file, ErrTimeout is returned if it is not taken in timeout
+func RLockTimeout(f *os.File, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return RLockContext(ctx, f)
+}
 
-func UnLock(f os.File) error {
+// UnLock releases the lock of file
+func UnLock(f *os.File) error {
 	return unlock(f)
 }
+
+// LockRange takes an exclusive lock of length bytes from offset, length 0 locks to the end of file however it grows,
+// so LockRange(f, size, 0) locks the tail region being appended. Range locks are fcntl record locks on unix and
+// independent of whole file locks there, on windows they conflict with whole file locks below RangeBase.
+// They are held by the open file on linux and windows, on other unix systems by the process,
+// so they never conflict within a process there, see RangeLocksPerOpenFile.
+func LockRange(f *os.File, offset, length int64) error {
+	_, err := lockRange(f, writeLock, offset, length, true)
+	return err
+}
+
+// RLockRange takes a shared lock of length bytes from offset, length 0 locks to the end of file
+func RLockRange(f *os.File, offset, length int64) error {
+	_, err := lockRange(f, readLock, offset, length, true)
+	return err
+}
+
+// TryLockRange takes an exclusive lock of length bytes from offset without blocking, false if any byte is locked by others
+func TryLockRange(f *os.File, offset, length int64) (bool, error) {
+	return lockRange(f, writeLock, offset, length, false)
+}
+
+// TryRLockRange takes a shared lock of length bytes from offset without blocking, false if any byte is locked
+// exclusively by others
+func TryRLockRange(f *os.File, offset, length int64) (bool, error) {
+	return lockRange(f, readLock, offset, length, false)
+}
+
+// LockRangeContext takes an exclusive lock of length bytes from offset until context is done,
+// ErrTimeout is returned if the deadline of context is exceeded
+func LockRangeContext(ctx context.Context, f *os.File, offset, length int64) error {
+	return lockContext(ctx, f, func() (bool, error) {
+		return lockRange(f, writeLock, offset, length, false)
+	})
+}
+
+// UnLockRange releases the lock of length bytes from offset, the range must be the same as it is locked
+func UnLockRange(f *os.File, offset, length int64) error {
+	return unlockRange(f, offset, length)
+}
+
+// lockContext retries to take the lock with growing intervals until context is done
+func lockContext(ctx context.Context, f *os.File, try func() (bool, error)) error {
+	interval := time.Millisecond
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+	for {
+		ok, err := try()
+		if ok || err != nil {
+			return err
+		}
+		timer.Reset(interval)
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = ErrTimeout
+			}
+			return &fs.PathError{Op: "lock", Path: f.Name(), Err: err}
+		case <-timer.C:
+		}
+		if interval *= 2; interval > maxRetryInterval {
+			interval = maxRetryInterval
+		}
+	}
+}
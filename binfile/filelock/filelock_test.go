@@ -0,0 +1,132 @@
+package filelock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestFiles(t *testing.T) (*os.File, *os.File) {
+	filename := filepath.Join(t.TempDir(), "lock")
+	open := func() *os.File {
+		f, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = f.Close()
+		})
+		return f
+	}
+	return open(), open()
+}
+
+func TestSharedAndExclusiveLocks(t *testing.T) {
+	a, b := openTestFiles(t)
+
+	if err := RLock(a); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := TryRLock(b); !ok || err != nil {
+		t.Fatalf("expect shared locks held together, got %v, %v", ok, err)
+	}
+	_ = UnLock(b)
+	if ok, err := TryLock(b); ok || err != nil {
+		t.Fatalf("expect exclusive lock refused while shared lock held, got %v, %v", ok, err)
+	}
+	start := time.Now()
+	if err := LockTimeout(b, 50*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expect timeout, got %v", err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Errorf("lock timeout returned early")
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = UnLock(a)
+	}()
+	if err := LockTimeout(b, time.Second); err != nil {
+		t.Fatalf("expect exclusive lock taken after unlock, got %v", err)
+	}
+	if err := RLockTimeout(a, 20*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expect shared lock timeout while exclusive lock held, got %v", err)
+	}
+	_ = UnLock(b)
+}
+
+func TestLockContextCanceled(t *testing.T) {
+	a, b := openTestFiles(t)
+	if err := Lock(a); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if err := LockContext(ctx, b); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect canceled, got %v", err)
+	}
+	_ = UnLock(a)
+	if err := LockContext(context.Background(), b); err != nil {
+		t.Fatal(err)
+	}
+	_ = UnLock(b)
+}
+
+func TestRangeLocks(t *testing.T) {
+	if !RangeLocksPerOpenFile {
+		t.Skip("record locks of the same process never conflict")
+	}
+	a, b := openTestFiles(t)
+	// a appends to the tail from 100
+	if err := LockRange(a, 100, 0); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := TryLockRange(b, 0, 100); !ok || err != nil {
+		t.Fatalf("expect head region locked, got %v, %v", ok, err)
+	}
+	if ok, err := TryLockRange(b, 1000, 10); ok || err != nil {
+		t.Fatalf("expect tail region refused, got %v, %v", ok, err)
+	}
+	if ok, err := TryRLockRange(b, 1000, 10); ok || err != nil {
+		t.Fatalf("expect shared lock of tail region refused, got %v, %v", ok, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := LockRangeContext(ctx, b, 100, 0); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expect timeout, got %v", err)
+	}
+	if err := UnLockRange(a, 100, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := LockRangeContext(context.Background(), b, 100, 0); err != nil {
+		t.Fatal(err)
+	}
+	_ = UnLockRange(b, 100, 0)
+	_ = UnLockRange(b, 0, 100)
+}
+
+func TestRangeLocksBeyondFileLock(t *testing.T) {
+	a, b := openTestFiles(t)
+	if err := Lock(a); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = UnLock(a)
+	}()
+	if ok, err := TryLock(b); ok || err != nil {
+		t.Fatalf("expect file lock refused, got %v, %v", ok, err)
+	}
+	// range locks from RangeBase on are taken while the file is locked
+	if ok, err := TryLockRange(b, RangeBase+100, 1); !ok || err != nil {
+		t.Fatalf("expect range beyond the file lock locked, got %v, %v", ok, err)
+	}
+	if err := UnLockRange(b, RangeBase+100, 1); err != nil {
+		t.Fatal(err)
+	}
+}
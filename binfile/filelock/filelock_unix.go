@@ -7,10 +7,14 @@
 package filelock
 
 import (
+	"errors"
+	"io"
 	"io/fs"
 	"os"
 	"strconv"
 	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
 type lockType int16
@@ -20,7 +24,7 @@ const (
 	writeLock lockType = syscall.LOCK_EX
 )
 
-func lock(f os.File, lt lockType) (err error) {
+func lock(f *os.File, lt lockType) (err error) {
 	for {
 		err = syscall.Flock(int(f.Fd()), int(lt))
 		if err != syscall.EINTR {
@@ -37,6 +41,55 @@ func lock(f os.File, lt lockType) (err error) {
 	return nil
 }
 
-func unlock(f os.File) error {
+// tryLock takes the lock without blocking, false if it would block
+func tryLock(f *os.File, lt lockType) (bool, error) {
+	err := lock(f, lt|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlock(f *os.File) error {
 	return lock(f, syscall.LOCK_UN)
 }
+
+// lockRange locks bytes by fcntl record locks, false if not waiting and the range is locked by others
+func lockRange(f *os.File, lt lockType, offset, length int64, wait bool) (bool, error) {
+	typ := int16(unix.F_WRLCK)
+	if lt == readLock {
+		typ = unix.F_RDLCK
+	}
+	cmd := setLock
+	if wait {
+		cmd = setLockWait
+	}
+	return fcntlLock(f, cmd, typ, offset, length)
+}
+
+func unlockRange(f *os.File, offset, length int64) error {
+	_, err := fcntlLock(f, setLock, unix.F_UNLCK, offset, length)
+	return err
+}
+
+func fcntlLock(f *os.File, cmd int, typ int16, offset, length int64) (bool, error) {
+	lk := unix.Flock_t{Type: typ, Whence: io.SeekStart, Start: offset, Len: length}
+	var err error
+	for {
+		err = unix.FcntlFlock(f.Fd(), cmd, &lk)
+		if err != unix.EINTR {
+			break
+		}
+	}
+	if err == unix.EAGAIN || err == unix.EACCES {
+		return false, nil
+	}
+	if err != nil {
+		return false, &fs.PathError{
+			Op:   "fcntl " + strconv.FormatInt(offset, 10) + "+" + strconv.FormatInt(length, 10),
+			Path: f.Name(),
+			Err:  err,
+		}
+	}
+	return true, nil
+}
@@ -7,6 +7,8 @@
 package filelock
 
 import (
+	"errors"
+
 	"golang.org/x/sys/windows"
 	"io/fs"
 	"os"
@@ -25,15 +27,19 @@ const (
 	allBytes = ^uint32(0)
 )
 
-func lock(f os.File, lt lockType) error {
+// RangeLocksPerOpenFile range locks of different open files conflict even in the same process
+const RangeLocksPerOpenFile = true
+
+func lock(f *os.File, lt lockType) error {
 	// Per https://golang.org/issue/19098, “Programs currently expect the Fd
 	// method to return a handle that uses ordinary synchronous I/O.”
 	// However, LockFileEx still requires an OVERLAPPED structure,
 	// which contains the file offset of the beginning of the lock range.
 	// We want to lock the entire file, so we leave the offset as zero.
-	ol := new(windows.Overlapped)
+	// Bytes from RangeBase on are left to range locks.
+	ol, low, high := rangeOf(0, RangeBase)
 
-	err := windows.LockFileEx(windows.Handle(f.Fd()), uint32(lt), reserved, allBytes, allBytes, ol)
+	err := windows.LockFileEx(windows.Handle(f.Fd()), uint32(lt), reserved, low, high, ol)
 	if err != nil {
 		return &fs.PathError{
 			Op:   strconv.Itoa(int(lt)),
@@ -44,9 +50,18 @@ func lock(f os.File, lt lockType) error {
 	return nil
 }
 
-func unlock(f os.File) error {
-	ol := new(windows.Overlapped)
-	err := windows.UnlockFileEx(windows.Handle(f.Fd()), reserved, allBytes, allBytes, ol)
+// tryLock takes the lock without blocking, false if it is held by others
+func tryLock(f *os.File, lt lockType) (bool, error) {
+	err := lock(f, lt|windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlock(f *os.File) error {
+	ol, low, high := rangeOf(0, RangeBase)
+	err := windows.UnlockFileEx(windows.Handle(f.Fd()), reserved, low, high, ol)
 	if err != nil {
 		return &fs.PathError{
 			Op:   "Unlock",
@@ -56,3 +71,45 @@ func unlock(f os.File) error {
 	}
 	return nil
 }
+
+// rangeOf overlapped structure and length of the range, length 0 is the max length
+func rangeOf(offset, length int64) (*windows.Overlapped, uint32, uint32) {
+	ol := &windows.Overlapped{Offset: uint32(offset), OffsetHigh: uint32(offset >> 32)}
+	if length == 0 {
+		return ol, allBytes, allBytes
+	}
+	return ol, uint32(length), uint32(length >> 32)
+}
+
+func lockRange(f *os.File, lt lockType, offset, length int64, wait bool) (bool, error) {
+	flags := uint32(lt)
+	if !wait {
+		flags |= windows.LOCKFILE_FAIL_IMMEDIATELY
+	}
+	ol, low, high := rangeOf(offset, length)
+	err := windows.LockFileEx(windows.Handle(f.Fd()), flags, reserved, low, high, ol)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) && !wait {
+		return false, nil
+	}
+	if err != nil {
+		return false, &fs.PathError{
+			Op:   "LockRange",
+			Path: f.Name(),
+			Err:  err,
+		}
+	}
+	return true, nil
+}
+
+func unlockRange(f *os.File, offset, length int64) error {
+	ol, low, high := rangeOf(offset, length)
+	err := windows.UnlockFileEx(windows.Handle(f.Fd()), reserved, low, high, ol)
+	if err != nil {
+		return &fs.PathError{
+			Op:   "UnlockRange",
+			Path: f.Name(),
+			Err:  err,
+		}
+	}
+	return nil
+}
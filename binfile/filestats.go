@@ -0,0 +1,571 @@
+package binfile
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/skiloop/binfiles/workers"
+)
+
+// FileStatsOption is the option for analysing a bin file
+type FileStatsOption struct {
+	Filename     string
+	CompressType int
+	WorkerCount  int
+	Top          int    // number of largest documents and key prefixes reported
+	PrefixLen    int    // key prefix length in bytes, used when PrefixSep is empty
+	PrefixSep    string // key prefix is the part before the first separator
+	KeyOnly      bool   // do not decompress documents, decompressed sizes and ratios are not reported
+}
+
+// SizeStats summary of sizes
+type SizeStats struct {
+	Count int64   `json:"count"`
+	Total int64   `json:"total"`
+	Min   int64   `json:"min"`
+	Max   int64   `json:"max"`
+	Mean  float64 `json:"mean"`
+	P50   int64   `json:"p50"`
+	P90   int64   `json:"p90"`
+	P99   int64   `json:"p99"`
+}
+
+// RatioStats summary of per document compression ratios, compressed size to decompressed size
+type RatioStats struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+}
+
+// DocInfo position and sizes of a document
+type DocInfo struct {
+	Offset           int64  `json:"offset"`
+	Key              string `json:"key"`
+	Size             int64  `json:"size"`
+	DecompressedSize int64  `json:"decompressed_size,omitempty"`
+}
+
+// ByteRange range of bytes [Start, End)
+type ByteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// PrefixCount number of documents with the key prefix
+type PrefixCount struct {
+	Prefix string `json:"prefix"`
+	Count  int64  `json:"count"`
+}
+
+// FileStats analytics of a bin file, percentiles, distinct keys, duplicate documents and prefix counts are estimated
+type FileStats struct {
+	Filename          string        `json:"filename"`
+	FileSize          int64         `json:"file_size"`
+	Docs              int64         `json:"docs"`
+	Deleted           int64         `json:"deleted"`
+	Tombstones        int64         `json:"tombstones"`
+	KeySizes          SizeStats     `json:"key_sizes"`
+	ContentSizes      SizeStats     `json:"content_sizes"`
+	DecompressedSizes *SizeStats    `json:"decompressed_sizes,omitempty"`
+	Ratios            *RatioStats   `json:"ratios,omitempty"`
+	DecompressErrors  int64         `json:"decompress_errors"`
+	Largest           []DocInfo     `json:"largest"`
+	DistinctKeys      int64         `json:"distinct_keys"`
+	DuplicateDocs     int64         `json:"duplicate_docs"`
+	Prefixes          []PrefixCount `json:"prefixes"`
+	Corrupt           []ByteRange   `json:"corrupt"`
+}
+
+// ratioScale ratios are kept in histograms as integers of this scale
+const ratioScale = 10000
+
+// histogram buckets of values not less than 1<<histogramBits have the same relative width
+const histogramBits = 7
+
+// sizeHistogram streaming histogram, values less than 128 are counted exactly, larger ones in buckets
+// at most 1/64 of their values wide, so percentiles are estimated within 1.6% in bounded memory
+type sizeHistogram struct {
+	count   int64
+	total   int64
+	min     int64
+	max     int64
+	buckets map[int]int64
+}
+
+func newSizeHistogram() *sizeHistogram {
+	return &sizeHistogram{buckets: make(map[int]int64)}
+}
+
+func sizeBucket(v int64) int {
+	if v < 1<<histogramBits {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - histogramBits
+	return shift<<(histogramBits-1) + int(v>>shift)
+}
+
+// sizeBucketValue the lowest value of bucket
+func sizeBucketValue(bucket int) int64 {
+	if bucket < 1<<histogramBits {
+		return int64(bucket)
+	}
+	shift := bucket>>(histogramBits-1) - 1
+	return int64(bucket-shift<<(histogramBits-1)) << shift
+}
+
+func (h *sizeHistogram) add(v int64) {
+	if v < 0 {
+		v = 0
+	}
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.count += 1
+	h.total += v
+	h.buckets[sizeBucket(v)] += 1
+}
+
+func (h *sizeHistogram) merge(o *sizeHistogram) {
+	if o.count == 0 {
+		return
+	}
+	if h.count == 0 || o.min < h.min {
+		h.min = o.min
+	}
+	if o.max > h.max {
+		h.max = o.max
+	}
+	h.count += o.count
+	h.total += o.total
+	for b, n := range o.buckets {
+		h.buckets[b] += n
+	}
+}
+
+// percentiles values at percentiles ps in ascending order
+func (h *sizeHistogram) percentiles(ps ...int) []int64 {
+	values := make([]int64, len(ps))
+	if h.count == 0 {
+		return values
+	}
+	keys := make([]int, 0, len(h.buckets))
+	for b := range h.buckets {
+		keys = append(keys, b)
+	}
+	sort.Ints(keys)
+	var seen int64
+	i := 0
+	for _, b := range keys {
+		seen += h.buckets[b]
+		for ; i < len(ps) && int64(percentileIndex(int(h.count), ps[i])) < seen; i++ {
+			v := sizeBucketValue(b)
+			if v < h.min {
+				v = h.min
+			}
+			if v > h.max {
+				v = h.max
+			}
+			values[i] = v
+		}
+	}
+	return values
+}
+
+func (h *sizeHistogram) sizeStats() SizeStats {
+	s := SizeStats{Count: h.count, Total: h.total, Min: h.min, Max: h.max}
+	if h.count > 0 {
+		s.Mean = float64(h.total) / float64(h.count)
+		ps := h.percentiles(50, 90, 99)
+		s.P50, s.P90, s.P99 = ps[0], ps[1], ps[2]
+	}
+	return s
+}
+
+func (h *sizeHistogram) ratioStats() *RatioStats {
+	s := &RatioStats{}
+	if h.count > 0 {
+		s.Mean = float64(h.total) / float64(h.count) / ratioScale
+		ps := h.percentiles(50, 90, 99)
+		s.P50, s.P90, s.P99 = float64(ps[0])/ratioScale, float64(ps[1])/ratioScale, float64(ps[2])/ratioScale
+	}
+	return s
+}
+
+// hyperLogLog sketch counting distinct keys in 16K registers, the standard error is about 0.8%
+type hyperLogLog struct {
+	registers [1 << hllPrecision]uint8
+}
+
+const hllPrecision = 14
+
+func (s *hyperLogLog) add(key []byte) {
+	h := fnv.New128a()
+	_, _ = h.Write(key)
+	sum := h.Sum(nil)
+	// fold and mix bits, fnv hashes of similar keys differ little in the high bits
+	x := binary.BigEndian.Uint64(sum[:8]) ^ binary.BigEndian.Uint64(sum[8:])
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	idx := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > s.registers[idx] {
+		s.registers[idx] = rank
+	}
+}
+
+func (s *hyperLogLog) merge(o *hyperLogLog) {
+	for i, r := range o.registers {
+		if r > s.registers[i] {
+			s.registers[i] = r
+		}
+	}
+}
+
+func (s *hyperLogLog) estimate() int64 {
+	m := float64(len(s.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range s.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros += 1
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// linear counting is more accurate for small numbers
+		e = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(e))
+}
+
+// prefixSketchSize number of prefixes counted by sketches for each reported one, 1024 at least
+const prefixSketchSize = 64
+
+// spaceSaving sketch of the most frequent keys in bounded memory, counts are exact until more distinct keys
+// than capacity are seen, then a new key replaces the least counted one and takes over its count,
+// so counts are overestimated by at most the least count and keys counted more often are kept
+type spaceSaving struct {
+	capacity int
+	items    map[string]*countedKey
+	heap     countedKeys // items with the least count first
+}
+
+type countedKey struct {
+	key   string
+	count int64
+	index int
+}
+
+type countedKeys []*countedKey
+
+func (h countedKeys) Len() int           { return len(h) }
+func (h countedKeys) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h countedKeys) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *countedKeys) Push(x interface{}) {
+	item := x.(*countedKey)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *countedKeys) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+func newSpaceSaving(capacity int) *spaceSaving {
+	return &spaceSaving{capacity: capacity, items: make(map[string]*countedKey)}
+}
+
+func (s *spaceSaving) add(key string, n int64) {
+	if item, ok := s.items[key]; ok {
+		item.count += n
+		heap.Fix(&s.heap, item.index)
+		return
+	}
+	if len(s.heap) < s.capacity {
+		item := &countedKey{key: key, count: n}
+		s.items[key] = item
+		heap.Push(&s.heap, item)
+		return
+	}
+	item := s.heap[0]
+	delete(s.items, item.key)
+	item.key = key
+	item.count += n
+	s.items[key] = item
+	heap.Fix(&s.heap, 0)
+}
+
+func (s *spaceSaving) merge(o *spaceSaving) {
+	for _, item := range o.heap {
+		s.add(item.key, item.count)
+	}
+}
+
+// top the n most counted keys in descending order of count
+func (s *spaceSaving) top(n int) []PrefixCount {
+	counts := make([]PrefixCount, 0, len(s.heap))
+	for _, item := range s.heap {
+		counts = append(counts, PrefixCount{Prefix: item.key, Count: item.count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		a, b := counts[i], counts[j]
+		return a.Count > b.Count || a.Count == b.Count && a.Prefix < b.Prefix
+	})
+	if len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// statsScan statistics of a range, merged into the collector when done
+type statsScan struct {
+	keySizes      *sizeHistogram
+	contentSizes  *sizeHistogram
+	decompressed  *sizeHistogram
+	ratios        *sizeHistogram
+	decompressErr int64
+	largest       []DocInfo
+	keys          hyperLogLog
+	prefixes      *spaceSaving
+	corrupt       []ByteRange
+	deleted       int64
+	tombstones    int64
+}
+
+func newStatsScan(top int) *statsScan {
+	size := top * prefixSketchSize
+	if size < 1024 {
+		size = 1024
+	}
+	return &statsScan{
+		keySizes:     newSizeHistogram(),
+		contentSizes: newSizeHistogram(),
+		decompressed: newSizeHistogram(),
+		ratios:       newSizeHistogram(),
+		prefixes:     newSpaceSaving(size),
+	}
+}
+
+type statsCollector struct {
+	mu      sync.Mutex
+	opt     *FileStatsOption
+	deletes Tombstones
+	total   *statsScan
+}
+
+// AnalyseFile scans bin file with workers on different ranges and collects statistics
+func AnalyseFile(opt *FileStatsOption) (*FileStats, error) {
+	if opt.Top <= 0 {
+		opt.Top = 10
+	}
+	bounds, err := docRanges(opt.Filename, opt.WorkerCount)
+	if err != nil {
+		return nil, err
+	}
+	deletes, err := LoadTombstones(opt.Filename)
+	if err != nil {
+		return nil, err
+	}
+	c := &statsCollector{opt: opt, deletes: deletes, total: newStatsScan(opt.Top)}
+	errs := make([]error, len(bounds)-1)
+	workers.RunJobs(len(errs), nil, func(no int) {
+		errs[no] = c.scan(bounds[no], bounds[no+1])
+	}, nil)
+	for _, err = range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	stats := c.result()
+	stats.Filename = opt.Filename
+	stats.FileSize = bounds[len(bounds)-1]
+	return stats, nil
+}
+
+func (c *statsCollector) prefix(key []byte) string {
+	if c.opt.PrefixSep != "" {
+		if idx := strings.Index(string(key), c.opt.PrefixSep); idx >= 0 {
+			return string(key[:idx])
+		}
+		return string(key)
+	}
+	if c.opt.PrefixLen > 0 && len(key) > c.opt.PrefixLen {
+		return string(key[:c.opt.PrefixLen])
+	}
+	return string(key)
+}
+
+// scan collects statistics of documents start in [start, end), results are merged when done
+func (c *statsCollector) scan(start, end int64) error {
+	r := newStatsScan(c.opt.Top)
+	it, err := NewDocIterator(c.opt.Filename, c.opt.CompressType, &IterOption{
+		Offset:         start,
+		End:            end,
+		SkipError:      true,
+		Progress:       true,
+		ShowDeleted:    true,
+		ShowTombstones: true,
+		OnSkip: func(start, end int64) {
+			r.corrupt = append(r.corrupt, ByteRange{Start: start, End: end})
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.Next() {
+		doc := it.Doc()
+		if doc.Deleted {
+			r.tombstones += 1
+			continue
+		}
+		if c.deletes.Deleted(doc.Key, it.Offset()) {
+			r.deleted += 1
+		}
+		r.keySizes.add(int64(len(doc.Key)))
+		r.contentSizes.add(int64(len(doc.Content)))
+		r.keys.add(doc.Key)
+		r.prefixes.add(c.prefix(doc.Key), 1)
+		info := DocInfo{Offset: it.Offset(), Key: string(doc.Key), Size: int64(len(doc.Content))}
+		if !c.opt.KeyOnly {
+			dc, err := DecompressDoc(doc, c.opt.CompressType, false)
+			if err != nil {
+				r.decompressErr += 1
+			} else {
+				r.decompressed.add(int64(len(dc.Content)))
+				if len(dc.Content) > 0 {
+					r.ratios.add(int64(len(doc.Content)) * ratioScale / int64(len(dc.Content)))
+				}
+				info.DecompressedSize = int64(len(dc.Content))
+			}
+		}
+		r.largest = append(r.largest, info)
+		if len(r.largest) > 4*c.opt.Top {
+			r.largest = topDocs(r.largest, c.opt.Top)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.total
+	t.keySizes.merge(r.keySizes)
+	t.contentSizes.merge(r.contentSizes)
+	t.decompressed.merge(r.decompressed)
+	t.ratios.merge(r.ratios)
+	t.decompressErr += r.decompressErr
+	t.deleted += r.deleted
+	t.tombstones += r.tombstones
+	t.largest = topDocs(append(t.largest, r.largest...), c.opt.Top)
+	t.keys.merge(&r.keys)
+	t.prefixes.merge(r.prefixes)
+	t.corrupt = append(t.corrupt, r.corrupt...)
+	return it.Err()
+}
+
+func topDocs(docs []DocInfo, n int) []DocInfo {
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].Size > docs[j].Size || docs[i].Size == docs[j].Size && docs[i].Offset < docs[j].Offset
+	})
+	if len(docs) > n {
+		docs = docs[:n]
+	}
+	return docs
+}
+
+func percentileIndex(n, p int) int {
+	idx := (n*p + 99) / 100
+	if idx > 0 {
+		idx -= 1
+	}
+	return idx
+}
+
+func (c *statsCollector) result() *FileStats {
+	t := c.total
+	stats := &FileStats{
+		Docs:             t.keySizes.count,
+		Deleted:          t.deleted,
+		Tombstones:       t.tombstones,
+		KeySizes:         t.keySizes.sizeStats(),
+		ContentSizes:     t.contentSizes.sizeStats(),
+		DecompressErrors: t.decompressErr,
+		Largest:          topDocs(t.largest, c.opt.Top),
+		DistinctKeys:     t.keys.estimate(),
+		Corrupt:          t.corrupt,
+	}
+	if stats.DistinctKeys > stats.Docs {
+		stats.DistinctKeys = stats.Docs
+	}
+	stats.DuplicateDocs = stats.Docs - stats.DistinctKeys
+	if !c.opt.KeyOnly {
+		decompressed := t.decompressed.sizeStats()
+		stats.DecompressedSizes = &decompressed
+		stats.Ratios = t.ratios.ratioStats()
+	}
+	stats.Prefixes = t.prefixes.top(c.opt.Top)
+	sort.Slice(stats.Corrupt, func(i, j int) bool { return stats.Corrupt[i].Start < stats.Corrupt[j].Start })
+	return stats
+}
+
+// WriteJSON write statistics as json
+func (s *FileStats) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+func (s SizeStats) String() string {
+	return fmt.Sprintf("total %d, min %d, max %d, mean %.1f, p50 %d, p90 %d, p99 %d",
+		s.Total, s.Min, s.Max, s.Mean, s.P50, s.P90, s.P99)
+}
+
+// WriteText write statistics as human readable text
+func (s *FileStats) WriteText(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "file:          %s (%s)\n", s.Filename, formatBytes(s.FileSize))
+	_, _ = fmt.Fprintf(w, "documents:     %d\n", s.Docs)
+	_, _ = fmt.Fprintf(w, "deleted:       %d documents, %d tombstones\n", s.Deleted, s.Tombstones)
+	_, _ = fmt.Fprintf(w, "key sizes:     %s\n", s.KeySizes)
+	_, _ = fmt.Fprintf(w, "content sizes: %s\n", s.ContentSizes)
+	if s.DecompressedSizes != nil {
+		_, _ = fmt.Fprintf(w, "decompressed:  %s\n", s.DecompressedSizes)
+		_, _ = fmt.Fprintf(w, "ratio:         mean %.3f, p50 %.3f, p90 %.3f, p99 %.3f\n", s.Ratios.Mean, s.Ratios.P50, s.Ratios.P90, s.Ratios.P99)
+		_, _ = fmt.Fprintf(w, "decompress errors: %d\n", s.DecompressErrors)
+	}
+	_, _ = fmt.Fprintf(w, "distinct keys: ~%d, ~%d duplicate documents\n", s.DistinctKeys, s.DuplicateDocs)
+	_, _ = fmt.Fprintf(w, "largest documents:\n")
+	for _, doc := range s.Largest {
+		_, _ = fmt.Fprintf(w, "  %20d\t%10d\t%10d\t%s\n", doc.Offset, doc.Size, doc.DecompressedSize, doc.Key)
+	}
+	_, _ = fmt.Fprintf(w, "key prefixes:\n")
+	for _, p := range s.Prefixes {
+		_, _ = fmt.Fprintf(w, "  %10d\t%s\n", p.Count, p.Prefix)
+	}
+	_, _ = fmt.Fprintf(w, "corrupt ranges: %d\n", len(s.Corrupt))
+	for _, r := range s.Corrupt {
+		_, _ = fmt.Fprintf(w, "  %20d - %20d\t%d bytes\n", r.Start, r.End, r.End-r.Start)
+	}
+}
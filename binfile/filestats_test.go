@@ -0,0 +1,123 @@
+package binfile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnalyseFile(t *testing.T) {
+	root := getTestDir("file_stats")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+
+	first := filepath.Join(root, "first.bin")
+	second := filepath.Join(root, "second.bin")
+	var docs []*Doc
+	for i := 0; i < 100; i++ {
+		docs = append(docs, &Doc{Key: []byte(fmt.Sprintf("a/%d", i%90)), Content: bytes.Repeat([]byte("x"), i+1)})
+	}
+	if err := writeTestDocs(first, GZIP, docs[:50]...); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTestDocs(second, GZIP, docs[50:]...); err != nil {
+		t.Fatal(err)
+	}
+	// join two files with garbage between them
+	filename := filepath.Join(root, "test.bin")
+	garbage := bytes.Repeat([]byte{0xFF}, 100)
+	if _, err := FilesConcat(filename, first); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = f.Write(garbage)
+	_ = f.Close()
+	if _, err := FilesConcat(filename, second); err != nil {
+		t.Fatal(err)
+	}
+	firstSize, _ := getFileSize(first)
+
+	for _, wc := range []int{1, 4} {
+		t.Run(fmt.Sprintf("workers-%d", wc), func(t *testing.T) {
+			stats, err := AnalyseFile(&FileStatsOption{Filename: filename, CompressType: GZIP, WorkerCount: wc, Top: 3, PrefixSep: "/"})
+			if err != nil {
+				t.Fatalf("analyse error: %v", err)
+			}
+			if stats.Docs != 100 {
+				t.Fatalf("expect 100 docs, got %d", stats.Docs)
+			}
+			// distinct keys are estimated
+			if stats.DistinctKeys < 88 || stats.DistinctKeys > 92 || stats.DuplicateDocs != 100-stats.DistinctKeys {
+				t.Errorf("expect about 90 distinct keys, got %d keys, %d duplicate docs", stats.DistinctKeys, stats.DuplicateDocs)
+			}
+			if stats.DecompressedSizes.Max != 100 || stats.DecompressedSizes.Min != 1 || stats.DecompressedSizes.P50 != 50 {
+				t.Errorf("unexpected decompressed sizes: %+v", stats.DecompressedSizes)
+			}
+			if len(stats.Largest) != 3 || stats.Largest[0].Size != stats.ContentSizes.Max {
+				t.Errorf("unexpected largest docs: %+v", stats.Largest)
+			}
+			if len(stats.Prefixes) != 1 || stats.Prefixes[0].Prefix != "a" || stats.Prefixes[0].Count != 100 {
+				t.Errorf("unexpected prefixes: %+v", stats.Prefixes)
+			}
+			if len(stats.Corrupt) != 1 || stats.Corrupt[0].Start != firstSize || stats.Corrupt[0].End != firstSize+int64(len(garbage)) {
+				t.Errorf("unexpected corrupt ranges: %+v, expect from %d", stats.Corrupt, firstSize)
+			}
+		})
+	}
+}
+
+func TestSizeHistogram(t *testing.T) {
+	h := newSizeHistogram()
+	for i := int64(1); i <= 100000; i++ {
+		h.add(i)
+	}
+	s := h.sizeStats()
+	if s.Min != 1 || s.Max != 100000 || s.Count != 100000 || s.Total != 5000050000 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+	for _, c := range []struct{ got, expected int64 }{{s.P50, 50000}, {s.P90, 90000}, {s.P99, 99000}} {
+		if diff := c.expected - c.got; diff < 0 || diff > c.expected/64 {
+			t.Errorf("expect about %d, got %d", c.expected, c.got)
+		}
+	}
+}
+
+func TestDistinctKeys(t *testing.T) {
+	s := &hyperLogLog{}
+	for i := 0; i < 200000; i++ {
+		s.add([]byte(fmt.Sprintf("key-%d", i%100000)))
+	}
+	if n := s.estimate(); n < 97000 || n > 103000 {
+		t.Fatalf("expect about 100000 distinct keys, got %d", n)
+	}
+}
+
+func TestTopPrefixes(t *testing.T) {
+	s := newSpaceSaving(100)
+	other := newSpaceSaving(100)
+	// frequent prefixes among many rare ones, counted in two sketches and merged
+	for i := 0; i < 100000; i++ {
+		sketch := s
+		if i%2 == 1 {
+			sketch = other
+		}
+		switch {
+		case i%10 < 3:
+			sketch.add("hot", 1)
+		case i%10 == 3:
+			sketch.add("warm", 1)
+		default:
+			sketch.add(fmt.Sprintf("cold-%d", i), 1)
+		}
+	}
+	s.merge(other)
+	if len(s.items) > 100 || len(s.heap) > 100 {
+		t.Fatalf("sketch exceeds its capacity: %d", len(s.heap))
+	}
+	top := s.top(2)
+	if len(top) != 2 || top[0].Prefix != "hot" || top[1].Prefix != "warm" || top[0].Count < 30000 || top[1].Count < 10000 {
+		t.Fatalf("unexpected top prefixes: %+v", top)
+	}
+}
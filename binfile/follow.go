@@ -0,0 +1,123 @@
+package binfile
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrFileTruncated = errors.New("file truncated while following")
+
+const defaultFollowInterval = time.Second
+
+// FollowOption is the option for following a bin file being appended
+type FollowOption struct {
+	Offset     int64         // start position, used when there is no saved position
+	OffsetFile string        // file saving the position after the last handled document, to resume across restarts
+	Interval   time.Duration // interval of polling for new documents, 1s if 0
+	Decompress bool          // decompress content of documents
+}
+
+// Follow streams documents to handler as they are appended, it waits at the end of file until the context is done.
+// Only complete records are read: a record is handled once all of its bytes are in the file, so records being
+// written, including regions reserved by batch writers, are picked up in a later poll, and regions abandoned by
+// batch writers are stepped over. Tombstones are handled as documents with Deleted set, so that the stream replays
+// deletes as well. Files with package compression can not be followed.
+// The position is saved to OffsetFile whenever the end of file is reached and when following stops.
+func Follow(ctx context.Context, filename string, compressType int, opt *FollowOption, handler func(doc *Doc, offset int64) error) error {
+	interval := opt.Interval
+	if interval <= 0 {
+		interval = defaultFollowInterval
+	}
+	pos, err := loadFollowOffset(opt)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	saved := pos
+	save := func() error {
+		if opt.OffsetFile == "" || saved == pos {
+			return nil
+		}
+		saved = pos
+		return saveFollowOffset(opt.OffsetFile, pos)
+	}
+	for {
+		size := fileSize(file)
+		if size < pos {
+			_ = save()
+			return &DocError{Offset: pos, Err: ErrFileTruncated}
+		}
+		for pos < size {
+			_, _, rs, err := recordHeaderAt(file, pos)
+			if errors.Is(err, ErrUnfilled) {
+				if rs = abandonedRegion(file, pos); rs > 0 {
+					pos += rs
+					continue
+				}
+			}
+			if errors.Is(err, io.EOF) || errors.Is(err, ErrUnfilled) || err == nil && pos+rs > size {
+				// record being written
+				break
+			}
+			if err != nil {
+				_ = save()
+				return &DocError{Offset: pos, Err: err}
+			}
+			doc := &Doc{}
+			if _, err = readRecord(io.NewSectionReader(file, pos, rs), doc); err == nil && opt.Decompress && !doc.Deleted {
+				doc, err = DecompressDoc(doc, compressType, Verbose)
+			}
+			if err != nil {
+				_ = save()
+				return &DocError{Offset: pos, Err: err}
+			}
+			if err = handler(doc, pos); err != nil {
+				_ = save()
+				return err
+			}
+			pos += rs
+		}
+		if err = save(); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+func loadFollowOffset(opt *FollowOption) (int64, error) {
+	if opt.OffsetFile == "" {
+		return opt.Offset, nil
+	}
+	data, err := os.ReadFile(opt.OffsetFile)
+	if os.IsNotExist(err) {
+		return opt.Offset, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// saveFollowOffset writes position to a temporary file and renames it, so the saved position is never partial
+func saveFollowOffset(filename string, pos int64) error {
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(pos, 10)+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
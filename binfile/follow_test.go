@@ -0,0 +1,104 @@
+package binfile
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFollow(t *testing.T) {
+	root := getTestDir("follow")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+	offsetFile := filepath.Join(root, "docs.pos")
+	if err := writeTestDocs(filename, NONE, &Doc{Key: []byte("a"), Content: []byte("a1")}); err != nil {
+		t.Fatal(err)
+	}
+
+	opt := &FollowOption{OffsetFile: offsetFile, Interval: 10 * time.Millisecond}
+	docs := make(chan string, 10)
+	follow := func(ctx context.Context) chan error {
+		done := make(chan error, 1)
+		go func() {
+			done <- Follow(ctx, filename, NONE, opt, func(doc *Doc, offset int64) error {
+				docs <- fmt.Sprintf("%s=%s,%v", doc.Key, doc.Content, doc.Deleted)
+				return nil
+			})
+		}()
+		return done
+	}
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-docs:
+			if got != want {
+				t.Errorf("expect %s, got %s", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for %s", want)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := follow(ctx)
+	expect("a=a1,false")
+	if err := writeTestDocs(filename, NONE, &Doc{Key: []byte("b"), Content: []byte("b1")}); err != nil {
+		t.Fatal(err)
+	}
+	expect("b=b1,false")
+
+	// a half written record is not read until it is complete
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, 4)
+	binary.LittleEndian.PutUint32(header, 1)
+	_, _ = file.Write(append(header, 'c'))
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case got := <-docs:
+		t.Fatalf("unexpected half written doc %s", got)
+	default:
+	}
+	binary.LittleEndian.PutUint32(header, 2)
+	_, _ = file.Write(append(header, "c1"...))
+	_ = file.Close()
+	expect("c=c1,false")
+	cancel()
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	size := fileSizeOf(filename)
+	if pos, err := loadFollowOffset(opt); err != nil || pos != size {
+		t.Errorf("expect saved position %d, got %d, %v", size, pos, err)
+	}
+
+	// resume after the saved position
+	bw := NewBinWriter(filename, NONE)
+	if err = bw.Open(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = bw.Delete([]byte("a"))
+	_ = bw.Close()
+	ctx, cancel = context.WithCancel(context.Background())
+	done = follow(ctx)
+	expect("a=,true")
+	cancel()
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.Truncate(filename, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-follow(context.Background()); !errors.Is(err, ErrFileTruncated) {
+		t.Errorf("expect truncated error, got %v", err)
+	}
+}
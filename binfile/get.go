@@ -0,0 +1,87 @@
+package binfile
+
+import (
+	"errors"
+)
+
+var ErrNotFound = errors.New("document not found")
+
+// GetOption is the option for getting documents by exact keys
+type GetOption struct {
+	All        bool // all live documents of each key instead of the latest one
+	Decompress bool // decompress content of found documents
+}
+
+// Found document found by key and its position
+type Found struct {
+	Offset int64
+	Doc    *Doc
+}
+
+// GetDocs finds live documents of many keys in a single pass, found documents of each key are in position order.
+// Only the latest document of each key is kept unless All is set. Keys not found are absent from the result.
+// There is no index of bin files yet, so the whole file is always scanned.
+func GetDocs(filename string, compressType int, keys [][]byte, opt *GetOption) (map[string][]Found, error) {
+	wanted := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		wanted[string(key)] = struct{}{}
+	}
+	it, err := NewDocIterator(filename, compressType, &IterOption{End: -1, Progress: true})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	found := make(map[string][]Found)
+	for it.Next() {
+		doc := it.Doc()
+		key := string(doc.Key)
+		if _, ok := wanted[key]; !ok {
+			continue
+		}
+		if opt.All {
+			found[key] = append(found[key], Found{Offset: it.Offset(), Doc: doc})
+		} else {
+			found[key] = []Found{{Offset: it.Offset(), Doc: doc}}
+		}
+	}
+	if it.Err() != nil {
+		return found, it.Err()
+	}
+	if !opt.Decompress {
+		return found, nil
+	}
+	// only documents kept are decompressed
+	for _, docs := range found {
+		for i := range docs {
+			if docs[i].Doc, err = DecompressDoc(docs[i].Doc, compressType, Verbose); err != nil {
+				return found, &DocError{Offset: docs[i].Offset, Err: err}
+			}
+		}
+	}
+	return found, nil
+}
+
+// Get the latest live document of key with content decompressed, ErrNotFound if the key does not exist or is deleted
+func (br *binReader) Get(key []byte) (*Doc, error) {
+	docs, err := br.GetAll(key)
+	if err != nil {
+		return nil, err
+	}
+	return docs[len(docs)-1], nil
+}
+
+// GetAll live documents of key in position order with content decompressed, ErrNotFound if none
+func (br *binReader) GetAll(key []byte) ([]*Doc, error) {
+	found, err := GetDocs(br.filename, br.docSeeker.CompressType(), [][]byte{key}, &GetOption{All: true, Decompress: true})
+	if err != nil {
+		return nil, err
+	}
+	if len(found[string(key)]) == 0 {
+		return nil, ErrNotFound
+	}
+	docs := make([]*Doc, 0, len(found[string(key)]))
+	for _, f := range found[string(key)] {
+		docs = append(docs, f.Doc)
+	}
+	return docs, nil
+}
@@ -0,0 +1,58 @@
+package binfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetDocs(t *testing.T) {
+	root := getTestDir("get")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+	if err := writeTestDocs(filename, GZIP,
+		&Doc{Key: []byte("a"), Content: []byte("a1")},
+		&Doc{Key: []byte("b"), Content: []byte("b1")},
+		&Doc{Key: []byte("a"), Content: []byte("a2")},
+		&Doc{Key: []byte("c"), Content: []byte("c1")},
+	); err != nil {
+		t.Fatal(err)
+	}
+	bw := NewBinWriter(filename, GZIP)
+	if err := bw.Open(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = bw.Delete([]byte("c"))
+	_ = bw.Close()
+
+	found, err := GetDocs(filename, GZIP, [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("x")}, &GetOption{Decompress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || string(found["a"][0].Doc.Content) != "a2" || string(found["b"][0].Doc.Content) != "b1" {
+		t.Errorf("unexpected found docs %v", found)
+	}
+	all, err := GetDocs(filename, GZIP, [][]byte{[]byte("a")}, &GetOption{All: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all["a"]) != 2 || all["a"][0].Offset != 0 || all["a"][1].Offset <= all["a"][0].Offset {
+		t.Errorf("unexpected documents of a %v", all["a"])
+	}
+
+	rd, err := NewBinReader(filename, GZIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+	if doc, err := rd.Get([]byte("a")); err != nil || string(doc.Content) != "a2" {
+		t.Errorf("expect a2, got %v, %v", doc, err)
+	}
+	if docs, err := rd.GetAll([]byte("a")); err != nil || len(docs) != 2 || string(docs[0].Content) != "a1" {
+		t.Errorf("expect 2 docs of a, got %v, %v", docs, err)
+	}
+	if _, err = rd.Get([]byte("c")); err != ErrNotFound {
+		t.Errorf("expect deleted c not found, got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package binfile
+
+import (
+	"regexp"
+	"sync"
+	"sync/atomic"
+)
+
+// GrepOption is the option for matching decompressed content of documents
+type GrepOption struct {
+	Pattern     string // content regex pattern
+	IgnoreCase  bool   // match content case-insensitively
+	KeyPattern  string // only documents with keys matching are grepped, all if empty
+	Context     int    // bytes of content around each match in snippets
+	MaxMatches  int    // max matches reported of each document, 0 for all
+	Offset      int64  // start position
+	Limit       int64  // max number of matched documents, 0 for unlimited
+	SkipError   bool   // seek for next valid document when an invalid one is found
+	WorkerCount int    // number of workers grepping different ranges of the file
+}
+
+// GrepMatch match found in content of a document
+type GrepMatch struct {
+	Offset  int64  // position of the document
+	Key     []byte // key of the document
+	Start   int    // start of the match in decompressed content
+	End     int    // end of the match in decompressed content
+	Snippet []byte // match with context bytes around
+}
+
+// Grep streams matches in decompressed content of documents to handler and returns the number of matched documents.
+// Documents are decompressed into buffers of the memory pool, only snippets are copied. Ranges of the file are grepped
+// in parallel, matches of the same document are reported together in order. Handler is never called concurrently,
+// it may be nil to count matched documents only.
+func Grep(filename string, compressType int, opt *GrepOption, handler func(m *GrepMatch) error) (int64, error) {
+	pattern := opt.Pattern
+	if opt.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return 0, err
+	}
+	var keyRe *regexp.Regexp
+	if opt.KeyPattern != "" {
+		if keyRe, err = regexp.Compile(opt.KeyPattern); err != nil {
+			return 0, err
+		}
+	}
+	n := opt.MaxMatches
+	if n <= 0 {
+		n = -1
+	}
+	var mu sync.Mutex
+	var count int64
+	var stop atomic.Bool
+	err = scanRanges(filename, compressType, &scanOption{offset: opt.Offset, workerCount: opt.WorkerCount, skipError: opt.SkipError, stop: &stop},
+		func(doc *Doc, offset int64) error {
+			if keyRe != nil && !keyRe.Match(doc.Key) {
+				return nil
+			}
+			buf := GlobalMemoryPool.GetCompressorBuffer()
+			defer GlobalMemoryPool.PutCompressorBuffer(buf)
+			if err := GlobalMemoryPool.DecompressToBuffer(doc.Content, compressType, buf); err != nil {
+				if opt.SkipError {
+					LogError("skip document %s at %d: %v\n", doc.Key, offset, err)
+					return nil
+				}
+				return &DocError{Offset: offset, Err: err}
+			}
+			content := buf.Bytes()
+			locs := re.FindAllIndex(content, n)
+			if len(locs) == 0 {
+				return nil
+			}
+			matches := make([]*GrepMatch, len(locs))
+			for i, loc := range locs {
+				matches[i] = &GrepMatch{Offset: offset, Key: doc.Key, Start: loc[0], End: loc[1], Snippet: snippet(content, loc[0], loc[1], opt.Context)}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if stop.Load() {
+				return nil
+			}
+			count += 1
+			if opt.Limit > 0 && count >= opt.Limit {
+				stop.Store(true)
+			}
+			if handler == nil {
+				return nil
+			}
+			for _, m := range matches {
+				if err := handler(m); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	return count, err
+}
+
+// snippet copy of content in [start, end) with context bytes around
+func snippet(content []byte, start, end, context int) []byte {
+	if start -= context; start < 0 {
+		start = 0
+	}
+	if end += context; end > len(content) {
+		end = len(content)
+	}
+	return CloneBytes(content[start:end])
+}
@@ -0,0 +1,83 @@
+package binfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGrep(t *testing.T) {
+	root := getTestDir("grep")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+	docs := make([]*Doc, 100)
+	for i := range docs {
+		docs[i] = &Doc{Key: []byte(fmt.Sprintf("doc-%02d", i)), Content: []byte(fmt.Sprintf("line %d: status=%d; again status=%d", i, i%4, i%4))}
+	}
+	for _, ct := range []int{NONE, GZIP} {
+		_ = os.Remove(filename)
+		if err := writeTestDocs(filename, ct, docs...); err != nil {
+			t.Fatal(err)
+		}
+		var matches []*GrepMatch
+		count, err := Grep(filename, ct, &GrepOption{Pattern: "status=3", Context: 2, WorkerCount: 3}, func(m *GrepMatch) error {
+			matches = append(matches, m)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 25 || len(matches) != 50 {
+			t.Fatalf("%s: expect 25 docs with 50 matches, got %d with %d", CompressTypeName(ct), count, len(matches))
+		}
+		// matches of a document are reported together
+		for i := 0; i < len(matches); i += 2 {
+			first, second := matches[i], matches[i+1]
+			if string(first.Snippet) != ": status=3; " || string(second.Snippet) != "n status=3" ||
+				first.Offset != second.Offset || first.End-first.Start != len("status=3") || second.Start <= first.End {
+				t.Errorf("unexpected matches %+v and %+v", first, second)
+			}
+		}
+
+		cases := []struct {
+			opt      GrepOption
+			expected int64
+		}{
+			{GrepOption{Pattern: "STATUS=1", IgnoreCase: true, WorkerCount: 2}, 25},
+			{GrepOption{Pattern: "status=1", KeyPattern: "doc-0", WorkerCount: 2}, 3},
+			{GrepOption{Pattern: "status", Limit: 7, WorkerCount: 2}, 7},
+			{GrepOption{Pattern: "missing", WorkerCount: 2}, 0},
+		}
+		for _, c := range cases {
+			if count, err = Grep(filename, ct, &c.opt, nil); err != nil || count != c.expected {
+				t.Errorf("%s option %+v: expect %d docs, got %d, %v", CompressTypeName(ct), c.opt, c.expected, count, err)
+			}
+		}
+	}
+}
+
+func TestGrepSkipDecompressError(t *testing.T) {
+	root := getTestDir("grep-skip")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+	if err := writeTestDocs(filename, GZIP, &Doc{Key: []byte("a"), Content: []byte("status=1")}); err != nil {
+		t.Fatal(err)
+	}
+	// a valid record with content not in gzip
+	if err := writeTestDocs(filename, NONE, &Doc{Key: []byte("b"), Content: []byte("status=1")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTestDocs(filename, GZIP, &Doc{Key: []byte("c"), Content: []byte("status=1")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Grep(filename, GZIP, &GrepOption{Pattern: "status"}, nil); err == nil {
+		t.Error("expect error of document not decompressed")
+	}
+	count, err := Grep(filename, GZIP, &GrepOption{Pattern: "status", SkipError: true}, nil)
+	if err != nil || count != 2 {
+		t.Errorf("expect 2 docs with decompress error skipped, got %d, %v", count, err)
+	}
+}
@@ -0,0 +1,323 @@
+package binfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+const iteratorBufferSize = 256 * 1024
+
+// IterOption is the option for iterating documents
+type IterOption struct {
+	Offset     int64 // start position
+	End        int64 // documents start at or after End are not visited, -1 for end of file
+	Decompress bool  // decompress document content
+	SkipError  bool  // seek for next valid document when an invalid one is found
+	Progress   bool  // feed the active progress
+	// Lock take the file size under a shared lock, so records being written by locking writers are not visited
+	Lock bool
+	// Committed stop at a trailing record not completely written instead of reporting an error, for files being appended
+	Committed bool
+	// OnSkip is called with the byte range [start, end) skipped as invalid when SkipError is set
+	OnSkip func(start, end int64)
+	// Filter only documents accepted are visited, it is called after content is decompressed, Query.MatchDoc works as it
+	Filter func(doc *Doc) bool
+
+	ShowDeleted    bool       // visit documents deleted by later tombstones
+	ShowTombstones bool       // visit tombstones, Deleted of their documents is set
+	Deletes        Tombstones // tombstones of the file, loaded at the first document if nil and deleted documents are hidden
+}
+
+// DocIterator reads documents of a bin file one by one
+type DocIterator struct {
+	br           *binReader
+	rd           *bufio.Reader
+	compressType int
+	opt          IterOption
+	offset       int64 // position of current document
+	next         int64 // position of next document
+	size         int64 // file size
+	doc          *Doc
+	err          error
+	skipped      int64 // bytes skipped because of invalid documents
+}
+
+// NewDocIterator create a document iterator over a bin file
+func NewDocIterator(filename string, compressType int, opt *IterOption) (*DocIterator, error) {
+	rd, err := NewBinReader(filename, compressType)
+	if err != nil {
+		return nil, err
+	}
+	br := rd.(*binReader)
+	stat, err := br.file.Stat()
+	if err != nil {
+		br.Close()
+		return nil, err
+	}
+	it := &DocIterator{
+		br:           br,
+		compressType: compressType,
+		opt:          *opt,
+		size:         stat.Size(),
+	}
+	if it.opt.Lock {
+		if it.size, err = lockedSize(br.file); err != nil {
+			br.Close()
+			return nil, err
+		}
+	}
+	if it.opt.End < 0 || it.opt.End > it.size {
+		it.opt.End = it.size
+	}
+	if err = it.reset(it.opt.Offset); err != nil {
+		br.Close()
+		return nil, err
+	}
+	if it.opt.Progress && it.opt.End > it.opt.Offset {
+		addProgressTotal(it.opt.End - it.opt.Offset)
+	}
+	return it, nil
+}
+
+func (it *DocIterator) reset(offset int64) error {
+	it.next = offset
+	section := io.NewSectionReader(it.br.file, offset, it.size-offset)
+	if it.rd == nil {
+		it.rd = bufio.NewReaderSize(section, iteratorBufferSize)
+	} else {
+		it.rd.Reset(section)
+	}
+	return nil
+}
+
+// Next move to next document, false returned when no more document or error occurs
+func (it *DocIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	for {
+		if it.next >= it.opt.End {
+			return false
+		}
+		it.offset = it.next
+		doc := &Doc{}
+		n, err := readRecord(it.rd, doc)
+		if err == io.EOF && n == 0 {
+			return false
+		}
+		hidden := err == nil && it.hidden(doc)
+		if it.err != nil {
+			return false
+		}
+		if hidden {
+			it.next = it.offset + int64(n)
+			if it.opt.Progress {
+				addProgress(0, int64(n))
+			}
+			continue
+		}
+		if err == nil && it.opt.Decompress {
+			doc, err = DecompressDoc(doc, it.compressType, Verbose)
+		}
+		if err == nil && it.opt.Filter != nil && !doc.Deleted && !it.opt.Filter(doc) {
+			it.next = it.offset + int64(n)
+			if it.opt.Progress {
+				addProgress(0, int64(n))
+			}
+			continue
+		}
+		if err == nil {
+			it.next = it.offset + int64(n)
+			it.doc = doc
+			if it.opt.Progress {
+				addProgress(1, int64(n))
+			}
+			return true
+		}
+		if size := abandonedRegion(it.br.file, it.offset); size > 0 {
+			it.next = it.offset + size
+			if it.opt.Progress {
+				addProgress(0, size)
+			}
+			_ = it.reset(it.next)
+			continue
+		}
+		if it.opt.Committed && incompleteRecord(it.br.file, it.offset, it.size) {
+			return false
+		}
+		if !it.opt.SkipError {
+			it.err = &DocError{Offset: it.offset, Err: err}
+			return false
+		}
+		pos, dc := it.br.next(it.offset+1, it.opt.End, -1, -1, nil, false)
+		if dc == nil || pos <= it.offset || pos >= it.opt.End {
+			it.skip(it.offset, it.opt.End)
+			return false
+		}
+		it.skip(it.offset, pos)
+		_ = it.reset(pos)
+	}
+}
+
+// hidden checks whether document is not visited because it is a tombstone or deleted. Tombstones are loaded
+// at the first document checked, err of iterator is set if they fail to load.
+func (it *DocIterator) hidden(doc *Doc) bool {
+	if doc.Deleted {
+		return !it.opt.ShowTombstones
+	}
+	if it.opt.ShowDeleted {
+		return false
+	}
+	if it.opt.Deletes == nil {
+		deletes, err := LoadTombstones(it.br.filename)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.opt.Deletes = deletes
+	}
+	return it.opt.Deletes.Deleted(doc.Key, it.offset)
+}
+
+func (it *DocIterator) skip(start, end int64) {
+	it.skipped += end - start
+	if it.opt.Progress {
+		addProgress(0, end-start)
+	}
+	if it.opt.OnSkip != nil {
+		it.opt.OnSkip(start, end)
+	}
+}
+
+// Doc current document
+func (it *DocIterator) Doc() *Doc {
+	return it.doc
+}
+
+// Offset position of current document
+func (it *DocIterator) Offset() int64 {
+	return it.offset
+}
+
+// Position position right after current document
+func (it *DocIterator) Position() int64 {
+	return it.next
+}
+
+// Size of the bin file
+func (it *DocIterator) Size() int64 {
+	return it.size
+}
+
+// Skipped number of bytes skipped because of invalid documents
+func (it *DocIterator) Skipped() int64 {
+	return it.skipped
+}
+
+// Err the error stopped the iteration, nil if no error
+func (it *DocIterator) Err() error {
+	return it.err
+}
+
+// Close the iterator
+func (it *DocIterator) Close() {
+	it.br.Close()
+}
+
+// DocError error with the position of the invalid document
+type DocError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *DocError) Error() string {
+	return fmt.Sprintf("invalid document at %d: %v", e.Offset, e.Err)
+}
+
+func (e *DocError) Unwrap() error {
+	return e.Err
+}
+
+// readRecord read a whole document record, unlike ReadDoc truncated records are reported as errors
+func readRecord(r io.Reader, doc *Doc) (int, error) {
+	src := &headerReader{r: r}
+	h := &recordHead{}
+	if err := decodeHeader(src, h); err != nil {
+		switch {
+		case err == ErrUnfilled || err == ErrReadKey || err == ErrReadDoc:
+		case err == io.EOF && src.n == 0:
+		case h.key == nil:
+			err = ErrReadKey
+		default:
+			err = ErrReadDoc
+		}
+		return src.n, err
+	}
+	doc.Key = h.key
+	if h.contentSize == recordTombstone {
+		doc.Deleted = true
+		return src.n, nil
+	}
+	doc.Attrs = h.attrs
+	doc.Content = make([]byte, h.contentSize)
+	if _, err := io.ReadFull(r, doc.Content); err != nil {
+		return src.n, ErrReadDoc
+	}
+	return src.n + int(h.contentSize), nil
+}
+
+// docRanges split file into n ranges at document boundaries by walking document headers,
+// so that workers on different ranges never start in the middle of a document.
+// Ranges after an invalid header are merged into the last valid range.
+func docRanges(filename string, n int) ([]int64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := stat.Size()
+	bounds := []int64{0}
+	if n <= 1 {
+		return append(bounds, size), nil
+	}
+	step := size / int64(n)
+	pos := int64(0)
+	for pos < size && len(bounds) < n {
+		if pos >= step*int64(len(bounds)) {
+			bounds = append(bounds, pos)
+		}
+		rs, err := recordSizeAt(file, pos)
+		if err != nil {
+			break
+		}
+		pos += rs
+	}
+	return append(bounds, size), nil
+}
+
+// recordSizeAt size of the record at pos by reading its headers only
+func recordSizeAt(r io.ReaderAt, pos int64) (int64, error) {
+	_, _, size, err := recordHeaderAt(r, pos)
+	return size, err
+}
+
+// recordHeaderAt key size, content size and record size of the record at pos,
+// content size is recordTombstone for tombstones
+func recordHeaderAt(r io.ReaderAt, pos int64) (keySize, contentSize int32, size int64, err error) {
+	h := &recordHead{}
+	if err = decodeHeader(&headerReaderAt{r: r, pos: pos}, h); err != nil {
+		return 0, 0, 0, err
+	}
+	if h.contentSize == recordTombstone {
+		return h.keySize, h.contentSize, h.size, nil
+	}
+	return h.keySize, h.contentSize, h.size + int64(h.contentSize), nil
+}
@@ -0,0 +1,283 @@
+package binfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// content encodings of exported json lines
+const (
+	EncodingJSON   = "json"
+	EncodingString = "string"
+	EncodingBase64 = "base64"
+)
+
+var ErrFieldNotFound = errors.New("field not found")
+
+// JSONLExportOption is the option for exporting documents as json lines
+type JSONLExportOption struct {
+	Input        string // source bin file
+	Output       string // json lines file, stdout if empty
+	CompressType int    // document compression type of source
+	Pattern      string // key regex pattern, only matched documents are exported if not empty
+	Exact        bool   // keep content byte for byte, json content not compact is exported as a string then
+}
+
+// JSONLine is one exported document. Content is embedded compacted if it is json,
+// as a string if it is valid utf8, otherwise base64 encoded. Keys not valid utf8 are base64 encoded.
+type JSONLine struct {
+	Key         string          `json:"key"`
+	KeyEncoding string          `json:"key_encoding,omitempty"`
+	Offset      int64           `json:"offset"`
+	Content     json.RawMessage `json:"content"`
+	Encoding    string          `json:"encoding"`
+}
+
+// ExportJSONL writes documents as json lines, one document per line
+func ExportJSONL(opt *JSONLExportOption) (count int64, err error) {
+	var pattern *regexp.Regexp
+	if opt.Pattern != "" {
+		if pattern, err = regexp.Compile(opt.Pattern); err != nil {
+			return 0, err
+		}
+	}
+	it, err := NewDocIterator(opt.Input, opt.CompressType, &IterOption{End: -1, Decompress: true, Progress: true})
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+	out, err := newOutWriter(opt.Output, NONE)
+	if err != nil {
+		return 0, err
+	}
+	defer closeWriter(out, opt.Output)
+	w := bufio.NewWriter(out)
+	defer func() {
+		if er := w.Flush(); err == nil {
+			err = er
+		}
+	}()
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for it.Next() {
+		doc := it.Doc()
+		if pattern != nil && !pattern.Match(doc.Key) {
+			continue
+		}
+		if err = encoder.Encode(NewJSONLine(doc, it.Offset(), opt.Exact)); err != nil {
+			return count, err
+		}
+		count += 1
+	}
+	return count, it.Err()
+}
+
+// NewJSONLine creates json line of document at offset, json content is embedded compacted, if exact
+// json content not compact is kept as a string instead so that it is imported back as it was
+func NewJSONLine(doc *Doc, offset int64, exact bool) *JSONLine {
+	line := &JSONLine{Key: string(doc.Key), Offset: offset}
+	if !utf8.Valid(doc.Key) {
+		line.Key = base64.StdEncoding.EncodeToString(doc.Key)
+		line.KeyEncoding = EncodingBase64
+	}
+	buf := bytes.Buffer{}
+	// json is compacted when encoded, only compact json is kept as it is
+	isJSON := json.Valid(doc.Content) && json.Compact(&buf, doc.Content) == nil
+	switch {
+	case isJSON && (!exact || bytes.Equal(buf.Bytes(), doc.Content)):
+		line.Content = buf.Bytes()
+		line.Encoding = EncodingJSON
+	case utf8.Valid(doc.Content):
+		line.Content, _ = json.Marshal(string(doc.Content))
+		line.Encoding = EncodingString
+	default:
+		line.Content, _ = json.Marshal(base64.StdEncoding.EncodeToString(doc.Content))
+		line.Encoding = EncodingBase64
+	}
+	return line
+}
+
+// JSONLImportOption is the option for building bin file from json lines
+type JSONLImportOption struct {
+	Input        string // json lines file, stdin if empty or "-"
+	Output       string // bin file, documents are appended if exists
+	CompressType int    // document compression type of output
+	KeyField     string // dot separated path of key field, "key" if empty
+	ContentField string // dot separated path of content field, whole line if empty
+	SkipInvalid  bool   // skip invalid lines instead of abort
+	BatchSize    int    // write documents in batches of about this many bytes by a BatchWriter, one by one if 0
+	// Rolling write documents into segments rotated by a RollingBinWriter, Output is not used then
+	Rolling *RollingOption
+}
+
+// ImportResult is the summary of importing
+type ImportResult struct {
+	Lines   int64 // number of non-empty lines read
+	Docs    int64 // number of documents written
+	Invalid int64 // number of invalid lines skipped
+}
+
+// ImportJSONL builds bin file from json lines.
+// Lines exported by ExportJSONL are imported back as they were, the encoding fields are honored
+// if key field is "key" and content field is "content". String values are used as is, other values are used
+// as json text.
+func ImportJSONL(opt *JSONLImportOption) (*ImportResult, error) {
+	in := io.Reader(os.Stdin)
+	if opt.Input != "" && opt.Input != "-" {
+		file, err := os.Open(opt.Input)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		in = file
+		addProgressTotal(fileSize(file))
+	}
+	keyField := opt.KeyField
+	if keyField == "" {
+		keyField = "key"
+	}
+	bw := NewBinWriter(opt.Output, opt.CompressType)
+	if opt.Rolling != nil {
+		rw, err := NewRollingBinWriter(opt.Rolling)
+		if err != nil {
+			return nil, err
+		}
+		bw = rw
+	} else if opt.BatchSize > 0 {
+		bw = NewBatchWriter(opt.Output, opt.CompressType, opt.BatchSize)
+	}
+	if err := bw.Open(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = bw.Close()
+	}()
+	res := &ImportResult{}
+	reader := bufio.NewReaderSize(in, 1024*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			addProgress(0, int64(len(line)))
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			res.Lines += 1
+			doc, er := parseJSONLine(line, keyField, opt.ContentField)
+			if er != nil {
+				if !opt.SkipInvalid {
+					return res, fmt.Errorf("line %d: %w", res.Lines, er)
+				}
+				LogError("skip line %d: %v\n", res.Lines, er)
+				res.Invalid += 1
+				recordSkip()
+			} else if _, er = bw.Write(doc); er != nil {
+				return res, er
+			} else {
+				addProgress(1, 0)
+				res.Docs += 1
+			}
+		}
+		if err == io.EOF {
+			// documents buffered by batch writers are written and segments of rolling writers completed on closing
+			return res, bw.Close()
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+}
+
+func parseJSONLine(line []byte, keyField, contentField string) (*Doc, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(line, &obj); err != nil {
+		return nil, err
+	}
+	key, err := jsonField(obj, keyField)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", keyField, err)
+	}
+	doc := &Doc{}
+	if doc.Key, err = jsonText(key); err != nil {
+		return nil, err
+	}
+	if keyField == "key" && jsonString(obj, "key_encoding") == EncodingBase64 {
+		if doc.Key, err = base64.StdEncoding.DecodeString(string(doc.Key)); err != nil {
+			return nil, fmt.Errorf("key: %w", err)
+		}
+	}
+	if contentField == "" {
+		doc.Content = CloneBytes(line)
+		return doc, nil
+	}
+	content, err := jsonField(obj, contentField)
+	if err != nil {
+		return nil, fmt.Errorf("content %s: %w", contentField, err)
+	}
+	encoding := ""
+	if contentField == "content" {
+		encoding = jsonString(obj, "encoding")
+	}
+	switch encoding {
+	case EncodingBase64:
+		var s string
+		if err = json.Unmarshal(content, &s); err != nil {
+			return nil, err
+		}
+		doc.Content, err = base64.StdEncoding.DecodeString(s)
+	case EncodingJSON:
+		doc.Content = CloneBytes(content)
+	default:
+		doc.Content, err = jsonText(content)
+	}
+	return doc, err
+}
+
+// jsonField finds value of dot separated path in json object
+func jsonField(obj map[string]json.RawMessage, path string) (json.RawMessage, error) {
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		value, ok := obj[part]
+		if !ok {
+			return nil, ErrFieldNotFound
+		}
+		if i == len(parts)-1 {
+			return value, nil
+		}
+		obj = nil
+		if err := json.Unmarshal(value, &obj); err != nil || obj == nil {
+			return nil, ErrFieldNotFound
+		}
+	}
+	return nil, ErrFieldNotFound
+}
+
+// jsonString value of string field of json object, empty if it is not a string
+func jsonString(obj map[string]json.RawMessage, name string) string {
+	var s string
+	if raw, ok := obj[name]; ok {
+		_ = json.Unmarshal(raw, &s)
+	}
+	return s
+}
+
+// jsonText value of json string, or the json text for other types
+func jsonText(value json.RawMessage) ([]byte, error) {
+	if len(value) > 0 && value[0] == '"' {
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			return nil, err
+		}
+		return []byte(s), nil
+	}
+	return CloneBytes(value), nil
+}
@@ -0,0 +1,98 @@
+package binfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONLRoundTrip(t *testing.T) {
+	root := getTestDir("jsonl")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	src := filepath.Join(root, "src.bin")
+	docs := []*Doc{
+		{Key: []byte("json"), Content: []byte(`{"a":[1,2],"b":"x"}`)},
+		{Key: []byte("text"), Content: []byte("line1\nline2")},
+		{Key: []byte("quoted"), Content: []byte(`"a json string"`)},
+		{Key: []byte("binary"), Content: []byte{0xff, 0x00, 0xfe, '\n'}},
+		{Key: []byte("indented"), Content: []byte("{\n  \"a\": 1\n}\n")},
+		{Key: []byte{0xff, 'k', 0x80}, Content: []byte(`{"key":"not utf8"}`)},
+	}
+	if err := writeTestDocs(src, GZIP, docs...); err != nil {
+		t.Fatal(err)
+	}
+	lines := filepath.Join(root, "docs.jsonl")
+	count, err := ExportJSONL(&JSONLExportOption{Input: src, Output: lines, CompressType: GZIP, Exact: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != int64(len(docs)) {
+		t.Fatalf("expect %d exported, got %d", len(docs), count)
+	}
+	dst := filepath.Join(root, "dst.bin")
+	res, err := ImportJSONL(&JSONLImportOption{Input: lines, Output: dst, CompressType: NONE, ContentField: "content"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Docs != int64(len(docs)) || res.Invalid != 0 {
+		t.Fatalf("unexpected import result %+v", res)
+	}
+	got := readTestDocs(t, dst, NONE)
+	for i, doc := range docs {
+		if string(got[i].Key) != string(doc.Key) || string(got[i].Content) != string(doc.Content) {
+			t.Errorf("doc %d: expect %s=%q, got %s=%q", i, doc.Key, doc.Content, got[i].Key, got[i].Content)
+		}
+	}
+}
+
+func TestNewJSONLine(t *testing.T) {
+	doc := &Doc{Key: []byte("k"), Content: []byte("{\n  \"id\": 1\n}\n")}
+	if line := NewJSONLine(doc, 0, false); line.Encoding != EncodingJSON || string(line.Content) != `{"id":1}` {
+		t.Errorf("expect json embedded compacted, got %s %s", line.Encoding, line.Content)
+	}
+	if line := NewJSONLine(doc, 0, true); line.Encoding != EncodingString {
+		t.Errorf("expect json not compact exported as string when exact, got %s", line.Encoding)
+	}
+	doc.Content = []byte(`{"id":1}`)
+	if line := NewJSONLine(doc, 0, true); line.Encoding != EncodingJSON || string(line.Content) != `{"id":1}` {
+		t.Errorf("expect compact json embedded when exact, got %s %s", line.Encoding, line.Content)
+	}
+}
+
+func TestImportJSONLFields(t *testing.T) {
+	root := getTestDir("jsonl-fields")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	lines := filepath.Join(root, "in.jsonl")
+	data := `{"meta":{"id":1},"body":{"v":"a"}}
+
+{"meta":{"id":"two"},"body":"plain"}
+{"meta":{},"body":"no key"}
+not json
+`
+	if err := os.WriteFile(lines, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(root, "dst.bin")
+	opt := &JSONLImportOption{Input: lines, Output: dst, CompressType: NONE, KeyField: "meta.id", ContentField: "body"}
+	if _, err := ImportJSONL(opt); err == nil {
+		t.Fatal("expect error of invalid line")
+	}
+	_ = os.Remove(dst)
+	opt.SkipInvalid = true
+	res, err := ImportJSONL(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Lines != 4 || res.Docs != 2 || res.Invalid != 2 {
+		t.Fatalf("unexpected import result %+v", res)
+	}
+	got := readTestDocs(t, dst, NONE)
+	expected := [][2]string{{"1", `{"v":"a"}`}, {"two", "plain"}}
+	for i, e := range expected {
+		if string(got[i].Key) != e[0] || string(got[i].Content) != e[1] {
+			t.Errorf("doc %d: expect %s=%s, got %s=%s", i, e[0], e[1], got[i].Key, got[i].Content)
+		}
+	}
+}
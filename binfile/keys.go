@@ -0,0 +1,126 @@
+package binfile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// key strategies of package, they decide how document keys are derived from files
+const (
+	KeyBase     = "base"      // base name of file
+	KeyRelative = "relative"  // path relative to the root directory, entry name for archives
+	KeyFull     = "full"      // absolute path of file, entry name for archives
+	KeyStripExt = "strip-ext" // base name without the last extension
+	KeyRegex    = "regex"     // first capture group of regex matched with path, the whole match if no group
+	KeyHash     = "hash"      // sha256 of the content in hex
+)
+
+var ErrKeyNotMatch = errors.New("key regex not match")
+
+// KeyCollision two files result in the same key
+type KeyCollision struct {
+	Key   string
+	First string // path of the file first got the key
+	Path  string // path of the collided file
+}
+
+// keyDeriver derives document keys from files and tracks key collisions
+type keyDeriver struct {
+	strategy    string
+	root        string
+	re          *regexp.Regexp
+	seen        map[string]string
+	collisions  int64
+	onCollision func(c *KeyCollision)
+}
+
+func newKeyDeriver(option *PackageOption, root string) (*keyDeriver, error) {
+	k := &keyDeriver{
+		strategy:    option.KeyStrategy,
+		root:        root,
+		seen:        make(map[string]string),
+		onCollision: option.OnCollision,
+	}
+	switch k.strategy {
+	case "":
+		k.strategy = KeyBase
+	case KeyBase, KeyRelative, KeyFull, KeyStripExt, KeyHash:
+	case KeyRegex:
+		re, err := regexp.Compile(option.KeyRegex)
+		if err != nil {
+			return nil, err
+		}
+		k.re = re
+	default:
+		return nil, fmt.Errorf("unknown key strategy %s", k.strategy)
+	}
+	return k, nil
+}
+
+// key derives key of file at path, path is the entry name if the file is in an archive
+func (k *keyDeriver) key(path string, content []byte) (string, error) {
+	if k == nil {
+		return filepath.Base(path), nil
+	}
+	switch k.strategy {
+	case KeyRelative:
+		if k.root == "" {
+			return strings.TrimPrefix(filepath.Clean("/"+path), "/"), nil
+		}
+		return filepath.Rel(k.root, path)
+	case KeyFull:
+		if k.root == "" {
+			return path, nil
+		}
+		return filepath.Abs(path)
+	case KeyStripExt:
+		base := filepath.Base(path)
+		return strings.TrimSuffix(base, filepath.Ext(base)), nil
+	case KeyRegex:
+		m := k.re.FindStringSubmatch(path)
+		if m == nil {
+			return "", ErrKeyNotMatch
+		}
+		if len(m) > 1 {
+			return m[1], nil
+		}
+		return m[0], nil
+	case KeyHash:
+		sum := sha256.Sum256(content)
+		return hex.EncodeToString(sum[:]), nil
+	}
+	return filepath.Base(path), nil
+}
+
+// doc creates document of file with derived key, collisions are reported but the document is still created
+func (k *keyDeriver) doc(path string, content []byte) (*Doc, error) {
+	key, err := k.key(path, content)
+	if err != nil {
+		return nil, err
+	}
+	if k != nil {
+		if first, ok := k.seen[key]; ok {
+			k.collisions += 1
+			c := &KeyCollision{Key: key, First: first, Path: path}
+			if k.onCollision != nil {
+				k.onCollision(c)
+			} else {
+				LogWarn("key %s of %s collides with %s\n", key, path, first)
+			}
+		} else {
+			k.seen[key] = path
+		}
+	}
+	return &Doc{Key: []byte(key), Content: content}, nil
+}
+
+func (k *keyDeriver) report() {
+	if k != nil && k.collisions > 0 {
+		LogWarn("%d key collisions found with key strategy %s\n", k.collisions, k.strategy)
+	}
+}
@@ -0,0 +1,103 @@
+package binfile
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestKeyDeriver(t *testing.T) {
+	root := filepath.Join("data", "root")
+	path := filepath.Join(root, "2024", "a.json.gz")
+	abs, _ := filepath.Abs(path)
+	cases := []struct {
+		strategy string
+		regex    string
+		root     string
+		path     string
+		expected string
+	}{
+		{KeyBase, "", root, path, "a.json.gz"},
+		{KeyRelative, "", root, path, filepath.Join("2024", "a.json.gz")},
+		{KeyRelative, "", "", "./x/../y/b.txt", "y/b.txt"},
+		{KeyFull, "", root, path, abs},
+		{KeyFull, "", "", "dir/b.txt", "dir/b.txt"},
+		{KeyStripExt, "", root, path, "a.json"},
+		{KeyRegex, `(\d{4})/`, root, "data/root/2024/a.json", "2024"},
+		{KeyRegex, `[a-z]+\.json`, root, "data/root/2024/a.json", "a.json"},
+		{KeyHash, "", root, path, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+	}
+	for _, c := range cases {
+		k, err := newKeyDeriver(&PackageOption{KeyStrategy: c.strategy, KeyRegex: c.regex}, c.root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := k.key(c.path, []byte("hello"))
+		if err != nil {
+			t.Errorf("%s %s: %v", c.strategy, c.path, err)
+		} else if key != c.expected {
+			t.Errorf("%s %s: expect %s, got %s", c.strategy, c.path, c.expected, key)
+		}
+	}
+	k, _ := newKeyDeriver(&PackageOption{KeyStrategy: KeyRegex, KeyRegex: `\d+`}, "")
+	if _, err := k.key("abc", nil); err != ErrKeyNotMatch {
+		t.Errorf("expect ErrKeyNotMatch, got %v", err)
+	}
+	if _, err := newKeyDeriver(&PackageOption{KeyStrategy: "unknown"}, ""); err == nil {
+		t.Error("expect error of unknown strategy")
+	}
+}
+
+func TestPackageKeyCollision(t *testing.T) {
+	root := getTestDir("keys")
+	_ = os.MkdirAll(filepath.Join(root, "src", "a"), 0755)
+	_ = os.MkdirAll(filepath.Join(root, "src", "b"), 0755)
+	defer os.RemoveAll(root)
+	src := filepath.Join(root, "src")
+	_ = os.WriteFile(filepath.Join(src, "a", "doc.json"), []byte("a"), 0644)
+	_ = os.WriteFile(filepath.Join(src, "b", "doc.json"), []byte("b"), 0644)
+
+	_ = os.WriteFile(filepath.Join(src, "top.json"), []byte("top"), 0644)
+
+	var collisions []*KeyCollision
+	opt := &PackageOption{Path: src, WorkerCount: 1, InputCompress: NONE, OnCollision: func(c *KeyCollision) {
+		collisions = append(collisions, c)
+	}}
+	// sub directories are not walked by default
+	top := filepath.Join(root, "top.bin")
+	if err := Package(opt, NewBinWriter(top, NONE)); err != nil {
+		t.Fatal(err)
+	}
+	if docs := readTestDocs(t, top, NONE); len(docs) != 1 || string(docs[0].Key) != "top.json" {
+		t.Fatalf("expect only top.json, got %d docs", len(docs))
+	}
+
+	opt.Recursive = true
+	base := filepath.Join(root, "base.bin")
+	if err := Package(opt, NewBinWriter(base, NONE)); err != nil {
+		t.Fatal(err)
+	}
+	if len(collisions) != 1 || collisions[0].Key != "doc.json" {
+		t.Fatalf("expect one collision of doc.json, got %v", collisions)
+	}
+
+	collisions = nil
+	opt.KeyStrategy = KeyRelative
+	relative := filepath.Join(root, "relative.bin")
+	if err := Package(opt, NewBinWriter(relative, NONE)); err != nil {
+		t.Fatal(err)
+	}
+	if len(collisions) != 0 {
+		t.Fatalf("expect no collision, got %v", collisions)
+	}
+	docs := readTestDocs(t, relative, NONE)
+	var keys []string
+	for _, doc := range docs {
+		keys = append(keys, string(doc.Key))
+	}
+	sort.Strings(keys)
+	if len(keys) != 3 || keys[0] != filepath.Join("a", "doc.json") || keys[1] != filepath.Join("b", "doc.json") || keys[2] != "top.json" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+}
@@ -270,24 +270,10 @@ func (mp *MemoryPool) DecompressWithPool(data []byte, compressType int) ([]byte,
 	if compressType == NONE {
 		return data, nil
 	}
-	br := bytes.NewReader(data)
-	decompressor := mp.GetDecompressor(compressType)
-	if decompressor == nil {
-		return nil, fmt.Errorf("get decompressor error: compressType %d", compressType)
-	}
-	defer mp.PutDecompressor(compressType, decompressor)
-	err := decompressor.Reset(br)
-	if err != nil {
-		return nil, err
-	}
 	// 使用缓冲区读取解压缩后的数据
 	buf := mp.GetCompressorBuffer()
 	defer mp.PutCompressorBuffer(buf)
-
-	// 读取所有数据到缓冲区
-	defer decompressor.Close()
-	_, err = io.Copy(buf, decompressor)
-	if err != nil {
+	if err := mp.DecompressToBuffer(data, compressType, buf); err != nil {
 		return nil, err
 	}
 
@@ -297,5 +283,24 @@ func (mp *MemoryPool) DecompressWithPool(data []byte, compressType int) ([]byte,
 	return result, nil
 }
 
+// DecompressToBuffer 解压缩数据并追加到缓冲区，不复制结果，适合只读取一次的场景
+func (mp *MemoryPool) DecompressToBuffer(data []byte, compressType int, buf *bytes.Buffer) error {
+	if compressType == NONE {
+		_, err := buf.Write(data)
+		return err
+	}
+	decompressor := mp.GetDecompressor(compressType)
+	if decompressor == nil {
+		return fmt.Errorf("get decompressor error: compressType %d", compressType)
+	}
+	defer mp.PutDecompressor(compressType, decompressor)
+	if err := decompressor.Reset(bytes.NewReader(data)); err != nil {
+		return err
+	}
+	defer decompressor.Close()
+	_, err := io.Copy(buf, decompressor)
+	return err
+}
+
 // GlobalMemoryPool 全局内存池实例
 var GlobalMemoryPool = NewMemoryPool()
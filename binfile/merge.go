@@ -0,0 +1,290 @@
+package binfile
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"sort"
+)
+
+// AutoDetect compression type detected from the first document of a bin file
+const AutoDetect = -1
+
+var ErrNoInput = errors.New("no input file")
+
+// MergeOption is the option for merging bin files
+type MergeOption struct {
+	Inputs         []string // input bin files
+	Output         string   // output bin file, documents are appended if exists
+	SourceCompress int      // compression type of inputs, AutoDetect to detect for each file
+	TargetCompress int      // compression type of output
+	Dedupe         bool     // keep only the first document of the same key
+	NewestWins     bool     // resolve key conflicts by keeping the latest document of the newest file
+	SkipInvalid    bool     // skip invalid input files instead of abort
+}
+
+// MergeResult is the summary of merging
+type MergeResult struct {
+	Files      int   // number of merged files
+	Invalid    int   // number of invalid files skipped
+	Docs       int64 // number of documents written
+	Duplicates int64 // number of documents dropped because of duplicated keys
+	Copied     int64 // number of bytes copied as is
+}
+
+// Merge combines many bin files into one, documents are re-encoded when compression types differ.
+// Inputs are validated while they are merged, output of an invalid input is removed.
+func Merge(opt *MergeOption) (*MergeResult, error) {
+	if len(opt.Inputs) == 0 {
+		return nil, ErrNoInput
+	}
+	inputs, err := mergeInputs(opt)
+	if err != nil {
+		return nil, err
+	}
+	dedupe := opt.Dedupe || opt.NewestWins
+	res := &MergeResult{}
+	bw := createBinWriter(opt.Output, NONE)
+	if err = bw.Open(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = bw.Close()
+	}()
+	var keys map[string]struct{}
+	if dedupe {
+		keys = make(map[string]struct{})
+	}
+	for _, input := range inputs {
+		ct := opt.SourceCompress
+		if ct == AutoDetect {
+			if ct, err = DetectDocCompression(input); err != nil {
+				if !opt.SkipInvalid {
+					return res, err
+				}
+				LogError("skip %s: %v\n", input, err)
+				res.Invalid += 1
+				continue
+			}
+			LogDebug("%s detected as %s\n", input, CompressTypeName(ct))
+		}
+		var docs, dups, n int64
+		if !dedupe && ct == opt.TargetCompress {
+			docs, n, err = bw.copyRecords(input, ct)
+		} else {
+			docs, dups, err = mergeFile(bw, input, ct, opt.TargetCompress, keys, opt.NewestWins)
+		}
+		var ie *inputError
+		if errors.As(err, &ie) && opt.SkipInvalid {
+			LogError("skip %s: %v\n", input, err)
+			res.Invalid += 1
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		res.Files += 1
+		res.Docs += docs
+		res.Duplicates += dups
+		if n > 0 {
+			res.Copied += n
+			LogInfo("%s copied with %d bytes\n", input, n)
+		} else {
+			LogInfo("%s merged with %d documents, %d duplicated\n", input, docs, dups)
+		}
+	}
+	return res, nil
+}
+
+// mergeInputs orders inputs, newest file first if newest wins
+func mergeInputs(opt *MergeOption) ([]string, error) {
+	inputs := make([]string, len(opt.Inputs))
+	copy(inputs, opt.Inputs)
+	if !opt.NewestWins {
+		return inputs, nil
+	}
+	times := make(map[string]int64, len(inputs))
+	for _, input := range inputs {
+		stat, err := os.Stat(input)
+		if err != nil {
+			return nil, err
+		}
+		times[input] = stat.ModTime().UnixNano()
+	}
+	sort.SliceStable(inputs, func(i, j int) bool {
+		return times[inputs[i]] > times[inputs[j]]
+	})
+	return inputs, nil
+}
+
+// mergeFile writes documents of input not seen in former inputs, keys written are added to keys if not nil.
+// Only the last document of each key in input is written if latest is set. Output of input is truncated away
+// and its keys are forgotten when input is invalid.
+func mergeFile(bw *binWriter, input string, st, tt int, keys map[string]struct{}, latest bool) (docs, dups int64, err error) {
+	var last map[string]int64
+	if latest {
+		if last, err = lastOffsets(input, st); err != nil {
+			return 0, 0, &inputError{err: err}
+		}
+	}
+	// tombstones are kept so that documents of former inputs are deleted as well
+	it, err := NewDocIterator(input, st, &IterOption{End: -1, Progress: true, ShowTombstones: true})
+	if err != nil {
+		return 0, 0, &inputError{err: err}
+	}
+	defer it.Close()
+	start := fileSize(bw.file)
+	// deleted keys count as seen after the input is done, documents of them in the following inputs are dropped,
+	// while documents written after the tombstone in the same input are kept
+	var deleted, added []string
+	defer func() {
+		if err != nil {
+			for _, key := range added {
+				delete(keys, key)
+			}
+			return
+		}
+		for _, key := range deleted {
+			keys[key] = struct{}{}
+		}
+	}()
+	for it.Next() {
+		doc := it.Doc()
+		if last != nil && last[string(doc.Key)] != it.Offset() {
+			if !doc.Deleted {
+				dups += 1
+				recordSkip()
+			}
+			continue
+		}
+		if keys != nil && doc.Deleted {
+			// documents of newer inputs win over tombstones of older ones,
+			// otherwise the tombstone deletes documents of the key written before in output
+			if _, ok := keys[string(doc.Key)]; latest && ok {
+				continue
+			}
+			deleted = append(deleted, string(doc.Key))
+			if _, err = bw.compressAndWrite(doc, tt, keepCompressed, bw.writeDoc); err != nil {
+				break
+			}
+			continue
+		}
+		if keys != nil {
+			if _, ok := keys[string(doc.Key)]; ok {
+				dups += 1
+				recordSkip()
+				continue
+			}
+			keys[string(doc.Key)] = struct{}{}
+			added = append(added, string(doc.Key))
+		}
+		if st == tt {
+			_, err = bw.compressAndWrite(doc, tt, keepCompressed, bw.writeDoc)
+		} else if doc, err = DecompressDoc(doc, st, Verbose); err != nil {
+			err = &inputError{err: &DocError{Offset: it.Offset(), Err: err}}
+		} else {
+			_, err = bw.compressAndWrite(doc, tt, CompressDoc, bw.writeDoc)
+		}
+		if err != nil {
+			break
+		}
+		docs += 1
+	}
+	if err == nil && it.Err() != nil {
+		err = &inputError{err: it.Err()}
+	}
+	var ie *inputError
+	if errors.As(err, &ie) {
+		if er := bw.file.Truncate(start); er != nil {
+			LogError("truncate %s error: %v\n", bw.filename, er)
+		}
+	}
+	return docs, dups, err
+}
+
+// keepCompressed documents already in the target compression
+func keepCompressed(doc *Doc, _ int) (*Doc, error) {
+	return doc, nil
+}
+
+// lastOffsets positions of the last record of each key, documents or tombstones
+func lastOffsets(input string, st int) (map[string]int64, error) {
+	it, err := NewDocIterator(input, st, &IterOption{End: -1, ShowDeleted: true, ShowTombstones: true})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	last := make(map[string]int64)
+	for it.Next() {
+		last[string(it.Doc().Key)] = it.Offset()
+	}
+	return last, it.Err()
+}
+
+// ValidateBinFile checks all documents of a bin file are complete
+func ValidateBinFile(filename string) error {
+	it, err := NewDocIterator(filename, NONE, &IterOption{End: -1, ShowDeleted: true, ShowTombstones: true})
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.Next() {
+	}
+	return it.Err()
+}
+
+// DetectDocCompression detect document compression type by the content of the first document
+func DetectDocCompression(filename string) (int, error) {
+	it, err := NewDocIterator(filename, NONE, &IterOption{End: -1, ShowDeleted: true})
+	if err != nil {
+		return NONE, err
+	}
+	defer it.Close()
+	if !it.Next() {
+		if it.Err() != nil {
+			return NONE, it.Err()
+		}
+		// empty file, any type works
+		return NONE, nil
+	}
+	return detectContentCompression(it.Doc().Content), nil
+}
+
+func detectContentCompression(content []byte) int {
+	switch {
+	case bytes.HasPrefix(content, []byte{0x1F, 0x8B}):
+		return GZIP
+	case bytes.HasPrefix(content, []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}):
+		return XZ
+	case bytes.HasPrefix(content, []byte("BZh")):
+		return BZIP2
+	case bytes.HasPrefix(content, []byte{0x04, 0x22, 0x4D, 0x18}):
+		return LZ4
+	}
+	// brotli has no magic header, try to decompress it
+	if _, err := Decompress(content, BROTLI); err == nil {
+		return BROTLI
+	}
+	return NONE
+}
+
+// CompressTypeName name of compression type
+func CompressTypeName(compressType int) string {
+	switch compressType {
+	case NONE:
+		return "none"
+	case GZIP:
+		return "gzip"
+	case ZIP:
+		return "zip"
+	case BZIP2:
+		return "bzip2"
+	case BROTLI:
+		return "brotli"
+	case LZ4:
+		return "lz4"
+	case XZ:
+		return "xz"
+	}
+	return "unknown"
+}
@@ -0,0 +1,163 @@
+package binfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestDocs(filename string, compressType int, docs ...*Doc) error {
+	bw := NewBinWriter(filename, compressType)
+	if err := bw.Open(); err != nil {
+		return err
+	}
+	defer bw.Close()
+	for _, doc := range docs {
+		if _, err := bw.Write(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readTestDocs(t *testing.T, filename string, compressType int) []*Doc {
+	it, err := NewDocIterator(filename, compressType, &IterOption{End: -1, Decompress: true})
+	if err != nil {
+		t.Fatalf("open %s error: %v", filename, err)
+	}
+	defer it.Close()
+	var docs []*Doc
+	for it.Next() {
+		docs = append(docs, it.Doc())
+	}
+	if it.Err() != nil {
+		t.Fatalf("read %s error: %v", filename, it.Err())
+	}
+	return docs
+}
+
+func TestMerge(t *testing.T) {
+	root := getTestDir("merge")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+
+	a := filepath.Join(root, "a.bin")
+	b := filepath.Join(root, "b.bin")
+	if err := writeTestDocs(a, GZIP, &Doc{Key: []byte("k1"), Content: []byte("a1")}, &Doc{Key: []byte("k2"), Content: []byte("a2")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTestDocs(b, BROTLI, &Doc{Key: []byte("k2"), Content: []byte("b2")}, &Doc{Key: []byte("k3"), Content: []byte("b3")}); err != nil {
+		t.Fatal(err)
+	}
+	newer := time.Now().Add(time.Hour)
+	_ = os.Chtimes(b, newer, newer)
+
+	cases := []struct {
+		name     string
+		opt      MergeOption
+		expected []string
+	}{
+		{"all", MergeOption{SourceCompress: AutoDetect, TargetCompress: GZIP}, []string{"k1:a1", "k2:a2", "k2:b2", "k3:b3"}},
+		{"dedupe", MergeOption{SourceCompress: AutoDetect, TargetCompress: XZ, Dedupe: true}, []string{"k1:a1", "k2:a2", "k3:b3"}},
+		{"newest", MergeOption{SourceCompress: AutoDetect, TargetCompress: NONE, NewestWins: true}, []string{"k2:b2", "k3:b3", "k1:a1"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out := filepath.Join(root, c.name+".bin")
+			c.opt.Inputs = []string{a, b}
+			c.opt.Output = out
+			if _, err := Merge(&c.opt); err != nil {
+				t.Fatalf("merge error: %v", err)
+			}
+			docs := readTestDocs(t, out, c.opt.TargetCompress)
+			if len(docs) != len(c.expected) {
+				t.Fatalf("expect %d docs, got %d", len(c.expected), len(docs))
+			}
+			for i, doc := range docs {
+				if got := fmt.Sprintf("%s:%s", doc.Key, doc.Content); got != c.expected[i] {
+					t.Errorf("doc %d: expect %s, got %s", i, c.expected[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeInvalidInput(t *testing.T) {
+	root := getTestDir("merge_invalid")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+
+	a := filepath.Join(root, "a.bin")
+	bad := filepath.Join(root, "bad.bin")
+	if err := writeTestDocs(a, NONE, &Doc{Key: []byte("k1"), Content: []byte("a1")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTestDocs(bad, NONE, &Doc{Key: []byte("k2"), Content: []byte("content")}, &Doc{Key: []byte("k3"), Content: []byte("content")}); err != nil {
+		t.Fatal(err)
+	}
+	// truncate the last document, the first one copied is removed from output
+	_ = os.Truncate(bad, 17+12)
+
+	out := filepath.Join(root, "out.bin")
+	opt := &MergeOption{Inputs: []string{a, bad}, Output: out, SourceCompress: NONE, TargetCompress: NONE}
+	if _, err := Merge(opt); err == nil {
+		t.Fatalf("expect error for truncated input")
+	}
+	_ = os.Remove(out)
+	opt.SkipInvalid = true
+	res, err := Merge(opt)
+	if err != nil {
+		t.Fatalf("merge error: %v", err)
+	}
+	if res.Files != 1 || res.Invalid != 1 || res.Copied == 0 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if docs := readTestDocs(t, out, NONE); len(docs) != 1 {
+		t.Fatalf("expect 1 doc, got %d", len(docs))
+	}
+	_ = os.Remove(out)
+	opt.NewestWins = true
+	if res, err = Merge(opt); err != nil || res.Files != 1 || res.Invalid != 1 {
+		t.Fatalf("unexpected result: %+v, %v", res, err)
+	}
+	if docs := readTestDocs(t, out, NONE); len(docs) != 1 || string(docs[0].Key) != "k1" {
+		t.Fatalf("expect only k1, got %v", docs)
+	}
+}
+
+func TestMergeNewestWinsInFile(t *testing.T) {
+	root := getTestDir("merge_newest")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+
+	a := filepath.Join(root, "a.bin")
+	b := filepath.Join(root, "b.bin")
+	if err := writeTestDocs(a, NONE, &Doc{Key: []byte("k1"), Content: []byte("a1")}, &Doc{Key: []byte("k2"), Content: []byte("a2")}); err != nil {
+		t.Fatal(err)
+	}
+	// k2 is written twice in the newest file, the later one wins
+	if err := writeTestDocs(b, NONE,
+		&Doc{Key: []byte("k2"), Content: []byte("b2-old")},
+		&Doc{Key: []byte("k3"), Content: []byte("b3")},
+		&Doc{Key: []byte("k2"), Content: []byte("b2-new")},
+	); err != nil {
+		t.Fatal(err)
+	}
+	newer := time.Now().Add(time.Hour)
+	_ = os.Chtimes(b, newer, newer)
+
+	out := filepath.Join(root, "out.bin")
+	res, err := Merge(&MergeOption{Inputs: []string{a, b}, Output: out, SourceCompress: NONE, TargetCompress: NONE, NewestWins: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, doc := range readTestDocs(t, out, NONE) {
+		got = append(got, fmt.Sprintf("%s:%s", doc.Key, doc.Content))
+	}
+	if fmt.Sprint(got) != "[k3:b3 k2:b2-new k1:a1]" || res.Duplicates != 2 {
+		t.Errorf("unexpected merged docs %v, %+v", got, res)
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
-	"strings"
 
 	"github.com/skiloop/binfiles/workers"
 )
@@ -17,9 +16,15 @@ import (
 type PackageOption struct {
 	InputCompress int    `doc:"source file compression type package" default:"0"`
 	WorkerCount   int    `doc:"worker count" default:"0"`
-	Path          string `doc:"source path or tar file name"`
+	Path          string `doc:"source path, tar or zip file name"`
 	Pattern       string `doc:"file pattern,those match will be packaged. all files include if empty"`
 	TarCompress   string `doc:"tar file compression type package" default:"gzip"`
+	KeyStrategy   string `doc:"how keys are derived from files: base, relative, full, strip-ext, regex or hash" default:"base"`
+	KeyRegex      string `doc:"regex for regex key strategy, the first capture group is used as key"`
+	Attrs         bool   `doc:"keep mtime, mode, size and compression of files as document attributes" default:"false"`
+	Recursive     bool   `doc:"package files in sub directories too" default:"false"`
+
+	OnCollision func(c *KeyCollision) // called when two files result in the same key, warning is logged if nil
 }
 
 // Package files to bin file
@@ -43,27 +48,38 @@ func Package(option *PackageOption, bw BinWriter) (err error) {
 	if err != nil {
 		return err
 	}
+	root := ""
+	if stat.IsDir() {
+		root = option.Path
+	}
+	keys, err := newKeyDeriver(option, root)
+	if err != nil {
+		return err
+	}
 	defer func() {
+		keys.report()
 		LogInfo("%s packaging done\n", option.Path)
 	}()
 	if stat.IsDir() {
-		return packageDirectory(option, bw, ch, stopCh, pattern)
+		return packageDirectory(option, bw, ch, stopCh, pattern, keys)
+	} else if IsZipFile(option.Path) {
+		return packageZip(option, bw, ch, stopCh, pattern, keys)
 	} else {
-		return packageTar(option, bw, ch, stopCh, pattern)
+		return packageTar(option, bw, ch, stopCh, pattern, keys)
 	}
 }
 
-func packageTar(option *PackageOption, bw BinWriter, ch, stop chan any, pattern *regexp.Regexp) (err error) {
+func packageTar(option *PackageOption, bw BinWriter, ch, stop chan any, pattern *regexp.Regexp, keys *keyDeriver) (err error) {
 	LogDebug("package tar file\n")
 	workers.RunJobs(option.WorkerCount, stop, func(no int) {
 		packageWorker(ch, no, bw)
 	}, func() {
-		tarSeeder(option, ch, stop, pattern)
+		tarSeeder(option, ch, stop, pattern, keys)
 	})
 	LogInfo("package done\n")
 	return nil
 }
-func tarSeeder(option *PackageOption, ch, stop chan any, pattern *regexp.Regexp) {
+func tarSeeder(option *PackageOption, ch, stop chan any, pattern *regexp.Regexp, keys *keyDeriver) {
 	LogInfo("seeder from %s starts\n", option.Path)
 	in, err := os.Open(option.Path)
 	defer func() {
@@ -84,8 +100,7 @@ func tarSeeder(option *PackageOption, ch, stop chan any, pattern *regexp.Regexp)
 			LogDebug("skip directory %s\n", h.Name)
 			return nil
 		}
-		key := filepath.Base(h.Name)
-		if pattern != nil && !pattern.MatchString(key) {
+		if pattern != nil && !pattern.MatchString(filepath.Base(h.Name)) {
 			LogDebug("skip %s\n", h.Name)
 			return nil
 		}
@@ -95,8 +110,16 @@ func tarSeeder(option *PackageOption, ch, stop chan any, pattern *regexp.Regexp)
 			LogError("copy tar file error: %v\n", err)
 			return err
 		}
+		doc, err := keys.doc(h.Name, CloneBytes(buf.Bytes()))
+		if err != nil {
+			LogError("key of %s error: %v\n", h.Name, err)
+			return nil
+		}
+		if option.Attrs {
+			doc.Attrs = fileAttrs(h.ModTime, h.FileInfo().Mode(), h.Size, NONE)
+		}
 		select {
-		case ch <- &Doc{Key: []byte(key), Content: CloneBytes(buf.Bytes())}:
+		case ch <- doc:
 			return nil
 		case <-stop:
 			return errWorkersStopped
@@ -104,16 +127,17 @@ func tarSeeder(option *PackageOption, ch, stop chan any, pattern *regexp.Regexp)
 	})
 }
 
-func packageDirectory(option *PackageOption, bw BinWriter, ch, stop chan any, pattern *regexp.Regexp) (err error) {
+func packageDirectory(option *PackageOption, bw BinWriter, ch, stop chan any, pattern *regexp.Regexp, keys *keyDeriver) (err error) {
 	workers.RunJobs(option.WorkerCount, stop, func(no int) {
 		packageWorker(ch, no, bw)
 	}, func() {
-		searchFiles(option.Path, ch, stop, option.InputCompress, pattern)
+		searchFiles(option, ch, stop, pattern, keys)
 	})
 	return nil
 }
 
-func searchFiles(root string, ch, stop chan any, compress int, pattern *regexp.Regexp) {
+func searchFiles(option *PackageOption, ch, stop chan any, pattern *regexp.Regexp, keys *keyDeriver) {
+	root := option.Path
 	if Debug {
 		LogInfo("searching files in %s\n", root)
 	}
@@ -125,9 +149,8 @@ func searchFiles(root string, ch, stop chan any, compress int, pattern *regexp.R
 	defer GlobalMemoryPool.PutCompressorBuffer(buf)
 
 	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
-		if err != nil || d.IsDir() && path != root {
-			// root will not be dir if err is not nil
-			// stopCh processing dir if read dir error
+		if err != nil || d.IsDir() && path != root && !option.Recursive {
+			// stop processing dir if read dir error, sub directories are walked only if recursive
 			debug("skip processing dir %s: %v\n", path, err)
 			return fs.SkipDir
 		}
@@ -141,11 +164,16 @@ func searchFiles(root string, ch, stop chan any, compress int, pattern *regexp.R
 		}
 		// files are queue to processed
 		// and stopCh process
-		doc, err := readDoc(path, compress, buf)
+		doc, err := readDoc(path, option.InputCompress, buf, keys)
 		if err != nil {
 			LogError("read doc error: %v\n", err)
 			return nil
 		}
+		if option.Attrs {
+			if info, err := d.Info(); err == nil {
+				doc.Attrs = fileAttrs(info.ModTime(), info.Mode(), info.Size(), option.InputCompress)
+			}
+		}
 		select {
 		case ch <- doc:
 			return nil
@@ -169,6 +197,11 @@ func readContent(path string, compress int, buf *bytes.Buffer) ([]byte, error) {
 	defer func() {
 		_ = in.Close()
 	}()
+	return readAll(in, compress, buf)
+}
+
+// readAll reads and decompresses all data from reader
+func readAll(in io.Reader, compress int, buf *bytes.Buffer) ([]byte, error) {
 	reader, err := getDecompressor(compress, in)
 	if err != nil {
 		LogError("decompress reader error: %v\n", err)
@@ -188,16 +221,12 @@ func readContent(path string, compress int, buf *bytes.Buffer) ([]byte, error) {
 	return CloneBytes(buf.Bytes()), nil
 }
 
-func readDoc(path string, compress int, buf *bytes.Buffer) (*Doc, error) {
-	parts := strings.Split(path, "/")
+func readDoc(path string, compress int, buf *bytes.Buffer, keys *keyDeriver) (*Doc, error) {
 	content, err := readContent(path, compress, buf)
 	if nil == content {
 		return nil, err
 	}
-	doc := &Doc{}
-	doc.Key = []byte(parts[len(parts)-1])
-	doc.Content = content
-	return doc, nil
+	return keys.doc(path, content)
 }
 
 func packageWorker(ch chan any, no int, dw BinWriter) {
@@ -212,10 +241,13 @@ func packageWorker(ch chan any, no int, dw BinWriter) {
 			break
 		}
 
-		if _, err := dw.Write(doc.(*Doc)); err != nil {
+		n, err := dw.Write(doc.(*Doc))
+		if err != nil {
 			LogError("[%d] worker error: %v\n", no, err)
+			recordSkip()
 			break
 		}
+		addProgress(1, int64(n))
 		count += 1
 	}
 	LogInfo("worker %d done with %d docs\n", no, count)
@@ -0,0 +1,161 @@
+package binfile
+
+import (
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+)
+
+// PeekOption is the option for peeking documents by head, tail and sample
+type PeekOption struct {
+	Count      int   // number of documents
+	Seed       int64 // seed of random sampling, samples are the same with the same seed, random if 0
+	Decompress bool  // decompress content of documents
+}
+
+// Head the first live documents
+func Head(filename string, compressType int, opt *PeekOption) ([]Found, error) {
+	it, err := NewDocIterator(filename, compressType, &IterOption{End: -1, Decompress: opt.Decompress})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	var docs []Found
+	for len(docs) < opt.Count && it.Next() {
+		docs = append(docs, Found{Offset: it.Offset(), Doc: it.Doc()})
+	}
+	return docs, it.Err()
+}
+
+// tailDocSize bytes per document of the first window walked for the tail, the window is doubled until enough
+// documents are found
+const tailDocSize = 4096
+
+// Tail the last live documents in position order. Record headers are walked from a window before the end of file,
+// which is doubled until enough live documents are found or the file start is reached, so only the tail of large
+// files is read. Contents are read for documents returned.
+func Tail(filename string, compressType int, opt *PeekOption) ([]Found, error) {
+	if opt.Count <= 0 {
+		return nil, nil
+	}
+	deletes, err := LoadTombstones(filename)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	size := fileSize(file)
+	ring := make([]int64, 0, opt.Count)
+	next := 0
+	for window := int64(opt.Count) * tailDocSize; ; window *= 2 {
+		start := recordInWindow(file, window, size)
+		ring, next = ring[:0], 0
+		err = walkLiveRecords(file, start, size, deletes, func(offset int64) {
+			if len(ring) < opt.Count {
+				ring = append(ring, offset)
+				return
+			}
+			ring[next] = offset
+			next = (next + 1) % opt.Count
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(ring) == opt.Count || start == 0 {
+			break
+		}
+	}
+	// the oldest position is at next once the ring is full
+	offsets := make([]int64, 0, len(ring))
+	offsets = append(offsets, ring[next:]...)
+	offsets = append(offsets, ring[:next]...)
+	return readFound(filename, compressType, offsets, opt.Decompress)
+}
+
+// Sample live documents uniformly at random by reservoir sampling over record headers, documents are in position order.
+// Records are walked once for files without tombstones or with a tombstone index saved.
+func Sample(filename string, compressType int, opt *PeekOption) ([]Found, error) {
+	if opt.Count <= 0 {
+		return nil, nil
+	}
+	deletes, err := LoadTombstones(filename)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	seed := opt.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	reservoir := make([]int64, 0, opt.Count)
+	seen := int64(0)
+	err = walkLiveRecords(file, 0, fileSize(file), deletes, func(offset int64) {
+		seen += 1
+		if len(reservoir) < opt.Count {
+			reservoir = append(reservoir, offset)
+		} else if i := rnd.Int63n(seen); i < int64(opt.Count) {
+			reservoir[i] = offset
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(reservoir, func(i, j int) bool {
+		return reservoir[i] < reservoir[j]
+	})
+	return readFound(filename, compressType, reservoir, opt.Decompress)
+}
+
+// walkLiveRecords visits positions of live documents in [start, end) by walking record headers,
+// invalid records are skipped with a warning
+func walkLiveRecords(file *os.File, start, end int64, deletes Tombstones, visit func(offset int64)) error {
+	_, err := walkRecords(file, start, end, func(pos int64, key []byte, contentSize int32) error {
+		if contentSize != recordTombstone && !deletes.Deleted(key, pos) {
+			visit(pos)
+		}
+		return nil
+	}, func(from, to int64) {
+		LogWarn("skip invalid records of %s from %d to %d\n", file.Name(), from, to)
+	})
+	return err
+}
+
+// readFound reads documents at positions
+func readFound(filename string, compressType int, offsets []int64, decompress bool) ([]Found, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	size := fileSize(file)
+	docs := make([]Found, 0, len(offsets))
+	for _, offset := range offsets {
+		doc := &Doc{}
+		if _, err = readRecord(io.NewSectionReader(file, offset, size-offset), doc); err != nil {
+			return docs, &DocError{Offset: offset, Err: err}
+		}
+		if decompress {
+			if doc, err = DecompressDoc(doc, compressType, Verbose); err != nil {
+				return docs, &DocError{Offset: offset, Err: err}
+			}
+		}
+		docs = append(docs, Found{Offset: offset, Doc: doc})
+	}
+	return docs, nil
+}
@@ -0,0 +1,103 @@
+package binfile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPeek(t *testing.T) {
+	root := getTestDir("peek")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+	docs := make([]*Doc, 50)
+	for i := range docs {
+		docs[i] = &Doc{Key: []byte(fmt.Sprintf("key-%02d", i)), Content: []byte(fmt.Sprintf("%d", i))}
+	}
+	if err := writeTestDocs(filename, GZIP, docs...); err != nil {
+		t.Fatal(err)
+	}
+	bw := NewBinWriter(filename, GZIP)
+	if err := bw.Open(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = bw.Delete([]byte("key-48"))
+	_, _ = bw.Delete([]byte("key-01"))
+	_ = bw.Close()
+
+	keys := func(found []Found) string {
+		s := ""
+		for _, f := range found {
+			s += string(f.Doc.Content) + " "
+		}
+		return s
+	}
+	head, err := Head(filename, GZIP, &PeekOption{Count: 3, Decompress: true})
+	if err != nil || keys(head) != "0 2 3 " {
+		t.Errorf("unexpected head %s, %v", keys(head), err)
+	}
+	tail, err := Tail(filename, GZIP, &PeekOption{Count: 3, Decompress: true})
+	if err != nil || keys(tail) != "46 47 49 " {
+		t.Errorf("unexpected tail %s, %v", keys(tail), err)
+	}
+	if all, err := Tail(filename, GZIP, &PeekOption{Count: 100}); err != nil || len(all) != 48 || all[0].Offset != 0 {
+		t.Errorf("expect all 48 live docs, got %d, %v", len(all), err)
+	}
+
+	sample, err := Sample(filename, GZIP, &PeekOption{Count: 10, Seed: 42, Decompress: true})
+	if err != nil || len(sample) != 10 {
+		t.Fatalf("expect 10 samples, got %d, %v", len(sample), err)
+	}
+	again, _ := Sample(filename, GZIP, &PeekOption{Count: 10, Seed: 42, Decompress: true})
+	if keys(sample) != keys(again) {
+		t.Errorf("samples differ with the same seed: %s and %s", keys(sample), keys(again))
+	}
+	for i, f := range sample {
+		if i > 0 && f.Offset <= sample[i-1].Offset || string(f.Doc.Content) == "1" || string(f.Doc.Content) == "48" {
+			t.Errorf("unexpected samples %s", keys(sample))
+			break
+		}
+	}
+}
+
+func TestPeekInvalidRecords(t *testing.T) {
+	root := getTestDir("peek-invalid")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+	write := func(from, to int) {
+		docs := make([]*Doc, 0, to-from)
+		for i := from; i < to; i++ {
+			docs = append(docs, &Doc{Key: []byte(fmt.Sprintf("key-%04d", i)), Content: []byte(fmt.Sprintf("%d %0100d", i, i))})
+		}
+		if err := writeTestDocs(filename, NONE, docs...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// invalid bytes before the last documents, far from the start
+	write(0, 1000)
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = file.Write([]byte{0xff, 0xff, 0xff, 0x7f, 'x', 'y', 'z'})
+	_ = file.Close()
+	write(1000, 1010)
+
+	tail, err := Tail(filename, NONE, &PeekOption{Count: 3})
+	if err != nil || len(tail) != 3 || !bytes.HasPrefix(tail[0].Doc.Content, []byte("1007 ")) {
+		t.Fatalf("unexpected tail %v, %v", tail, err)
+	}
+	// window grows over the invalid bytes
+	tail, err = Tail(filename, NONE, &PeekOption{Count: 500})
+	if err != nil || len(tail) != 500 || !bytes.HasPrefix(tail[0].Doc.Content, []byte("510 ")) {
+		t.Fatalf("expect 500 docs from 510, got %d, %v", len(tail), err)
+	}
+	sample, err := Sample(filename, NONE, &PeekOption{Count: 1010, Seed: 1})
+	if err != nil || len(sample) != 1010 {
+		t.Errorf("expect all 1010 docs sampled, got %d, %v", len(sample), err)
+	}
+}
@@ -0,0 +1,163 @@
+package binfile
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Progress tracks documents and bytes processed by a long operation.
+// Readers and writers feed the active progress, if any, so callers only need to
+// start a progress before the operation and watch it.
+type Progress struct {
+	Name  string
+	total atomic.Int64
+	docs  atomic.Int64
+	bytes atomic.Int64
+	start time.Time
+}
+
+// ProgressStat is a snapshot of progress
+type ProgressStat struct {
+	Name        string
+	Docs        int64
+	Bytes       int64
+	Total       int64 // total bytes, 0 if unknown
+	Elapsed     time.Duration
+	DocsPerSec  float64
+	BytesPerSec float64
+	ETA         time.Duration // -1 if unknown
+}
+
+var activeProgress atomic.Pointer[Progress]
+
+// StartProgress create a progress and make it active
+func StartProgress(name string, total int64) *Progress {
+	p := &Progress{Name: name, start: time.Now()}
+	p.total.Store(total)
+	activeProgress.Store(p)
+	return p
+}
+
+// Finish deactivate the progress
+func (p *Progress) Finish() {
+	activeProgress.CompareAndSwap(p, nil)
+}
+
+// Add processed documents and bytes
+func (p *Progress) Add(docs, bytes int64) {
+	p.docs.Add(docs)
+	p.bytes.Add(bytes)
+}
+
+// AddTotal add bytes to be processed
+func (p *Progress) AddTotal(bytes int64) {
+	p.total.Add(bytes)
+}
+
+// Stat take a snapshot
+func (p *Progress) Stat() ProgressStat {
+	s := ProgressStat{
+		Name:    p.Name,
+		Docs:    p.docs.Load(),
+		Bytes:   p.bytes.Load(),
+		Total:   p.total.Load(),
+		Elapsed: time.Since(p.start),
+		ETA:     -1,
+	}
+	if secs := s.Elapsed.Seconds(); secs > 0 {
+		s.DocsPerSec = float64(s.Docs) / secs
+		s.BytesPerSec = float64(s.Bytes) / secs
+	}
+	if s.Total > 0 && s.BytesPerSec > 0 {
+		remain := s.Total - s.Bytes
+		if remain < 0 {
+			remain = 0
+		}
+		s.ETA = time.Duration(float64(remain) / s.BytesPerSec * float64(time.Second))
+	}
+	return s
+}
+
+func (s ProgressStat) String() string {
+	line := s.Name + " "
+	if s.Total > 0 {
+		line += fmt.Sprintf("%5.1f%% %s/%s", float64(s.Bytes)*100/float64(s.Total), formatBytes(s.Bytes), formatBytes(s.Total))
+	} else {
+		line += formatBytes(s.Bytes)
+	}
+	line += fmt.Sprintf(" %d docs %.0f docs/s %s/s", s.Docs, s.DocsPerSec, formatBytes(int64(s.BytesPerSec)))
+	if s.ETA >= 0 {
+		line += " ETA " + s.ETA.Round(time.Second).String()
+	} else {
+		line += " elapsed " + s.Elapsed.Round(time.Second).String()
+	}
+	return line
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// addProgress feed the active progress
+func addProgress(docs, bytes int64) {
+	if p := activeProgress.Load(); p != nil {
+		p.Add(docs, bytes)
+	}
+}
+
+// addProgressTotal add bytes to be processed to the active progress
+func addProgressTotal(bytes int64) {
+	if p := activeProgress.Load(); p != nil {
+		p.AddTotal(bytes)
+	}
+}
+
+// WatchProgress prints progress every interval until stop is called.
+// When live is true the progress is rendered as a single line updated in place,
+// which is suitable for terminals, otherwise a log line is written for each interval.
+func WatchProgress(p *Progress, w io.Writer, interval time.Duration, live bool) (stop func()) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	done := make(chan struct{})
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if live {
+					_, _ = fmt.Fprintf(w, "\r%s\x1b[K", p.Stat())
+				} else {
+					_, _ = fmt.Fprintf(w, "%s\n", p.Stat())
+				}
+			case <-done:
+				if live {
+					_, _ = fmt.Fprintf(w, "\r%s\x1b[K\n", p.Stat())
+				} else {
+					_, _ = fmt.Fprintf(w, "%s\n", p.Stat())
+				}
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,52 @@
+package binfile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	p := StartProgress("test", 1000)
+	defer p.Finish()
+	addProgress(2, 250)
+	addProgressTotal(1000)
+	p.start = p.start.Add(-time.Second)
+	s := p.Stat()
+	if s.Docs != 2 || s.Bytes != 250 || s.Total != 2000 {
+		t.Fatalf("unexpected stat: %+v", s)
+	}
+	if s.ETA < 6*time.Second || s.ETA > 8*time.Second {
+		t.Fatalf("unexpected eta: %v", s.ETA)
+	}
+	if line := s.String(); !strings.Contains(line, "12.5%") || !strings.Contains(line, "ETA") {
+		t.Fatalf("unexpected line: %s", line)
+	}
+	p.Finish()
+	addProgress(1, 1)
+	if p.Stat().Docs != 2 {
+		t.Fatalf("finished progress should not be fed")
+	}
+}
+
+func TestWatchProgress(t *testing.T) {
+	p := StartProgress("watch", 0)
+	defer p.Finish()
+	buf := &bytes.Buffer{}
+	stop := WatchProgress(p, buf, time.Hour, true)
+	p.Add(1, 2048)
+	stop()
+	if line := buf.String(); !strings.HasPrefix(line, "\rwatch 2.0KB 1 docs") || !strings.HasSuffix(line, "\n") {
+		t.Fatalf("unexpected output: %q", line)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	cases := map[int64]string{0: "0B", 1023: "1023B", 1024: "1.0KB", 1536 * 1024: "1.5MB", 3 << 30: "3.0GB"}
+	for n, expected := range cases {
+		if got := formatBytes(n); got != expected {
+			t.Errorf("formatBytes(%d): expect %s, got %s", n, expected, got)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package binfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrQuerySyntax = errors.New("invalid query")
+
+// Query filters JSON documents by path expressions such as `.status == 200`, `.lang in ["en","de"]`
+// or `.user.tags[0]`. Conditions are joined by `and` (`&&`) and `or` (`||`), `and` binds tighter.
+// Operators are ==, !=, <, <=, >, >= and in, values are JSON literals. A path without operator matches
+// if the value exists and is neither null nor false. Missing values only match !=.
+type Query struct {
+	expr   string
+	groups [][]*condition // conditions of a group are and-ed, groups are or-ed
+}
+
+type condition struct {
+	path  []pathStep
+	op    string
+	value interface{}
+}
+
+type pathStep struct {
+	name  string
+	index int // index of array if name is empty
+}
+
+// ParseQuery parses query expression
+func ParseQuery(expr string) (*Query, error) {
+	p := &queryParser{s: expr}
+	q := &Query{expr: expr, groups: [][]*condition{nil}}
+	for {
+		c, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+		last := len(q.groups) - 1
+		q.groups[last] = append(q.groups[last], c)
+		p.skipSpace()
+		if p.end() {
+			return q, nil
+		}
+		switch {
+		case p.consume("and") || p.consume("&&"):
+		case p.consume("or") || p.consume("||"):
+			q.groups = append(q.groups, nil)
+		default:
+			return nil, p.errorf("and or or expected")
+		}
+	}
+}
+
+// String the query expression
+func (q *Query) String() string {
+	return q.expr
+}
+
+// Match checks whether JSON content matches the query, invalid JSON never matches
+func (q *Query) Match(content []byte) bool {
+	var v interface{}
+	if err := json.Unmarshal(content, &v); err != nil {
+		return false
+	}
+	return q.matchValue(v)
+}
+
+// MatchDoc checks whether decompressed content of document matches the query, it works as IterOption.Filter
+func (q *Query) MatchDoc(doc *Doc) bool {
+	return q.Match(doc.Content)
+}
+
+func (q *Query) matchValue(v interface{}) bool {
+	for _, group := range q.groups {
+		matched := true
+		for _, c := range group {
+			if !c.match(v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *condition) match(root interface{}) bool {
+	v, ok := lookupPath(root, c.path)
+	switch c.op {
+	case "":
+		return ok && v != nil && v != false
+	case "==":
+		return ok && reflect.DeepEqual(v, c.value)
+	case "!=":
+		return !ok || !reflect.DeepEqual(v, c.value)
+	case "in":
+		if ok {
+			for _, item := range c.value.([]interface{}) {
+				if reflect.DeepEqual(v, item) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if !ok {
+		return false
+	}
+	cmp, ok := compareValues(v, c.value)
+	if !ok {
+		return false
+	}
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+// compareValues compares numbers or strings, false if types differ
+func compareValues(a, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	}
+	return 0, false
+}
+
+func lookupPath(v interface{}, path []pathStep) (interface{}, bool) {
+	for _, step := range path {
+		if step.name != "" {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = obj[step.name]; !ok {
+				return nil, false
+			}
+			continue
+		}
+		arr, ok := v.([]interface{})
+		if !ok || step.index >= len(arr) {
+			return nil, false
+		}
+		v = arr[step.index]
+	}
+	return v, true
+}
+
+type queryParser struct {
+	s   string
+	pos int
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w at %d of %q: %s", ErrQuerySyntax, p.pos, p.s, fmt.Sprintf(format, args...))
+}
+
+func (p *queryParser) end() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *queryParser) skipSpace() {
+	for !p.end() && strings.ContainsRune(" \t\r\n", rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *queryParser) consume(token string) bool {
+	if strings.HasPrefix(p.s[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) condition() (*condition, error) {
+	p.skipSpace()
+	path, err := p.path()
+	if err != nil {
+		return nil, err
+	}
+	c := &condition{path: path}
+	p.skipSpace()
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if op == "in" && !strings.HasPrefix(p.s[p.pos:], "in ") && !strings.HasPrefix(p.s[p.pos:], "in[") {
+			continue
+		}
+		if p.consume(op) {
+			c.op = op
+			break
+		}
+	}
+	if c.op == "" {
+		return c, nil
+	}
+	p.skipSpace()
+	dec := json.NewDecoder(strings.NewReader(p.s[p.pos:]))
+	if err = dec.Decode(&c.value); err != nil {
+		return nil, p.errorf("invalid value: %v", err)
+	}
+	p.pos += int(dec.InputOffset())
+	if _, ok := c.value.([]interface{}); c.op == "in" && !ok {
+		return nil, p.errorf("array expected after in")
+	}
+	return c, nil
+}
+
+// path parses path like .a.b[0], . is the root
+func (p *queryParser) path() ([]pathStep, error) {
+	if !p.consume(".") {
+		return nil, p.errorf("path expected")
+	}
+	var path []pathStep
+	name := true
+	for !p.end() {
+		switch ch := p.s[p.pos]; {
+		case ch == '[':
+			end := strings.IndexByte(p.s[p.pos:], ']')
+			if end < 0 {
+				return nil, p.errorf("] expected")
+			}
+			index, err := strconv.Atoi(p.s[p.pos+1 : p.pos+end])
+			if err != nil || index < 0 {
+				return nil, p.errorf("invalid index")
+			}
+			path = append(path, pathStep{index: index})
+			p.pos += end + 1
+			name = false
+		case ch == '.':
+			p.pos++
+			name = true
+		case strings.IndexByte(" \t\r\n=!<>", ch) >= 0:
+			return path, nil
+		default:
+			if !name {
+				return nil, p.errorf(". expected")
+			}
+			start := p.pos
+			for !p.end() && strings.IndexByte(" \t\r\n=!<>.[", p.s[p.pos]) < 0 {
+				p.pos++
+			}
+			path = append(path, pathStep{name: p.s[start:p.pos]})
+			name = false
+		}
+	}
+	return path, nil
+}
+
+// Projection selects fields of JSON documents into a new object, fields are named by their paths without the leading dot
+type Projection struct {
+	names []string
+	paths [][]pathStep
+}
+
+// ParseProjection parses paths of fields
+func ParseProjection(fields []string) (*Projection, error) {
+	proj := &Projection{}
+	for _, field := range fields {
+		p := &queryParser{s: field}
+		path, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		if p.skipSpace(); !p.end() {
+			return nil, p.errorf("end of path expected")
+		}
+		proj.names = append(proj.names, strings.TrimPrefix(field, "."))
+		proj.paths = append(proj.paths, path)
+	}
+	return proj, nil
+}
+
+// Project JSON content to an object of selected fields in order, missing fields are omitted
+func (proj *Projection) Project(content []byte) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(content, &v); err != nil {
+		return nil, err
+	}
+	return proj.projectValue(v)
+}
+
+func (proj *Projection) projectValue(v interface{}) ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, path := range proj.paths {
+		value, ok := lookupPath(v, path)
+		if !ok {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(proj.names[i])
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(data)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// QueryOption is the option for querying JSON documents
+type QueryOption struct {
+	Filter      string   // query expression, all JSON documents match if empty
+	Fields      []string // paths of fields projected, whole content if empty
+	Offset      int64    // start position
+	Limit       int64    // max number of matches, 0 for unlimited
+	SkipError   bool     // seek for next valid document when an invalid one is found
+	WorkerCount int      // number of workers querying different ranges of the file
+}
+
+// QueryDocs streams JSON documents matching the filter to handler and returns the number of matches.
+// Content of matches is projected to selected fields. Documents not in JSON are skipped.
+// Ranges of the file are queried in parallel, handler is never called concurrently and may be nil to count matches only.
+func QueryDocs(filename string, compressType int, opt *QueryOption, handler func(m *Match) error) (int64, error) {
+	var q *Query
+	var err error
+	if opt.Filter != "" {
+		if q, err = ParseQuery(opt.Filter); err != nil {
+			return 0, err
+		}
+	}
+	var proj *Projection
+	if len(opt.Fields) > 0 {
+		if proj, err = ParseProjection(opt.Fields); err != nil {
+			return 0, err
+		}
+	}
+	var mu sync.Mutex
+	var count int64
+	var stop atomic.Bool
+	err = scanRanges(filename, compressType, &scanOption{offset: opt.Offset, workerCount: opt.WorkerCount, skipError: opt.SkipError, stop: &stop},
+		func(raw *Doc, offset int64) error {
+			doc, err := DecompressDoc(raw, compressType, Verbose)
+			if err != nil {
+				if opt.SkipError {
+					LogError("skip document %s at %d: %v\n", raw.Key, offset, err)
+					return nil
+				}
+				return &DocError{Offset: offset, Err: err}
+			}
+			var v interface{}
+			if err = json.Unmarshal(doc.Content, &v); err != nil {
+				LogDebug("skip document %s at %d not in json: %v\n", doc.Key, offset, err)
+				return nil
+			}
+			if q != nil && !q.matchValue(v) {
+				return nil
+			}
+			if proj != nil {
+				if doc.Content, err = proj.projectValue(v); err != nil {
+					return &DocError{Offset: offset, Err: err}
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if stop.Load() {
+				return nil
+			}
+			count += 1
+			if opt.Limit > 0 && count >= opt.Limit {
+				stop.Store(true)
+			}
+			if handler == nil {
+				return nil
+			}
+			return handler(&Match{Offset: offset, Key: doc.Key, Doc: doc})
+		})
+	return count, err
+}
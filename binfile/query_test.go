@@ -0,0 +1,124 @@
+package binfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQueryMatch(t *testing.T) {
+	content := []byte(`{"status":200,"lang":"en","user":{"name":"amy","tags":["a","b"]},"ok":false,"n":null}`)
+	cases := []struct {
+		expr     string
+		expected bool
+	}{
+		{`.status == 200`, true},
+		{`.status != 200`, false},
+		{`.status>=200&&.status<300`, true},
+		{`.lang in ["en","de"]`, true},
+		{`.lang in ["fr"]`, false},
+		{`.user.name == "amy"`, true},
+		{`.user.tags[1] == "b"`, true},
+		{`.user.tags[2]`, false},
+		{`.user.tags`, true},
+		{`.ok`, false},
+		{`.n`, false},
+		{`.missing != 1`, true},
+		{`.missing == null`, false},
+		{`.lang > "de" and .status < 100 or .user.name`, true},
+		{`.lang == "de" or .status == 404`, false},
+		{`. == 1`, false},
+	}
+	for _, c := range cases {
+		q, err := ParseQuery(c.expr)
+		if err != nil {
+			t.Errorf("parse %s error: %v", c.expr, err)
+			continue
+		}
+		if q.Match(content) != c.expected {
+			t.Errorf("%s: expect %v", c.expr, c.expected)
+		}
+	}
+	for _, expr := range []string{``, `status == 1`, `.a ==`, `.a in 1`, `.a == 1 .b`, `.a[x]`} {
+		if _, err := ParseQuery(expr); !errors.Is(err, ErrQuerySyntax) {
+			t.Errorf("%s: expect syntax error, got %v", expr, err)
+		}
+	}
+
+	proj, err := ParseProjection([]string{".user.name", ".missing", ".status", ".user.tags[0]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := proj.Project(content)
+	if expected := `{"user.name":"amy","status":200,"user.tags[0]":"a"}`; err != nil || string(data) != expected {
+		t.Errorf("expect %s, got %s, %v", expected, data, err)
+	}
+}
+
+func TestQueryDocs(t *testing.T) {
+	root := getTestDir("query")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+	docs := []*Doc{{Key: []byte("text"), Content: []byte("not json")}}
+	for i := 0; i < 100; i++ {
+		docs = append(docs, &Doc{Key: []byte(fmt.Sprintf("doc-%02d", i)), Content: []byte(fmt.Sprintf(`{"n":%d,"even":%v}`, i, i%2 == 0))})
+	}
+	if err := writeTestDocs(filename, GZIP, docs...); err != nil {
+		t.Fatal(err)
+	}
+	var matches []*Match
+	count, err := QueryDocs(filename, GZIP, &QueryOption{Filter: ".n >= 90 and .even", Fields: []string{".n"}, WorkerCount: 3}, func(m *Match) error {
+		matches = append(matches, m)
+		return nil
+	})
+	if err != nil || count != 5 || len(matches) != 5 {
+		t.Fatalf("expect 5 matches, got %d, %d, %v", count, len(matches), err)
+	}
+	for _, m := range matches {
+		var n int
+		if _, err = fmt.Sscanf(string(m.Doc.Content), `{"n":%d}`, &n); err != nil || fmt.Sprintf("doc-%02d", n) != string(m.Key) {
+			t.Errorf("unexpected match %s %s", m.Key, m.Doc.Content)
+		}
+	}
+	if count, err = QueryDocs(filename, GZIP, &QueryOption{WorkerCount: 2}, nil); err != nil || count != 100 {
+		t.Errorf("expect 100 json documents, got %d, %v", count, err)
+	}
+
+	// query works as filter of iterator
+	q, _ := ParseQuery(".n < 3")
+	it, err := NewDocIterator(filename, GZIP, &IterOption{End: -1, Decompress: true, Filter: q.MatchDoc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var keys []string
+	for it.Next() {
+		keys = append(keys, string(it.Doc().Key))
+	}
+	if fmt.Sprint(keys) != "[doc-00 doc-01 doc-02]" || it.Err() != nil {
+		t.Errorf("unexpected filtered keys %v, %v", keys, it.Err())
+	}
+}
+
+func TestQueryDocsSkipDecompressError(t *testing.T) {
+	root := getTestDir("query-skip")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+	// the second record is valid with content not in gzip
+	for _, ct := range []int{GZIP, NONE, GZIP} {
+		if err := writeTestDocs(filename, ct, &Doc{Key: []byte(fmt.Sprintf("k%d", ct)), Content: []byte(`{"a":1}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := QueryDocs(filename, GZIP, &QueryOption{}, nil); err == nil {
+		t.Error("expect error of document not decompressed")
+	}
+	count, err := QueryDocs(filename, GZIP, &QueryOption{SkipError: true}, nil)
+	if err != nil || count != 2 {
+		t.Errorf("expect 2 docs with decompress error skipped, got %d, %v", count, err)
+	}
+}
@@ -1,6 +1,7 @@
 package binfile
 
 import (
+	"errors"
 	"regexp"
 	"sync/atomic"
 )
@@ -9,7 +10,9 @@ type RepackCmd struct {
 	Source              string `arg:"" help:"source bin file name or directory"`
 	Target              string `arg:"" help:"target bin file name or directory"`
 	Workers             int    `short:"w" help:"number of workers" default:"3"`
-	Split               int    `help:"max number of package, no limit if 0" default:"0"`
+	Split               int    `help:"max number of docs in each target file named target.N, no split if 0" default:"0"`
+	SplitSize           int64  `help:"max bytes of each target file named target.N, no split if 0" default:"0"`
+	Shards              int    `help:"split into N target files named target.N by key hash, no split if 0" default:"0"`
 	Limit               int    `help:"max number of docs, no limit if 0" default:"0"`
 	Pattern             string `short:"p" help:"file name pattern for path mode"`
 	ContentOnly         bool   `short:"o" help:"write content only, target compress type will have no effect" default:"false"`
@@ -22,8 +25,28 @@ type RepackCmd struct {
 
 const workerEndFlag = ""
 
+var ErrRepackSplit = errors.New("split, split-size and shards work on a single source file without limit, pattern or content only")
+
 // Repack bin file
 func Repack(opt RepackCmd) error {
+	if opt.Split > 0 || opt.SplitSize > 0 || opt.Shards > 0 {
+		if opt.Mode == "path" || opt.Limit > 0 || opt.ContentOnly || opt.Pattern != "" {
+			return ErrRepackSplit
+		}
+		files, err := Split(&SplitOption{
+			Input:           opt.Source,
+			Target:          opt.Target,
+			SourceCompress:  CompressTypes[opt.SourceCompressType],
+			TargetCompress:  CompressTypes[opt.TargetCompressType],
+			PackageCompress: CompressTypes[opt.PackageCompressType],
+			Size:            opt.SplitSize,
+			Count:           int64(opt.Split),
+			Shards:          opt.Shards,
+			WorkerCount:     opt.Workers,
+		})
+		LogInfo("repack into %d files\n", len(files))
+		return err
+	}
 	// repack with multiple workers to read docs from different files
 	if opt.Mode == "file" {
 		r := fileRepack{
@@ -36,12 +59,11 @@ func Repack(opt RepackCmd) error {
 			pt:         CompressTypes[opt.PackageCompressType],
 			tt:         CompressTypes[opt.TargetCompressType],
 			st:         CompressTypes[opt.SourceCompressType],
-			split:      opt.Split,
 			idx:        atomic.Int32{},
 		}
 		// no decompress and compression when input and outWriter are the same
 		if r.st == r.tt {
-			r.tt = NONE
+			r.keep = true
 			r.st = NONE
 		}
 		return r.start(opt.Source, opt.Workers, opt.Optimized)
@@ -56,12 +78,11 @@ func Repack(opt RepackCmd) error {
 			pt:          CompressTypes[opt.PackageCompressType],
 			tt:          CompressTypes[opt.TargetCompressType],
 			st:          CompressTypes[opt.SourceCompressType],
-			split:       opt.Split,
 			pos:         atomic.Int64{},
 		}
 		// no decompress and compression when input and outWriter are the same
 		if r.st == r.tt {
-			r.tt = NONE
+			r.keep = true
 			r.st = NONE
 		}
 		return r.start(opt.Workers, opt.Optimized)
@@ -19,7 +19,7 @@ type docRepack struct {
 	pt          int
 	tt          int
 	st          int
-	split       int
+	keep        bool // documents are written as read, source and target compression are the same
 	fileSize    int64
 	pos         atomic.Int64
 	step        int64
@@ -43,6 +43,7 @@ func (r *docRepack) worker(no int) {
 	count := 0
 	var doc *Doc
 	_ = reader.resetOffset(offset)
+	last := offset
 	running := true
 	print_doc := true
 	for running {
@@ -63,6 +64,9 @@ func (r *docRepack) worker(no int) {
 			LogDebug("[%d]worker reached end %d at %d\n", no, end, offset)
 			break
 		}
+		pos, _ := reader.docSeeker.Seek(0, io.SeekCurrent)
+		addProgress(1, pos-last)
+		last = pos
 		// Safely send to the channel
 		select {
 		case r.docCh <- doc:
@@ -98,6 +102,9 @@ func (r *docRepack) createWriter(optimized bool) (DocWriterCloser, error) {
 	if err != nil {
 		return nil, err
 	}
+	if r.keep {
+		writeCompressed(bw)
+	}
 	if err := bw.Open(); err != nil {
 		return nil, err
 	}
@@ -134,6 +141,7 @@ func (r *docRepack) merge(optimized bool) {
 		_, err = bw.Write(doc)
 		if err != nil {
 			LogError("fail to write %s: %v\n", doc.Key, err)
+			recordSkip()
 			continue
 		}
 		count += 1
@@ -156,6 +164,7 @@ func (r *docRepack) start(workerCount int, optimized bool) (err error) {
 		return err
 	}
 	r.step = int64(math.Ceil(float64(r.fileSize) / float64(workerCount)))
+	addProgressTotal(r.fileSize)
 	// create channel with larger buffer
 	r.docCh = make(chan *Doc, workerCount*2)
 	r.stopCh = make(chan interface{}, 1) // 增加容量避免阻塞
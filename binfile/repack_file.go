@@ -20,7 +20,7 @@ type fileRepack struct {
 	pt         int
 	tt         int
 	st         int
-	split      int
+	keep       bool // documents are written as read, source and target compression are the same
 	idx        atomic.Int32
 }
 
@@ -28,13 +28,16 @@ func (r *fileRepack) nextBinWriter(optimized bool) BinWriter {
 	no := r.idx.Add(1)
 	filename := fmt.Sprintf("%s.%d", r.target, no)
 	writer := NewBinWriter(filename, r.tt)
-	if optimized {
-		return writer
+	if !optimized {
+		writer = &oldBinWriter{
+			binWriter:     writer.(*binWriter),
+			oldCompressor: oldCompressor{},
+		}
 	}
-	return &oldBinWriter{
-		binWriter:     writer.(*binWriter),
-		oldCompressor: oldCompressor{},
+	if r.keep {
+		writeCompressed(writer)
 	}
+	return writer
 }
 
 func (r *fileRepack) seeder() {
@@ -58,6 +61,8 @@ func (r *fileRepack) seeder() {
 		if doc == nil {
 			break
 		}
+		pos, _ := r.reader.Seek(0, io.SeekCurrent)
+		addProgress(1, pos-offset)
 
 		// 确保数据不丢失：要么发送成功，要么收到停止信号
 		select {
@@ -135,8 +140,6 @@ func (r *fileRepack) worker(no int, optimized bool) {
 	if err != nil {
 		return
 	}
-	init := 100 * no
-	count := int64(init)
 	docs := 0
 	for {
 		doc := <-r.docCh
@@ -151,28 +154,13 @@ func (r *fileRepack) worker(no int, optimized bool) {
 		_, err = rp.Write(doc)
 		if err != nil {
 			LogError("[%d]write error: %s, %v\n", no, doc.Key, err)
+			recordSkip()
 			continue
 		}
 		docs += 1
-		count += 1
-
-		if r.split > 0 && count%int64(r.split) == 0 {
-			LogInfo("[%d] %s done with %d docs\n", no, rp.Filename(), docs)
-			_ = rp.Close()
-			r.filenameCh <- rp.Filename()
-			rp = r.nextBinWriter(optimized)
-			err = rp.Open()
-			if err != nil {
-				LogError("[%d]failed to get next packager: %v\n", no, err)
-				break
-			}
-			docs = 0
-		}
 	}
-	count -= int64(init)
 	LogInfo("[%d] %s done with %d docs\n", no, rp.Filename(), docs)
 	_ = rp.Close()
-	LogInfo("[%d]fileWorker done with %d docs\n", no, count)
 }
 
 func (r *fileRepack) start(source string, workerCount int, optimized bool) error {
@@ -182,6 +170,7 @@ func (r *fileRepack) start(source string, workerCount int, optimized bool) error
 		return err
 	}
 	r.reader = NewSeeker(fn, r.st)
+	addProgressTotal(fileSize(fn))
 	defer func(r io.Closer) {
 		_ = r.Close()
 	}(r.reader)
@@ -2,6 +2,7 @@ package binfile
 
 import (
 	"io"
+	"os"
 	"path"
 	"path/filepath"
 	"regexp"
@@ -20,8 +21,28 @@ type pathRepack struct {
 	st      int
 }
 
+// seeder sends bin files directly in source path to workers, sub directories are not walked
+// so the target is skipped even if it is inside source path
 func (p *pathRepack) seeder() {
-	searchFiles(p.src, p.fnCh, p.stopCh, p.st, p.pattern)
+	defer func() {
+		p.fnCh <- nil
+	}()
+	entries, err := os.ReadDir(p.src)
+	if err != nil {
+		LogError("read dir %s error: %v\n", p.src, err)
+		return
+	}
+	for _, entry := range entries {
+		filename := filepath.Join(p.src, entry.Name())
+		if !entry.Type().IsRegular() || p.pattern != nil && !p.pattern.MatchString(filename) {
+			continue
+		}
+		select {
+		case p.fnCh <- filename:
+		case <-p.stopCh:
+			return
+		}
+	}
 }
 
 func (p *pathRepack) worker(no int) {
@@ -66,6 +87,8 @@ func (p *pathRepack) pack(filename string) (err error) {
 	}
 	defer rd.Close()
 	br, _ := rd.(*binReader)
+	addProgressTotal(fileSize(br.file))
+	last := int64(0)
 	var doc *Doc
 	count := uint32(0)
 	skip := uint32(0)
@@ -81,9 +104,13 @@ func (p *pathRepack) pack(filename string) (err error) {
 		if doc == nil {
 			continue
 		}
+		pos, _ := br.docSeeker.Seek(0, io.SeekCurrent)
+		addProgress(1, pos-last)
+		last = pos
 		if _, err = bw.Write(doc); err != nil {
 			debug("write doc %s error: %v\n", doc.Key, err)
 			skip += 1
+			recordSkip()
 			continue
 		}
 		count += 1
@@ -0,0 +1,339 @@
+package binfile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrRollingPattern = errors.New("pattern of rolling files requires {seq} or {time}")
+
+// placeholders of rolling file patterns
+const (
+	RollingSeq  = "{seq}"  // sequence number of segment, starting from 1
+	RollingTime = "{time}" // time segment opened in RollingOption.TimeLayout
+)
+
+const defaultRollingTimeLayout = "20060102-150405"
+
+// RollingOption is the option for rolling writers
+type RollingOption struct {
+	Pattern         string        // filename pattern of segments with {seq} or {time}, like data-{time}-{seq}.bin
+	TimeLayout      string        // layout of {time}, 20060102-150405 if empty
+	CompressType    int           // document compression type
+	PackageCompress int           // package compression type of completed segments compressed in background, NONE to keep them as written
+	MaxSize         int64         // segment is completed once it reaches this many bytes, unlimited if 0
+	MaxCount        int64         // segment is completed once it has this many records, unlimited if 0
+	MaxAge          time.Duration // segment is completed this long after opened, even if no more documents come, unlimited if 0
+	Manifest        string        // json lines file listing completed segments, no manifest if empty
+}
+
+// Segment a file completed by a rolling writer
+type Segment struct {
+	Filename string    `json:"filename"` // with the package suffix if package compressed
+	Records  int64     `json:"records"`  // number of documents and tombstones
+	Size     int64     `json:"size"`     // bytes of records before package compression
+	Opened   time.Time `json:"opened"`
+	Closed   time.Time `json:"closed"`
+}
+
+// RollingBinWriter writes documents into a series of segments, rotating to a new segment when size, record count or
+// age limit of the current one is reached. Segments are opened on the first write after rotation so idle periods
+// leave no empty files, and files existing are never overwritten. Completed segments are package compressed in
+// background unless PackageCompress is NONE, then listed in the manifest.
+type RollingBinWriter struct {
+	opt      RollingOption
+	mu       sync.Mutex
+	opened   bool
+	seq      int
+	current  *binWriter
+	segment  Segment
+	timer    *time.Timer
+	wg       sync.WaitGroup // background package compression
+	doneMu   sync.Mutex
+	done     []Segment
+	errs     []error // errors of completing segments in background
+	lastName string
+}
+
+// NewRollingBinWriter create a rolling writer
+func NewRollingBinWriter(opt *RollingOption) (*RollingBinWriter, error) {
+	if !strings.Contains(opt.Pattern, RollingSeq) && !strings.Contains(opt.Pattern, RollingTime) {
+		return nil, ErrRollingPattern
+	}
+	if opt.PackageCompress != NONE && getPackageSuffix(opt.PackageCompress) == "" {
+		return nil, fmt.Errorf("package compression type %d not supported by rolling writers", opt.PackageCompress)
+	}
+	rw := &RollingBinWriter{opt: *opt}
+	if rw.opt.TimeLayout == "" {
+		rw.opt.TimeLayout = defaultRollingTimeLayout
+	}
+	return rw, nil
+}
+
+// Filename of the current segment, the last one if no segment is open
+func (rw *RollingBinWriter) Filename() string {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.current != nil {
+		return rw.current.Filename()
+	}
+	return rw.lastName
+}
+
+// Open the writer, the first segment is opened on the first write
+func (rw *RollingBinWriter) Open() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	rw.opened = true
+	return nil
+}
+
+// Close completes the current segment and waits for package compression of completed segments
+func (rw *RollingBinWriter) Close() error {
+	rw.mu.Lock()
+	err := rw.complete()
+	rw.opened = false
+	rw.mu.Unlock()
+	rw.wg.Wait()
+	rw.doneMu.Lock()
+	defer rw.doneMu.Unlock()
+	if err == nil && len(rw.errs) > 0 {
+		err = rw.errs[0]
+	}
+	rw.errs = nil
+	return err
+}
+
+func (rw *RollingBinWriter) Write(doc *Doc) (int, error) {
+	return rw.write(func(bw *binWriter) (int, error) {
+		return bw.Write(doc)
+	})
+}
+
+func (rw *RollingBinWriter) Delete(key []byte) (int, error) {
+	return rw.write(func(bw *binWriter) (int, error) {
+		return bw.Delete(key)
+	})
+}
+
+// Rotate completes the current segment, the next write opens a new one
+func (rw *RollingBinWriter) Rotate() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	return rw.complete()
+}
+
+// Segments completed so far, package compressed ones are listed once compression is done
+func (rw *RollingBinWriter) Segments() []Segment {
+	rw.doneMu.Lock()
+	defer rw.doneMu.Unlock()
+	return append([]Segment(nil), rw.done...)
+}
+
+func (rw *RollingBinWriter) write(write func(bw *binWriter) (int, error)) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if !rw.opened {
+		return 0, errors.New("not opened yet")
+	}
+	if rw.current == nil {
+		if err := rw.openSegment(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := write(rw.current)
+	if err != nil {
+		return n, err
+	}
+	rw.segment.Records += 1
+	rw.segment.Size += int64(n)
+	if rw.opt.MaxSize > 0 && rw.segment.Size >= rw.opt.MaxSize || rw.opt.MaxCount > 0 && rw.segment.Records >= rw.opt.MaxCount {
+		err = rw.complete()
+	}
+	return n, err
+}
+
+func (rw *RollingBinWriter) openSegment() error {
+	now := time.Now()
+	filename, file, err := rw.createSegment(now)
+	if err != nil {
+		return err
+	}
+	bw := createBinWriter(filename, rw.opt.CompressType)
+	bw.file, bw.writer = file, file
+	rw.current = bw
+	rw.segment = Segment{Filename: filename, Opened: now}
+	if rw.opt.MaxAge > 0 {
+		rw.timer = time.AfterFunc(rw.opt.MaxAge, func() {
+			rw.mu.Lock()
+			defer rw.mu.Unlock()
+			if rw.current == bw {
+				if err := rw.complete(); err != nil {
+					LogError("complete segment %s error: %v\n", filename, err)
+				}
+			}
+		})
+	}
+	LogDebug("open segment %s\n", filename)
+	return nil
+}
+
+// createSegment creates the next segment exclusively, names of existing files, package compressed or not, are
+// skipped, and so are names taken by other writers creating segments at the same time
+func (rw *RollingBinWriter) createSegment(now time.Time) (string, *os.File, error) {
+	suffix := getPackageSuffix(rw.opt.PackageCompress)
+	create := func(name string) (*os.File, error) {
+		if suffix != "" && CheckFileExists(name+suffix) {
+			return nil, fs.ErrExist
+		}
+		return os.OpenFile(name, writerFileFlag|os.O_EXCL, 0644)
+	}
+	for {
+		rw.seq += 1
+		name := strings.ReplaceAll(rw.opt.Pattern, RollingSeq, strconv.Itoa(rw.seq))
+		name = strings.ReplaceAll(name, RollingTime, now.Format(rw.opt.TimeLayout))
+		file, err := create(name)
+		if err == nil {
+			return name, file, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", nil, err
+		}
+		if strings.Contains(rw.opt.Pattern, RollingSeq) {
+			continue
+		}
+		// names by time only are made different by a number
+		for no := 1; ; no++ {
+			alt := fmt.Sprintf("%s.%d", name, no)
+			if file, err = create(alt); err == nil {
+				return alt, file, nil
+			}
+			if !errors.Is(err, fs.ErrExist) {
+				return "", nil, err
+			}
+		}
+	}
+}
+
+// complete closes the current segment, it is package compressed in background if required
+func (rw *RollingBinWriter) complete() error {
+	if rw.current == nil {
+		return nil
+	}
+	if rw.timer != nil {
+		rw.timer.Stop()
+		rw.timer = nil
+	}
+	err := rw.current.Close()
+	rw.lastName = rw.current.Filename()
+	rw.current = nil
+	seg := rw.segment
+	seg.Closed = time.Now()
+	if err != nil {
+		return err
+	}
+	if rw.opt.PackageCompress == NONE {
+		return rw.addSegment(seg)
+	}
+	rw.wg.Add(1)
+	go func() {
+		defer rw.wg.Done()
+		filename := seg.Filename + getPackageSuffix(rw.opt.PackageCompress)
+		err := packageSegment(seg.Filename, filename, rw.opt.PackageCompress)
+		if err == nil {
+			seg.Filename = filename
+			err = rw.addSegment(seg)
+		}
+		if err != nil {
+			LogError("complete segment %s error: %v\n", seg.Filename, err)
+			rw.doneMu.Lock()
+			rw.errs = append(rw.errs, err)
+			rw.doneMu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// addSegment lists completed segment and appends it to the manifest
+func (rw *RollingBinWriter) addSegment(seg Segment) error {
+	rw.doneMu.Lock()
+	defer rw.doneMu.Unlock()
+	rw.done = append(rw.done, seg)
+	if rw.opt.Manifest == "" {
+		return nil
+	}
+	data, err := json.Marshal(&seg)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(rw.opt.Manifest, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(data, '\n'))
+	if er := file.Close(); err == nil {
+		err = er
+	}
+	return err
+}
+
+// packageSegment compresses source into target as a whole and removes source
+func packageSegment(source, target string, pt int) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	cw, err := getCompressor(pt, out)
+	if err == nil {
+		_, err = io.Copy(cw, in)
+		if er := cw.Close(); err == nil {
+			err = er
+		}
+	}
+	if er := out.Close(); err == nil {
+		err = er
+	}
+	if err != nil {
+		_ = os.Remove(target)
+		return err
+	}
+	return os.Remove(source)
+}
+
+// ReadManifest segments listed in manifest of a rolling writer
+func ReadManifest(filename string) ([]Segment, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	var segments []Segment
+	dec := json.NewDecoder(file)
+	for {
+		var seg Segment
+		if err = dec.Decode(&seg); err == io.EOF {
+			return segments, nil
+		}
+		if err != nil {
+			return segments, err
+		}
+		segments = append(segments, seg)
+	}
+}
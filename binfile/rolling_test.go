@@ -0,0 +1,159 @@
+package binfile
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRollingBinWriter(t *testing.T) {
+	root := getTestDir("rolling")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	manifest := filepath.Join(root, "manifest.jsonl")
+	// existing files are never overwritten
+	if err := os.WriteFile(filepath.Join(root, "seg-1.bin"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRollingBinWriter(&RollingOption{Pattern: filepath.Join(root, "seg.bin")}); err != ErrRollingPattern {
+		t.Errorf("expect pattern error, got %v", err)
+	}
+	rw, err := NewRollingBinWriter(&RollingOption{Pattern: filepath.Join(root, "seg-{seq}.bin"), CompressType: NONE, PackageCompress: NONE, MaxCount: 3, Manifest: manifest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rw.Open(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		if _, err = rw.Write(&Doc{Key: []byte(fmt.Sprintf("k%d", i)), Content: []byte("content")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	segments, err := ReadManifest(manifest)
+	if err != nil || len(segments) != 3 {
+		t.Fatalf("expect 3 segments in manifest, got %d, %v", len(segments), err)
+	}
+	for i, want := range []int64{3, 3, 1} {
+		seg := segments[i]
+		if name := filepath.Join(root, fmt.Sprintf("seg-%d.bin", i+2)); seg.Filename != name || seg.Records != want || seg.Size != fileSizeOf(name) {
+			t.Errorf("unexpected segment %+v", seg)
+		}
+		if docs := readTestDocs(t, seg.Filename, NONE); int64(len(docs)) != want {
+			t.Errorf("expect %d docs in %s, got %d", want, seg.Filename, len(docs))
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "seg-1.bin")); string(data) != "old" {
+		t.Errorf("existing file overwritten")
+	}
+}
+
+func TestRollingPackageAndAge(t *testing.T) {
+	root := getTestDir("rolling_package")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	rw, err := NewRollingBinWriter(&RollingOption{
+		Pattern:         filepath.Join(root, "seg-{time}.bin"),
+		TimeLayout:      "2006",
+		CompressType:    NONE,
+		PackageCompress: GZIP,
+		MaxSize:         100,
+		MaxAge:          30 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rw.Open(); err != nil {
+		t.Fatal(err)
+	}
+	content := []byte(strings.Repeat("x", 60))
+	for i := 0; i < 3; i++ {
+		if _, err = rw.Write(&Doc{Key: []byte(fmt.Sprintf("k%d", i)), Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the third segment is completed by age
+	time.Sleep(100 * time.Millisecond)
+	if err = rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	segments := rw.Segments()
+	if len(segments) != 2 {
+		t.Fatalf("expect 2 segments, got %+v", segments)
+	}
+	year := time.Now().Format("2006")
+	names := map[string]bool{}
+	for _, seg := range segments {
+		names[filepath.Base(seg.Filename)] = true
+		if CheckFileExists(strings.TrimSuffix(seg.Filename, ".gz")) {
+			t.Errorf("segment %s not removed after package compression", seg.Filename)
+		}
+		in, err := os.Open(seg.Filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(zr)
+		_ = in.Close()
+		plain := filepath.Join(root, "plain.bin")
+		_ = os.WriteFile(plain, data, 0644)
+		if docs := readTestDocs(t, plain, NONE); int64(len(docs)) != seg.Records {
+			t.Errorf("expect %d docs in %s, got %d", seg.Records, seg.Filename, len(docs))
+		}
+	}
+	if !names["seg-"+year+".bin.gz"] || !names["seg-"+year+".bin.1.gz"] {
+		t.Errorf("unexpected segment names %v", names)
+	}
+}
+
+func TestRollingWritersSharingPattern(t *testing.T) {
+	root := getTestDir("rolling_shared")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	// writers of the same pattern never open the same segment
+	var wg sync.WaitGroup
+	for no := 0; no < 4; no++ {
+		rw, err := NewRollingBinWriter(&RollingOption{Pattern: filepath.Join(root, "seg-{seq}.bin"), CompressType: NONE, PackageCompress: NONE, MaxCount: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = rw.Open(); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(no int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if _, err := rw.Write(&Doc{Key: []byte(fmt.Sprintf("%d-%d", no, i)), Content: []byte("content")}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+			if err := rw.Close(); err != nil {
+				t.Error(err)
+			}
+		}(no)
+	}
+	wg.Wait()
+	files, err := filepath.Glob(filepath.Join(root, "seg-*.bin"))
+	if err != nil || len(files) != 40 {
+		t.Fatalf("expect 40 segments, got %d, %v", len(files), err)
+	}
+	for _, file := range files {
+		if docs := readTestDocs(t, file, NONE); len(docs) != 2 {
+			t.Errorf("expect 2 docs in %s, got %d", file, len(docs))
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package binfile
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/skiloop/binfiles/workers"
+)
+
+var ErrNoPattern = errors.New("no key pattern")
+
+// SearchAllOption is the option for searching all documents with matched keys
+type SearchAllOption struct {
+	Patterns    []string // key regex patterns, keys matching any of them are matched
+	Invert      bool     // match keys not matching any of the patterns
+	Offset      int64    // start position
+	Limit       int64    // max number of matches, 0 for unlimited
+	Content     bool     // read decompressed content of matches
+	SkipError   bool     // seek for next valid document when an invalid one is found
+	WorkerCount int      // number of workers searching different ranges of the file
+}
+
+// Match document found by search
+type Match struct {
+	Offset int64
+	Key    []byte
+	Doc    *Doc // document with decompressed content, only if Content is set
+}
+
+// CompilePatterns compiles patterns into one regex matching any of them
+func CompilePatterns(patterns []string) (*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		return nil, ErrNoPattern
+	}
+	groups := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, err
+		}
+		groups[i] = "(?:" + pattern + ")"
+	}
+	return regexp.Compile(strings.Join(groups, "|"))
+}
+
+// ReadPatternFile reads patterns one per line, empty lines are ignored
+func ReadPatternFile(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns, scanner.Err()
+}
+
+// SearchAll streams documents with matched keys to handler and returns the number of matches.
+// Ranges of the file are searched in parallel, so matches of different ranges interleave while
+// matches of the same range are in position order. Handler is never called concurrently,
+// it may be nil to count matches only.
+func SearchAll(filename string, compressType int, opt *SearchAllOption, handler func(m *Match) error) (int64, error) {
+	re, err := CompilePatterns(opt.Patterns)
+	if err != nil {
+		return 0, err
+	}
+	var mu sync.Mutex
+	var count int64
+	var stop atomic.Bool
+	err = scanRanges(filename, compressType, &scanOption{offset: opt.Offset, workerCount: opt.WorkerCount, skipError: opt.SkipError, stop: &stop},
+		func(doc *Doc, offset int64) error {
+			if re.Match(doc.Key) == opt.Invert {
+				return nil
+			}
+			m := &Match{Offset: offset, Key: doc.Key}
+			if opt.Content {
+				var err error
+				if m.Doc, err = DecompressDoc(doc, compressType, Verbose); err != nil {
+					if opt.SkipError {
+						LogError("skip document %s at %d: %v\n", doc.Key, offset, err)
+						return nil
+					}
+					return &DocError{Offset: offset, Err: err}
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if stop.Load() {
+				return nil
+			}
+			count += 1
+			if opt.Limit > 0 && count >= opt.Limit {
+				stop.Store(true)
+			}
+			if handler == nil {
+				return nil
+			}
+			return handler(m)
+		})
+	return count, err
+}
+
+type scanOption struct {
+	offset      int64        // start position
+	workerCount int          // number of ranges scanned in parallel
+	skipError   bool         // seek for next valid document when an invalid one is found
+	stop        *atomic.Bool // scanning stops once set, it is set when visit fails
+}
+
+// scanRanges visits live documents in ranges of the file in parallel, visit is called concurrently by workers
+// with documents of which content is not decompressed
+func scanRanges(filename string, compressType int, opt *scanOption, visit func(doc *Doc, offset int64) error) error {
+	bounds, err := docRanges(filename, opt.workerCount)
+	if err != nil {
+		return err
+	}
+	deletes, err := LoadTombstones(filename)
+	if err != nil {
+		return err
+	}
+	errs := make([]error, len(bounds)-1)
+	workers.RunJobs(len(errs), nil, func(no int) {
+		start, end := bounds[no], bounds[no+1]
+		if start < opt.offset {
+			start = opt.offset
+		}
+		if start >= end {
+			return
+		}
+		it, err := NewDocIterator(filename, compressType, &IterOption{Offset: start, End: end, Progress: true, SkipError: opt.skipError, Deletes: deletes})
+		if err != nil {
+			errs[no] = err
+			return
+		}
+		defer it.Close()
+		for !opt.stop.Load() && it.Next() {
+			if err = visit(it.Doc(), it.Offset()); err != nil {
+				opt.stop.Store(true)
+				errs[no] = err
+				return
+			}
+		}
+		errs[no] = it.Err()
+	}, nil)
+	for _, err = range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package binfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestSearchAll(t *testing.T) {
+	root := getTestDir("search")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+	docs := make([]*Doc, 200)
+	for i := range docs {
+		docs[i] = &Doc{Key: []byte(fmt.Sprintf("%s-%03d", []string{"a", "b", "c"}[i%3], i)), Content: []byte(fmt.Sprintf("%d", i))}
+	}
+	if err := writeTestDocs(filename, GZIP, docs...); err != nil {
+		t.Fatal(err)
+	}
+	bw := NewBinWriter(filename, GZIP)
+	if err := bw.Open(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = bw.Delete([]byte("a-000"))
+	_ = bw.Close()
+
+	var offsets []int64
+	count, err := SearchAll(filename, GZIP, &SearchAllOption{Patterns: []string{"^a-", "^b-00"}, Content: true, WorkerCount: 4}, func(m *Match) error {
+		var no int
+		_, _ = fmt.Sscanf(string(m.Key[2:]), "%d", &no)
+		if string(m.Doc.Content) != fmt.Sprintf("%d", no) {
+			t.Errorf("unexpected content %s of %s", m.Doc.Content, m.Key)
+		}
+		offsets = append(offsets, m.Offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a-000 is deleted, b-001, b-004 and b-007 match the second pattern
+	if expected := int64(66 + 3); count != expected || len(offsets) != int(expected) {
+		t.Errorf("expect %d matches, got %d with %d offsets", expected, count, len(offsets))
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	for i := 1; i < len(offsets); i++ {
+		if offsets[i] == offsets[i-1] {
+			t.Errorf("document at %d matched twice", offsets[i])
+		}
+	}
+
+	cases := []struct {
+		opt      SearchAllOption
+		expected int64
+	}{
+		{SearchAllOption{Patterns: []string{"^c-"}, WorkerCount: 3}, 66},
+		{SearchAllOption{Patterns: []string{"^c-"}, Invert: true, WorkerCount: 3}, 133},
+		{SearchAllOption{Patterns: []string{"-1"}, Limit: 5, WorkerCount: 3}, 5},
+	}
+	for _, c := range cases {
+		count, err = SearchAll(filename, GZIP, &c.opt, nil)
+		if err != nil || count != c.expected {
+			t.Errorf("option %+v: expect %d matches, got %d, %v", c.opt, c.expected, count, err)
+		}
+	}
+	if _, err = SearchAll(filename, GZIP, &SearchAllOption{}, nil); err != ErrNoPattern {
+		t.Errorf("expect %v, got %v", ErrNoPattern, err)
+	}
+}
+
+func TestSearchAllSkipDecompressError(t *testing.T) {
+	root := getTestDir("search-skip")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+	// the second record is valid with content not in gzip
+	for _, ct := range []int{GZIP, NONE, GZIP} {
+		if err := writeTestDocs(filename, ct, &Doc{Key: []byte(fmt.Sprintf("k%d", ct)), Content: []byte("content")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opt := &SearchAllOption{Patterns: []string{"^k"}, Content: true}
+	if _, err := SearchAll(filename, GZIP, opt, nil); err == nil {
+		t.Error("expect error of document not decompressed")
+	}
+	opt.SkipError = true
+	count, err := SearchAll(filename, GZIP, opt, nil)
+	if err != nil || count != 2 {
+		t.Errorf("expect 2 docs with decompress error skipped, got %d, %v", count, err)
+	}
+}
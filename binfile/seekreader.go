@@ -37,7 +37,7 @@ func (sr *seekReader) ReadAt(offset int64, decompress bool) (doc *Doc, err error
 // ReadKey read doc key at current position
 func (sr *seekReader) ReadKey(doc *DocKey) (n int, err error) {
 	n, err = readHeader(sr.rs, doc)
-	if err != nil {
+	if err != nil || doc.ContentSize == recordTombstone {
 		return n, err
 	}
 	_, err = sr.Seek(int64(doc.ContentSize), io.SeekCurrent)
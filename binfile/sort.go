@@ -0,0 +1,274 @@
+package binfile
+
+import (
+	"bytes"
+	"container/heap"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/skiloop/binfiles/workers"
+)
+
+const (
+	defaultSortMemory = 256 * 1024 * 1024
+	sortMergeFanIn    = 64
+)
+
+// SortOption is the option for sorting bin file by key
+type SortOption struct {
+	Input        string // source bin file
+	Output       string // sorted bin file
+	CompressType int    // document compression type, documents are not decompressed while sorting
+	MemoryLimit  int64  // bytes of documents held in memory, 256M if 0
+	WorkerCount  int    // number of workers sorting and spilling runs
+	TempDir      string // directory for runs, system temp directory if empty
+	Latest       bool   // keep only the last document of each key
+}
+
+type sortRun struct {
+	no   int
+	docs []*Doc
+}
+
+// Sort rewrites bin file in key order with external merge sort, documents with the same key keep their order.
+// Documents are read and sorted in runs bounded by memory limit, then runs are spilled as temporary bin files
+// and merged into the output. Existing output is overwritten, so input can be sorted in place.
+func Sort(opt *SortOption) error {
+	wc := opt.WorkerCount
+	if wc <= 0 {
+		wc = 1
+	}
+	limit := opt.MemoryLimit
+	if limit <= 0 {
+		limit = defaultSortMemory
+	}
+	// workers and the seeder hold one run each
+	runSize := limit / int64(wc+1)
+
+	tmp, err := os.MkdirTemp(opt.TempDir, "binsort")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(tmp)
+	}()
+
+	runCh := make(chan *sortRun)
+	stopCh := make(chan interface{})
+	var mu sync.Mutex
+	var runs []string
+	var runErr, readErr error
+	workers.RunJobs(wc, stopCh, func(no int) {
+		for run := range runCh {
+			filename, err := spillRun(tmp, run)
+			mu.Lock()
+			if err != nil && runErr == nil {
+				runErr = err
+			}
+			runs = append(runs, filename)
+			mu.Unlock()
+		}
+	}, func() {
+		defer close(runCh)
+		readErr = readRuns(opt, runSize, runCh, stopCh)
+	})
+	if readErr != nil {
+		return readErr
+	}
+	if runErr != nil {
+		return runErr
+	}
+	// run files are named by run number, sorting names keeps the original order of equal keys
+	sort.Slice(runs, func(i, j int) bool {
+		return runNo(runs[i]) < runNo(runs[j])
+	})
+	LogInfo("merging %d runs\n", len(runs))
+	return mergeRuns(tmp, runs, opt.Output, opt.Latest)
+}
+
+func readRuns(opt *SortOption, runSize int64, runCh chan *sortRun, stopCh chan interface{}) error {
+	it, err := NewDocIterator(opt.Input, opt.CompressType, &IterOption{End: -1, Progress: true})
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	run := &sortRun{}
+	size := int64(0)
+	send := func() bool {
+		select {
+		case runCh <- run:
+		case <-stopCh:
+			return false
+		}
+		run = &sortRun{no: run.no + 1}
+		size = 0
+		return true
+	}
+	for it.Next() {
+		doc := it.Doc()
+		run.docs = append(run.docs, doc)
+		size += recordSize(doc)
+		if size >= runSize && !send() {
+			return nil
+		}
+	}
+	if len(run.docs) > 0 || run.no == 0 {
+		send()
+	}
+	return it.Err()
+}
+
+func runFilename(dir string, no int) string {
+	return filepath.Join(dir, fmt.Sprintf("run.%d", no))
+}
+
+func runNo(filename string) (no int) {
+	_, _ = fmt.Sscanf(filepath.Base(filename), "run.%d", &no)
+	return no
+}
+
+// spillRun sorts documents of the run and writes them to a temporary bin file
+func spillRun(dir string, run *sortRun) (string, error) {
+	sort.SliceStable(run.docs, func(i, j int) bool {
+		return bytes.Compare(run.docs[i].Key, run.docs[j].Key) < 0
+	})
+	filename := runFilename(dir, run.no)
+	err := writeDocs(filename, run.docs)
+	LogDebug("run %d spilled with %d docs\n", run.no, len(run.docs))
+	return filename, err
+}
+
+func writeDocs(filename string, docs []*Doc) error {
+	bw := createBinWriter(filename, NONE)
+	bw.temp = true
+	if err := bw.Open(); err != nil {
+		return err
+	}
+	defer func() {
+		_ = bw.Close()
+	}()
+	for _, doc := range docs {
+		if _, err := bw.Write(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeRuns merges sorted runs into output, at most sortMergeFanIn runs are opened at the same time.
+// Runs merged together are neighbours, so the last document of a key stays the last one when only latest are kept.
+func mergeRuns(dir string, runs []string, output string, latest bool) error {
+	next := len(runs) + 1
+	for len(runs) > sortMergeFanIn {
+		var merged []string
+		for start := 0; start < len(runs); start += sortMergeFanIn {
+			end := start + sortMergeFanIn
+			if end > len(runs) {
+				end = len(runs)
+			}
+			filename := runFilename(dir, next)
+			next += 1
+			if err := mergeSorted(runs[start:end], filename, latest); err != nil {
+				return err
+			}
+			for _, run := range runs[start:end] {
+				_ = os.Remove(run)
+			}
+			merged = append(merged, filename)
+		}
+		runs = merged
+	}
+	return mergeSorted(runs, output, latest)
+}
+
+type runCursor struct {
+	no int
+	it *DocIterator
+}
+
+type runHeap []*runCursor
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	c := bytes.Compare(h[i].it.Doc().Key, h[j].it.Doc().Key)
+	return c < 0 || c == 0 && h[i].no < h[j].no
+}
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runCursor)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// mergeSorted k-way merges sorted bin files into output replacing its content, only the last document of each key
+// is written if latest
+func mergeSorted(files []string, output string, latest bool) error {
+	h := make(runHeap, 0, len(files))
+	defer func() {
+		for _, c := range h {
+			c.it.Close()
+		}
+	}()
+	for no, file := range files {
+		it, err := NewDocIterator(file, NONE, &IterOption{End: -1, ShowDeleted: true})
+		if err != nil {
+			return err
+		}
+		if !it.Next() {
+			it.Close()
+			if it.Err() != nil {
+				return it.Err()
+			}
+			continue
+		}
+		h = append(h, &runCursor{no: no, it: it})
+	}
+	heap.Init(&h)
+	// inputs are all read into runs by now, so output may be the input file
+	if err := os.Truncate(output, 0); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	bw := createBinWriter(output, NONE)
+	if err := bw.Open(); err != nil {
+		return err
+	}
+	defer func() {
+		_ = bw.Close()
+	}()
+	var last *Doc
+	for h.Len() > 0 {
+		c := h[0]
+		doc := c.it.Doc()
+		if latest && last != nil && !bytes.Equal(last.Key, doc.Key) {
+			if _, err := bw.Write(last); err != nil {
+				return err
+			}
+		}
+		if latest {
+			last = doc
+		} else if _, err := bw.Write(doc); err != nil {
+			return err
+		}
+		if c.it.Next() {
+			heap.Fix(&h, 0)
+			continue
+		}
+		heap.Pop(&h)
+		c.it.Close()
+		if c.it.Err() != nil {
+			return c.it.Err()
+		}
+	}
+	if last != nil {
+		if _, err := bw.Write(last); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package binfile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSort(t *testing.T) {
+	root := getTestDir("sort")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	src := filepath.Join(root, "src.bin")
+	docs := make([]*Doc, 500)
+	for i := range docs {
+		docs[i] = &Doc{Key: []byte(fmt.Sprintf("key-%03d", (i*7919)%250)), Content: []byte(fmt.Sprintf("%d", i))}
+	}
+	if err := writeTestDocs(src, GZIP, docs...); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(root, "sorted.bin")
+	// small memory limit to spill many runs and merge in several passes
+	err := Sort(&SortOption{Input: src, Output: out, CompressType: GZIP, MemoryLimit: 1024, WorkerCount: 3, TempDir: root})
+	if err != nil {
+		t.Fatalf("sort error: %v", err)
+	}
+	sorted := readTestDocs(t, out, GZIP)
+	if len(sorted) != len(docs) {
+		t.Fatalf("expect %d docs, got %d", len(docs), len(sorted))
+	}
+	var prev *Doc
+	for _, doc := range sorted {
+		if prev != nil {
+			c := bytes.Compare(prev.Key, doc.Key)
+			if c > 0 {
+				t.Fatalf("%s found after %s", doc.Key, prev.Key)
+			}
+			// documents with the same key keep the original order
+			var a, b int
+			_, _ = fmt.Sscanf(string(prev.Content), "%d", &a)
+			_, _ = fmt.Sscanf(string(doc.Content), "%d", &b)
+			if c == 0 && a > b {
+				t.Fatalf("%s: doc %d found after %d", doc.Key, b, a)
+			}
+		}
+		prev = doc
+	}
+}
+
+func TestSortExistingOutput(t *testing.T) {
+	root := getTestDir("sort_existing")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	src := filepath.Join(root, "src.bin")
+	out := filepath.Join(root, "sorted.bin")
+	if err := writeTestDocs(src, GZIP, &Doc{Key: []byte("b"), Content: []byte("b1")}, &Doc{Key: []byte("a"), Content: []byte("a1")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTestDocs(out, GZIP, &Doc{Key: []byte("old"), Content: []byte("old")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Sort(&SortOption{Input: src, Output: out, CompressType: GZIP, TempDir: root}); err != nil {
+		t.Fatalf("sort error: %v", err)
+	}
+	if got := testDocContents(readTestDocs(t, out, GZIP)); got != "a1 b1 " {
+		t.Fatalf("unexpected output %s", got)
+	}
+	// sort in place
+	if err := Sort(&SortOption{Input: src, Output: src, CompressType: GZIP, TempDir: root}); err != nil {
+		t.Fatalf("sort error: %v", err)
+	}
+	if got := testDocContents(readTestDocs(t, src, GZIP)); got != "a1 b1 " {
+		t.Fatalf("unexpected sorted input %s", got)
+	}
+}
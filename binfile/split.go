@@ -0,0 +1,287 @@
+package binfile
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+
+	"github.com/skiloop/binfiles/workers"
+)
+
+var ErrSplitOption = errors.New("one of size, count or shards is required")
+
+// SplitOption is the option for splitting bin files
+type SplitOption struct {
+	Input           string // source bin file
+	Target          string // target file prefix, outputs are named as target.N
+	SourceCompress  int    // document compression type of source
+	TargetCompress  int    // document compression type of outputs
+	PackageCompress int    // package compression type of outputs
+	Size            int64  // max bytes of each output, counted before package compression
+	Count           int64  // max number of documents of each output
+	Shards          int    // number of outputs, documents are placed by key hash
+	WorkerCount     int    // number of workers, only for shards
+}
+
+// KeyShard stable shard number of key, FNV-1a hash is used so other programs can locate the shard of a key
+func KeyShard(key []byte, shards int) int {
+	if shards <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return int(h.Sum32() % uint32(shards))
+}
+
+// SplitFilename filename of the N-th output
+func SplitFilename(target string, no int) string {
+	return fmt.Sprintf("%s.%d", target, no)
+}
+
+// Split bin file by size, document count or key hash, filenames of outputs are returned
+func Split(opt *SplitOption) ([]string, error) {
+	if opt.Shards > 0 {
+		return splitShards(opt)
+	}
+	if opt.Size <= 0 && opt.Count <= 0 {
+		return nil, ErrSplitOption
+	}
+	return splitSequence(opt)
+}
+
+// createSplitWriter opens an output of split, contents of an existing file are replaced
+func createSplitWriter(filename string, pt int) (BinWriter, error) {
+	if err := os.Truncate(filename, 0); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return newSplitWriter(filename, pt)
+}
+
+func newSplitWriter(filename string, pt int) (BinWriter, error) {
+	var bw BinWriter
+	if pt == NONE {
+		bw = NewBinWriter(filename, NONE)
+	} else {
+		var err error
+		if bw, err = NewCCBinWriter(filename, pt, NONE); err != nil {
+			return nil, err
+		}
+	}
+	if err := bw.Open(); err != nil {
+		return nil, err
+	}
+	return bw, nil
+}
+
+// recode document from source compression to target compression
+func recode(doc *Doc, st, tt int) (*Doc, error) {
+	if st == tt {
+		return doc, nil
+	}
+	doc, err := DecompressDoc(doc, st, Verbose)
+	if err != nil {
+		return nil, err
+	}
+	return CompressDoc(doc, tt)
+}
+
+func recordSize(doc *Doc) int64 {
+	size := int64(len(doc.Key) + len(doc.Content) + 8)
+	if len(doc.Attrs) > 0 {
+		size += int64(len(encodeAttrs(doc.Attrs)) + 8)
+	}
+	return size
+}
+
+func splitSequence(opt *SplitOption) (files []string, err error) {
+	it, err := NewDocIterator(opt.Input, opt.SourceCompress, &IterOption{End: -1, Progress: true})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	var bw BinWriter
+	defer func() {
+		if bw != nil {
+			_ = bw.Close()
+		}
+	}()
+	var size, count int64
+	for it.Next() {
+		doc, err := recode(it.Doc(), opt.SourceCompress, opt.TargetCompress)
+		if err != nil {
+			return files, &DocError{Offset: it.Offset(), Err: err}
+		}
+		rs := recordSize(doc)
+		full := opt.Count > 0 && count >= opt.Count || opt.Size > 0 && size > 0 && size+rs > opt.Size
+		if bw == nil || full {
+			if bw != nil {
+				_ = bw.Close()
+				LogInfo("%s done with %d docs and %d bytes\n", bw.Filename(), count, size)
+			}
+			if bw, err = createSplitWriter(SplitFilename(opt.Target, len(files)), opt.PackageCompress); err != nil {
+				return files, err
+			}
+			files = append(files, bw.Filename())
+			size, count = 0, 0
+		}
+		if _, err = bw.Write(doc); err != nil {
+			return files, err
+		}
+		size += rs
+		count += 1
+	}
+	if bw != nil {
+		LogInfo("%s done with %d docs and %d bytes\n", bw.Filename(), count, size)
+	}
+	return files, it.Err()
+}
+
+func splitShards(opt *SplitOption) ([]string, error) {
+	files := make([]string, opt.Shards)
+	for no := range files {
+		files[no] = SplitFilename(opt.Target, no)
+	}
+	bounds, err := docRanges(opt.Input, opt.WorkerCount)
+	if err != nil {
+		return nil, err
+	}
+	deletes, err := LoadTombstones(opt.Input)
+	if err != nil {
+		return nil, err
+	}
+	// each range is split into its own parts, which are joined in range order so that
+	// versions of a key keep their order in the shard
+	ranges := len(bounds) - 1
+	parts := make([][]string, ranges)
+	errs := make([]error, ranges)
+	defer func() {
+		for _, names := range parts {
+			for _, name := range names {
+				if name != "" {
+					_ = os.Remove(name)
+				}
+			}
+		}
+	}()
+	workers.RunJobs(ranges, nil, func(no int) {
+		parts[no], errs[no] = splitRange(opt, no, bounds[no], bounds[no+1], deletes)
+	}, nil)
+	for _, err = range errs {
+		if err != nil {
+			return files, err
+		}
+	}
+	for no, filename := range files {
+		names := make([]string, 0, ranges)
+		for _, rp := range parts {
+			if rp[no] != "" {
+				names = append(names, rp[no])
+			}
+		}
+		if err = joinParts(filename, names, opt.PackageCompress); err != nil {
+			return files, err
+		}
+	}
+	return files, nil
+}
+
+// splitPartFilename filename of the part of a shard from a range
+func splitPartFilename(target string, shard, part int) string {
+	return fmt.Sprintf("%s.part%d", SplitFilename(target, shard), part)
+}
+
+// splitRange split documents start in range [start, end) into parts of shards, filenames of parts are returned
+// by shard number, empty for shards without documents from the range
+func splitRange(opt *SplitOption, part int, start, end int64, deletes Tombstones) ([]string, error) {
+	names := make([]string, opt.Shards)
+	writers := make([]BinWriter, opt.Shards)
+	defer func() {
+		for _, bw := range writers {
+			if bw != nil {
+				_ = bw.Close()
+			}
+		}
+	}()
+	it, err := NewDocIterator(opt.Input, opt.SourceCompress, &IterOption{Offset: start, End: end, Progress: true, Deletes: deletes})
+	if err != nil {
+		return names, err
+	}
+	defer it.Close()
+	count := 0
+	for it.Next() {
+		doc, err := recode(it.Doc(), opt.SourceCompress, opt.TargetCompress)
+		if err != nil {
+			return names, &DocError{Offset: it.Offset(), Err: err}
+		}
+		shard := KeyShard(doc.Key, opt.Shards)
+		if writers[shard] == nil {
+			names[shard] = splitPartFilename(opt.Target, shard, part)
+			if writers[shard], err = createSplitWriter(names[shard], NONE); err != nil {
+				return names, err
+			}
+			writeTemp(writers[shard])
+		}
+		n, err := writers[shard].Write(doc)
+		if err != nil {
+			return names, err
+		}
+		// parts are temporary, records are counted here as they are joined into shards unchanged
+		if s := activeStats.Load(); s != nil {
+			s.addRecord(len(doc.Key), rawContentSize(doc, opt.TargetCompress), len(doc.Content), opt.TargetCompress, n, 0, 0, 0)
+		}
+		count += 1
+	}
+	LogInfo("range %d to %d done with %d docs\n", start, end, count)
+	return names, it.Err()
+}
+
+// joinParts writes parts to target in order, package compressed as a whole, target is replaced if exists
+func joinParts(target string, parts []string, pt int) error {
+	out, err := os.OpenFile(target, writerFileFlag|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	// flag of the replaced file, parts are not walked for tombstones
+	if err = clearNoTombstones(out); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if pt == NONE {
+		err = appendFiles(out, parts)
+	} else {
+		var cw Compressor
+		if cw, err = getCompressor(pt, out); err == nil {
+			err = appendFiles(cw, parts)
+			if er := cw.Close(); err == nil {
+				err = er
+			}
+		}
+	}
+	if er := out.Close(); err == nil {
+		err = er
+	}
+	return err
+}
+
+func appendFiles(w io.Writer, files []string) error {
+	for _, filename := range files {
+		if err := appendFile(w, filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendFile(w io.Writer, filename string) error {
+	in, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	_, err = io.Copy(w, in)
+	return err
+}
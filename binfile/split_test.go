@@ -0,0 +1,179 @@
+package binfile
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createSplitTestFile(t *testing.T, filename string, count int) {
+	docs := make([]*Doc, count)
+	for i := range docs {
+		docs[i] = &Doc{Key: []byte(fmt.Sprintf("key-%d", i)), Content: []byte(RandStringBytesMaskImprSrc(100))}
+	}
+	if err := writeTestDocs(filename, GZIP, docs...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSplitByCount(t *testing.T) {
+	root := getTestDir("split_count")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	src := filepath.Join(root, "src.bin")
+	createSplitTestFile(t, src, 100)
+
+	// outputs of a former run are replaced
+	for run := 0; run < 2; run++ {
+		files, err := Split(&SplitOption{Input: src, Target: filepath.Join(root, "out"), SourceCompress: GZIP, TargetCompress: NONE, PackageCompress: NONE, Count: 30})
+		if err != nil {
+			t.Fatalf("split error: %v", err)
+		}
+		if len(files) != 4 {
+			t.Fatalf("expect 4 files, got %d", len(files))
+		}
+		for i, file := range files {
+			expected := 30
+			if i == 3 {
+				expected = 10
+			}
+			if docs := readTestDocs(t, file, NONE); len(docs) != expected {
+				t.Errorf("run %d, %s: expect %d docs, got %d", run, file, expected, len(docs))
+			}
+		}
+	}
+}
+
+func TestSplitBySize(t *testing.T) {
+	root := getTestDir("split_size")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	src := filepath.Join(root, "src.bin")
+	createSplitTestFile(t, src, 100)
+
+	// each record takes 8 + 6 or 7 key bytes + 100 content bytes
+	files, err := Split(&SplitOption{Input: src, Target: filepath.Join(root, "out"), SourceCompress: GZIP, TargetCompress: NONE, PackageCompress: NONE, Size: 1200})
+	if err != nil {
+		t.Fatalf("split error: %v", err)
+	}
+	total := 0
+	for _, file := range files {
+		size, _ := getFileSize(file)
+		if size > 1200 {
+			t.Errorf("%s too large: %d", file, size)
+		}
+		total += len(readTestDocs(t, file, NONE))
+	}
+	if total != 100 || len(files) != 10 {
+		t.Fatalf("expect 100 docs in 10 files, got %d docs in %d files", total, len(files))
+	}
+}
+
+func TestSplitShards(t *testing.T) {
+	root := getTestDir("split_shards")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	src := filepath.Join(root, "src.bin")
+	createSplitTestFile(t, src, 1000)
+
+	// outputs of a former run are replaced
+	for run := 0; run < 2; run++ {
+		files, err := Split(&SplitOption{Input: src, Target: filepath.Join(root, "out"), SourceCompress: GZIP, TargetCompress: GZIP, PackageCompress: NONE, Shards: 4, WorkerCount: 3})
+		if err != nil {
+			t.Fatalf("split error: %v", err)
+		}
+		if len(files) != 4 {
+			t.Fatalf("expect 4 files, got %d", len(files))
+		}
+		keys := make(map[string]bool)
+		docs := 0
+		for no, file := range files {
+			for _, doc := range readTestDocs(t, file, GZIP) {
+				if shard := KeyShard(doc.Key, 4); shard != no {
+					t.Errorf("%s found in shard %d, expect %d", doc.Key, no, shard)
+				}
+				keys[string(doc.Key)] = true
+				docs += 1
+			}
+		}
+		if len(keys) != 1000 || docs != 1000 {
+			t.Fatalf("run %d: expect 1000 docs of different keys, got %d docs of %d keys", run, docs, len(keys))
+		}
+	}
+}
+
+func TestSplitShardsKeepOrder(t *testing.T) {
+	root := getTestDir("split_shards_order")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	src := filepath.Join(root, "src.bin")
+	// versions of each key spread over the whole file, so they fall into different ranges
+	for v := 0; v < 5; v++ {
+		docs := make([]*Doc, 200)
+		for i := range docs {
+			docs[i] = &Doc{Key: []byte(fmt.Sprintf("key-%d", i)), Content: []byte(fmt.Sprintf("v%d-%s", v, RandStringBytesMaskImprSrc(50)))}
+		}
+		if err := writeTestDocs(src, GZIP, docs...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := Split(&SplitOption{Input: src, Target: filepath.Join(root, "out"), SourceCompress: GZIP, TargetCompress: NONE, PackageCompress: GZIP, Shards: 3, WorkerCount: 4})
+	if err != nil {
+		t.Fatalf("split error: %v", err)
+	}
+	total := 0
+	for _, file := range files {
+		versions := make(map[string]int)
+		plain := file + ".plain"
+		gunzipTestFile(t, file, plain)
+		for _, doc := range readTestDocs(t, plain, NONE) {
+			v := int(doc.Content[1] - '0')
+			if last, ok := versions[string(doc.Key)]; ok && v != last+1 {
+				t.Fatalf("%s: version %d of %s after version %d", file, v, doc.Key, last)
+			}
+			versions[string(doc.Key)] = v
+			total += 1
+		}
+	}
+	if total != 1000 {
+		t.Fatalf("expect 1000 docs, got %d", total)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(root, "*.part*")); len(matches) > 0 {
+		t.Fatalf("parts left: %v", matches)
+	}
+}
+
+func TestRepackSplitOptions(t *testing.T) {
+	for _, opt := range []RepackCmd{
+		{Source: "src", Target: "dst", Split: 10, Mode: "path"},
+		{Source: "src", Target: "dst", Shards: 2, Mode: "file", Limit: 5},
+		{Source: "src", Target: "dst", SplitSize: 100, Mode: "doc", ContentOnly: true},
+	} {
+		if err := Repack(opt); err != ErrRepackSplit {
+			t.Errorf("expect ErrRepackSplit, got %v", err)
+		}
+	}
+}
+
+func gunzipTestFile(t *testing.T, source, target string) {
+	in, err := os.Open(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(target, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
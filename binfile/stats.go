@@ -0,0 +1,206 @@
+package binfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Histogram counts sizes in power of two buckets, bucket i holds sizes in [2^(i-1), 2^i)
+type Histogram struct {
+	Buckets [33]int64
+	Min     int64
+	Max     int64
+	Sum     int64
+	Count   int64
+}
+
+// Add a size to histogram
+func (h *Histogram) Add(size int64) {
+	if size < 0 {
+		size = 0
+	}
+	if h.Count == 0 || size < h.Min {
+		h.Min = size
+	}
+	if size > h.Max {
+		h.Max = size
+	}
+	h.Sum += size
+	h.Count += 1
+	h.Buckets[bits.Len32(uint32(size))] += 1
+}
+
+// Mean of sizes
+func (h *Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return float64(h.Sum) / float64(h.Count)
+}
+
+type histogramBucket struct {
+	Below int64 `json:"below"`
+	Count int64 `json:"count"`
+}
+
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	buckets := make([]histogramBucket, 0)
+	for i, count := range h.Buckets {
+		if count > 0 {
+			buckets = append(buckets, histogramBucket{Below: int64(1) << i, Count: count})
+		}
+	}
+	return json.Marshal(struct {
+		Count   int64             `json:"count"`
+		Sum     int64             `json:"sum"`
+		Min     int64             `json:"min"`
+		Max     int64             `json:"max"`
+		Mean    float64           `json:"mean"`
+		Buckets []histogramBucket `json:"buckets"`
+	}{h.Count, h.Sum, h.Min, h.Max, h.Mean(), buckets})
+}
+
+func (h *Histogram) String() string {
+	sb := strings.Builder{}
+	for i, count := range h.Buckets {
+		if count > 0 {
+			sb.WriteString(fmt.Sprintf("  < %-8s %d\n", formatBytes(int64(1)<<i), count))
+		}
+	}
+	return sb.String()
+}
+
+// CodecStats sizes of documents written with the same compression type
+type CodecStats struct {
+	Docs            int64 `json:"docs"`
+	RawBytes        int64 `json:"raw_bytes"`
+	CompressedBytes int64 `json:"compressed_bytes"`
+}
+
+// Ratio compressed bytes to raw bytes
+func (c *CodecStats) Ratio() float64 {
+	if c.RawBytes == 0 {
+		return 0
+	}
+	return float64(c.CompressedBytes) / float64(c.RawBytes)
+}
+
+// WriteStats statistics collected by bin writers while the stats is active
+type WriteStats struct {
+	mu           sync.Mutex
+	start        time.Time
+	Elapsed      time.Duration          `json:"elapsed_ns"`
+	Docs         int64                  `json:"docs"`
+	Skipped      int64                  `json:"skipped"`
+	Bytes        int64                  `json:"bytes"`
+	Codecs       map[string]*CodecStats `json:"codecs"`
+	KeySizes     *Histogram             `json:"key_sizes"`
+	ContentSizes *Histogram             `json:"content_sizes"`
+	CompressTime time.Duration          `json:"compress_ns"`
+	LockTime     time.Duration          `json:"lock_ns"`
+	WriteTime    time.Duration          `json:"write_ns"`
+}
+
+var activeStats atomic.Pointer[WriteStats]
+
+// StartStats create write statistics and make it active
+func StartStats() *WriteStats {
+	s := &WriteStats{
+		start:        time.Now(),
+		Codecs:       make(map[string]*CodecStats),
+		KeySizes:     &Histogram{},
+		ContentSizes: &Histogram{},
+	}
+	activeStats.Store(s)
+	return s
+}
+
+// Finish deactivate the statistics
+func (s *WriteStats) Finish() {
+	activeStats.CompareAndSwap(s, nil)
+	s.mu.Lock()
+	s.Elapsed = time.Since(s.start)
+	s.mu.Unlock()
+}
+
+func (s *WriteStats) addWrite(raw, compressed *Doc, compressType int, n int, compressTime, lockTime, writeTime time.Duration) {
+	s.addRecord(len(raw.Key), len(raw.Content), len(compressed.Content), compressType, n, compressTime, lockTime, writeTime)
+}
+
+// addRecord counts a record written by sizes of key, raw and compressed content
+func (s *WriteStats) addRecord(keySize, rawSize, compressedSize int, compressType int, n int, compressTime, lockTime, writeTime time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Docs += 1
+	s.Bytes += int64(n)
+	name := CompressTypeName(compressType)
+	codec, ok := s.Codecs[name]
+	if !ok {
+		codec = &CodecStats{}
+		s.Codecs[name] = codec
+	}
+	codec.Docs += 1
+	codec.RawBytes += int64(rawSize)
+	codec.CompressedBytes += int64(compressedSize)
+	s.KeySizes.Add(int64(keySize))
+	s.ContentSizes.Add(int64(rawSize))
+	s.CompressTime += compressTime
+	s.LockTime += lockTime
+	s.WriteTime += writeTime
+}
+
+func (s *WriteStats) addSkip() {
+	s.mu.Lock()
+	s.Skipped += 1
+	s.mu.Unlock()
+}
+
+// WriteJSON write statistics as json
+func (s *WriteStats) WriteJSON(w io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+// Summary human readable statistics
+func (s *WriteStats) Summary() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("docs written: %d, skipped: %d, bytes: %s in %s\n", s.Docs, s.Skipped, formatBytes(s.Bytes), s.Elapsed.Round(time.Millisecond)))
+	if secs := s.Elapsed.Seconds(); secs > 0 {
+		sb.WriteString(fmt.Sprintf("throughput: %.0f docs/s, %s/s\n", float64(s.Docs)/secs, formatBytes(int64(float64(s.Bytes)/secs))))
+	}
+	names := make([]string, 0, len(s.Codecs))
+	for name := range s.Codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := s.Codecs[name]
+		sb.WriteString(fmt.Sprintf("%s: %d docs, %s -> %s, ratio %.3f\n", name, c.Docs, formatBytes(c.RawBytes), formatBytes(c.CompressedBytes), c.Ratio()))
+	}
+	sb.WriteString(fmt.Sprintf("time compressing: %s, waiting on locks: %s, writing: %s\n",
+		s.CompressTime.Round(time.Millisecond), s.LockTime.Round(time.Millisecond), s.WriteTime.Round(time.Millisecond)))
+	sb.WriteString(fmt.Sprintf("key sizes: min %d, max %d, mean %.1f\n", s.KeySizes.Min, s.KeySizes.Max, s.KeySizes.Mean()))
+	sb.WriteString(s.KeySizes.String())
+	sb.WriteString(fmt.Sprintf("content sizes: min %d, max %d, mean %.1f\n", s.ContentSizes.Min, s.ContentSizes.Max, s.ContentSizes.Mean()))
+	sb.WriteString(s.ContentSizes.String())
+	return sb.String()
+}
+
+// recordSkip count a document skipped by writers in the active statistics
+func recordSkip() {
+	if s := activeStats.Load(); s != nil {
+		s.addSkip()
+	}
+}
@@ -0,0 +1,125 @@
+package binfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	h := &Histogram{}
+	for _, size := range []int64{0, 1, 3, 4, 1000} {
+		h.Add(size)
+	}
+	if h.Min != 0 || h.Max != 1000 || h.Count != 5 || h.Sum != 1008 {
+		t.Fatalf("unexpected histogram: %+v", h)
+	}
+	expected := map[int]int64{0: 1, 1: 1, 2: 1, 3: 1, 10: 1}
+	for i, count := range h.Buckets {
+		if count != expected[i] {
+			t.Errorf("bucket %d: expect %d, got %d", i, expected[i], count)
+		}
+	}
+}
+
+func TestWriteStats(t *testing.T) {
+	root := getTestDir("write_stats")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+
+	s := StartStats()
+	content := bytes.Repeat([]byte("compressible "), 100)
+	err := writeTestDocs(filepath.Join(root, "a.bin"), GZIP, &Doc{Key: []byte("k1"), Content: content}, &Doc{Key: []byte("key2"), Content: content})
+	s.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// writes after finish are not collected
+	if err = writeTestDocs(filepath.Join(root, "b.bin"), GZIP, &Doc{Key: []byte("k3"), Content: content}); err != nil {
+		t.Fatal(err)
+	}
+	codec := s.Codecs["gzip"]
+	if s.Docs != 2 || codec == nil || codec.Docs != 2 || codec.RawBytes != int64(2*len(content)) {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+	if codec.Ratio() <= 0 || codec.Ratio() >= 0.5 {
+		t.Fatalf("unexpected ratio: %f", codec.Ratio())
+	}
+	size, _ := getFileSize(filepath.Join(root, "a.bin"))
+	if s.Bytes != size {
+		t.Fatalf("expect %d bytes written, got %d", size, s.Bytes)
+	}
+	buf := &bytes.Buffer{}
+	if err = s.WriteJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err = json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if decoded["docs"].(float64) != 2 {
+		t.Fatalf("unexpected json: %s", buf.String())
+	}
+}
+
+func TestWriteStatsRepackAsIs(t *testing.T) {
+	root := getTestDir("write_stats_repack")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	src := filepath.Join(root, "src.bin")
+	content := bytes.Repeat([]byte("compressible "), 100)
+	if err := writeTestDocs(src, GZIP, &Doc{Key: []byte("k1"), Content: content}, &Doc{Key: []byte("k2"), Content: content}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := StartStats()
+	err := Repack(RepackCmd{Source: src, Target: filepath.Join(root, "dst.bin"), Workers: 2, Mode: "file", Optimized: true,
+		SourceCompressType: "gzip", TargetCompressType: "gzip", PackageCompressType: "none"})
+	s.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// documents are copied without recompression, they are still gzip documents
+	codec := s.Codecs["gzip"]
+	if s.Docs != 2 || codec == nil || codec.RawBytes != int64(2*len(content)) || codec.CompressedBytes >= codec.RawBytes {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
+
+func TestWriteStatsSkipTempFiles(t *testing.T) {
+	root := getTestDir("write_stats_temp")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	src := filepath.Join(root, "src.bin")
+	var docs []*Doc
+	for i := 0; i < 20; i++ {
+		docs = append(docs, &Doc{Key: []byte{byte('a' + i%7), byte('0' + i)}, Content: bytes.Repeat([]byte("x"), 100)})
+	}
+	if err := writeTestDocs(src, NONE, docs...); err != nil {
+		t.Fatal(err)
+	}
+
+	// sort spills runs to temporary files, only the sorted output is counted
+	s := StartStats()
+	err := Sort(&SortOption{Input: src, Output: filepath.Join(root, "sorted.bin"), CompressType: NONE, MemoryLimit: 512, WorkerCount: 2, TempDir: root})
+	s.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Docs != int64(len(docs)) {
+		t.Fatalf("sort: expect %d docs counted, got %d", len(docs), s.Docs)
+	}
+
+	// shards are joined from temporary parts
+	s = StartStats()
+	_, err = Split(&SplitOption{Input: src, Target: filepath.Join(root, "shard"), Shards: 3, WorkerCount: 2})
+	s.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Docs != int64(len(docs)) {
+		t.Fatalf("split: expect %d docs counted, got %d", len(docs), s.Docs)
+	}
+}
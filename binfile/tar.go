@@ -10,7 +10,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/ulikunitz/xz"
 )
@@ -176,3 +178,85 @@ func ListTar(filename string, format CompressionFormat, limit int) {
 		return nil
 	})
 }
+
+// TarExportOption is the option for exporting documents as tar entries
+type TarExportOption struct {
+	Input        string // source bin file
+	Output       string // tar file, compressed by the suffix: .gz, .tgz, .xz or .bz2
+	CompressType int    // document compression type of source
+	Raw          bool   // write document content as is without decompression
+	Pattern      string // key regex pattern, only matched documents are exported if not empty
+}
+
+// TarCompressType compression type of tar file by its suffix
+func TarCompressType(filename string) int {
+	switch {
+	case strings.HasSuffix(filename, ".gz"), strings.HasSuffix(filename, ".tgz"):
+		return GZIP
+	case strings.HasSuffix(filename, ".xz"):
+		return XZ
+	case strings.HasSuffix(filename, ".bz2"):
+		return BZIP2
+	}
+	return NONE
+}
+
+// ExportTar streams documents to a tar archive, key as entry name and content as entry body,
+// so that packaging the archive with relative or full keys restores the same documents.
+// Mode and modification time of entries are taken from document attributes if they exist.
+func ExportTar(opt *TarExportOption) (count int64, err error) {
+	var pattern *regexp.Regexp
+	if opt.Pattern != "" {
+		if pattern, err = regexp.Compile(opt.Pattern); err != nil {
+			return 0, err
+		}
+	}
+	it, err := NewDocIterator(opt.Input, opt.CompressType, &IterOption{End: -1, Decompress: !opt.Raw, Progress: true})
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+	w, err := newOutWriter(opt.Output, TarCompressType(opt.Output))
+	if err != nil {
+		return 0, err
+	}
+	defer closeWriter(w, opt.Output)
+	tw := tar.NewWriter(w)
+	defer func() {
+		if er := tw.Close(); err == nil {
+			err = er
+		}
+	}()
+	now := time.Now()
+	for it.Next() {
+		doc := it.Doc()
+		if pattern != nil && !pattern.Match(doc.Key) {
+			continue
+		}
+		name := string(doc.Key)
+		if name == "" {
+			name = fmt.Sprintf("%s%d", EmptyDocKey, it.Offset())
+		}
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Size:     int64(len(doc.Content)),
+			Mode:     0644,
+			ModTime:  now,
+		}
+		if mode, ok := AttrFileMode(doc.Attrs); ok {
+			hdr.Mode = int64(mode)
+		}
+		if mtime, ok := AttrTime(doc.Attrs); ok {
+			hdr.ModTime = mtime
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return count, err
+		}
+		if _, err = tw.Write(doc.Content); err != nil {
+			return count, err
+		}
+		count += 1
+	}
+	return count, it.Err()
+}
@@ -0,0 +1,64 @@
+package binfile
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestTarCompressType(t *testing.T) {
+	cases := map[string]int{
+		"a.tar":     NONE,
+		"a.tar.gz":  GZIP,
+		"a.tgz":     GZIP,
+		"a.tar.xz":  XZ,
+		"a.tar.bz2": BZIP2,
+	}
+	for filename, expected := range cases {
+		if got := TarCompressType(filename); got != expected {
+			t.Errorf("%s: expect %s, got %s", filename, CompressTypeName(expected), CompressTypeName(got))
+		}
+	}
+}
+
+func TestExportTarRoundTrip(t *testing.T) {
+	root := getTestDir("tar")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	src := filepath.Join(root, "src.bin")
+	docs := []*Doc{
+		{Key: []byte("a.json"), Content: []byte(`{"a":1}`)},
+		{Key: []byte("dir/b.json"), Content: []byte(`{"b":2}`)},
+		{Key: []byte("dir/sub/c.json"), Content: []byte(`{"c":3}`)},
+	}
+	if err := writeTestDocs(src, GZIP, docs...); err != nil {
+		t.Fatal(err)
+	}
+	tarFile := filepath.Join(root, "docs.tar.gz")
+	count, err := ExportTar(&TarExportOption{Input: src, Output: tarFile, CompressType: GZIP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != int64(len(docs)) {
+		t.Fatalf("expect %d exported, got %d", len(docs), count)
+	}
+
+	dst := filepath.Join(root, "dst.bin")
+	opt := &PackageOption{Path: tarFile, WorkerCount: 1, TarCompress: "gzip", KeyStrategy: KeyRelative}
+	if err = Package(opt, NewBinWriter(dst, NONE)); err != nil {
+		t.Fatal(err)
+	}
+	got := readTestDocs(t, dst, NONE)
+	if len(got) != len(docs) {
+		t.Fatalf("expect %d docs, got %d", len(docs), len(got))
+	}
+	sort.Slice(got, func(i, j int) bool {
+		return string(got[i].Key) < string(got[j].Key)
+	})
+	for i, doc := range docs {
+		if string(got[i].Key) != string(doc.Key) || string(got[i].Content) != string(doc.Content) {
+			t.Errorf("doc %d: expect %s=%s, got %s=%s", i, doc.Key, doc.Content, got[i].Key, got[i].Content)
+		}
+	}
+}
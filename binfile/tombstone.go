@@ -0,0 +1,276 @@
+package binfile
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+)
+
+// recordTombstone in place of content size marks a tombstone record without content,
+// documents of the same key written before it are deleted.
+const recordTombstone int32 = -1
+
+// Tombstones position of the last tombstone of each deleted key
+type Tombstones map[string]int64
+
+// LoadTombstones collects tombstones of bin file. Files flagged by writers as having no tombstones are not walked.
+// Tombstones are kept in an index under TombstoneIndexDir if SaveTombstoneIndex, the index is used while the size
+// and modification time of the file are unchanged. Invalid records are skipped, tombstones after them are still
+// collected.
+func LoadTombstones(filename string) (Tombstones, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	if hasNoTombstones(file) {
+		return make(Tombstones), nil
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	idx := loadTombstoneIndex(filename, file, stat)
+	if idx.covered == stat.Size() {
+		return idx.tombs, nil
+	}
+	covered, err := walkRecords(file, idx.covered, stat.Size(), func(pos int64, key []byte, contentSize int32) error {
+		if contentSize == recordTombstone {
+			idx.tombs[string(key)] = pos
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if SaveTombstoneIndex && covered > idx.covered {
+		idx.covered = covered
+		if err = idx.save(filename, file, stat); err != nil {
+			LogDebug("save tombstone index of %s error: %v\n", filename, err)
+		}
+	}
+	return idx.tombs, nil
+}
+
+// walkRecords visits records in [start, end) of file one by one through a buffered reader, contents are skipped
+// and key is only valid during visit. Invalid records are skipped by seeking for the next valid record like
+// iterators do with SkipError, onSkip is called with the byte range skipped if not nil. Regions abandoned by batch
+// writers are stepped over. Walking stops at a trailing record not completely written, or a region reserved by
+// batch writers and not written yet, the position walking stopped at is returned, end if all records are visited.
+func walkRecords(file *os.File, start, end int64, visit func(pos int64, key []byte, contentSize int32) error, onSkip func(start, end int64)) (int64, error) {
+	w := &recordWalker{file: file, end: end}
+	w.reset(start)
+	pos := start
+	for pos < end {
+		key, contentSize, err := w.next()
+		if err == nil {
+			if err = visit(pos, key, contentSize); err != nil {
+				return pos, err
+			}
+			pos = w.off
+			continue
+		}
+		if size := abandonedRegion(file, pos); size > 0 {
+			pos += size
+			w.reset(pos)
+			continue
+		}
+		if incompleteRecord(file, pos, end) {
+			return pos, nil
+		}
+		next := nextRecordAt(file, pos+1, end)
+		LogDebug("skip invalid records from %d to %d: %v\n", pos, next, err)
+		if onSkip != nil {
+			onSkip(pos, next)
+		}
+		if next >= end {
+			return pos, nil
+		}
+		pos = next
+		w.reset(pos)
+	}
+	return pos, nil
+}
+
+// recordWalker reads record headers sequentially, contents are skipped
+type recordWalker struct {
+	file *os.File
+	end  int64
+	rd   *bufio.Reader
+	off  int64 // position of the next byte of rd
+	head [4]byte
+	key  []byte
+}
+
+func (w *recordWalker) reset(pos int64) {
+	section := io.NewSectionReader(w.file, pos, w.end-pos)
+	if w.rd == nil {
+		w.rd = bufio.NewReaderSize(section, iteratorBufferSize)
+	} else {
+		w.rd.Reset(section)
+	}
+	w.off = pos
+}
+
+func (w *recordWalker) readSize() (int32, error) {
+	if _, err := io.ReadFull(w.rd, w.head[:]); err != nil {
+		return 0, err
+	}
+	w.off += 4
+	return int32(binary.LittleEndian.Uint32(w.head[:])), nil
+}
+
+// skip n bytes, large skips seek instead of reading through
+func (w *recordWalker) skip(n int64) error {
+	if w.off+n > w.end {
+		return io.ErrUnexpectedEOF
+	}
+	if n > int64(w.rd.Buffered()) {
+		w.reset(w.off + n)
+		return nil
+	}
+	_, err := w.rd.Discard(int(n))
+	w.off += n
+	return err
+}
+
+// next reads key and content size of the next record, content size is recordTombstone for tombstones
+func (w *recordWalker) next() (key []byte, contentSize int32, err error) {
+	h := &recordHead{}
+	if err = decodeHeader(w, h); err != nil {
+		return nil, 0, err
+	}
+	if h.contentSize == recordTombstone {
+		return h.key, h.contentSize, nil
+	}
+	return h.key, h.contentSize, w.skip(int64(h.contentSize))
+}
+
+func (w *recordWalker) readKey(size int32) ([]byte, error) {
+	if cap(w.key) < int(size) {
+		w.key = make([]byte, size)
+	}
+	key := w.key[:size]
+	if _, err := io.ReadFull(w.rd, key); err != nil {
+		return nil, err
+	}
+	w.off += int64(size)
+	return key, nil
+}
+
+// readAttrs skips attributes
+func (w *recordWalker) readAttrs(size int32) (map[string][]byte, error) {
+	return nil, w.skip(int64(size))
+}
+
+// nextRecordAt position of the first valid record in [from, end) followed by another valid record, a record not
+// completely written or the end, end if not found
+func nextRecordAt(r io.ReaderAt, from, end int64) int64 {
+	var window [64 * 1024]byte
+	for start := from; start < end; start += int64(len(window)) - 3 {
+		n, _ := r.ReadAt(window[:], start)
+		if n < 4 {
+			break
+		}
+		for i := 0; i+4 <= n; i++ {
+			// check key size in memory before reading headers
+			if keySize := int32(binary.LittleEndian.Uint32(window[i:])); keySize < 0 || keySize > KeySizeLimit {
+				continue
+			}
+			pos := start + int64(i)
+			_, _, rs, err := recordHeaderAt(r, pos)
+			if err != nil || pos+rs > end {
+				continue
+			}
+			if next := pos + rs; next == end || incompleteRecord(r, next, end) {
+				return pos
+			} else if _, _, _, err = recordHeaderAt(r, next); err == nil {
+				return pos
+			}
+		}
+	}
+	return end
+}
+
+// recordInWindow position of a record in the last window bytes before end found by nextRecordAt,
+// 0 if the window covers the start of file
+func recordInWindow(r io.ReaderAt, window, end int64) int64 {
+	if start := end - window; start > 0 {
+		return nextRecordAt(r, start, end)
+	}
+	return 0
+}
+
+// tombstoneFlag keeps the flag of a bin file telling readers it has no tombstones, so they need not walk the file
+// for them. The flag is set when the first records written to the file have no tombstone and cleared before any
+// tombstone is written, both holding the file lock. Records appended by other means than writers of this package,
+// such as concatenating with cat, are not noticed, tombstones in them are missed until the flag is cleared.
+type tombstoneFlag struct {
+	checked bool // whether the file was empty is checked
+	cleared bool // flag is cleared for tombstones of this writer
+}
+
+// update flag of file before records are written at its end holding the file lock, tombs if there are tombstones
+func (f *tombstoneFlag) update(file *os.File, tombs bool) error {
+	if tombs {
+		f.checked = true
+		if f.cleared {
+			return nil
+		}
+		if err := clearNoTombstones(file); err != nil {
+			return err
+		}
+		f.cleared = true
+		return nil
+	}
+	if f.checked {
+		return nil
+	}
+	f.checked = true
+	if fileSize(file) != 0 {
+		return nil
+	}
+	f.cleared = false
+	if err := setNoTombstones(file); err != nil {
+		// readers walk the file for tombstones without the flag
+		LogDebug("set no tombstones flag of %s error: %v\n", file.Name(), err)
+	}
+	return nil
+}
+
+// Deleted checks whether document of key at offset is deleted by a later tombstone
+func (t Tombstones) Deleted(key []byte, offset int64) bool {
+	pos, ok := t[string(key)]
+	return ok && pos > offset
+}
+
+// lazyTombstones tombstones of a bin file loaded at the first check, so readers stopping before any document is
+// checked never load them. Tombstones failing to load are logged and no document is deleted.
+type lazyTombstones struct {
+	filename string
+	once     sync.Once
+	tombs    Tombstones
+}
+
+// Deleted checks whether document of key at offset is deleted, false for nil
+func (l *lazyTombstones) Deleted(key []byte, offset int64) bool {
+	if l == nil {
+		return false
+	}
+	l.once.Do(func() {
+		var err error
+		if l.tombs, err = LoadTombstones(l.filename); err != nil {
+			LogError("load tombstones error: %v\n", err)
+		}
+	})
+	return l.tombs.Deleted(key, offset)
+}
+
+// tombstone record of key
+func tombstone(key []byte) *Doc {
+	return &Doc{Key: key, Deleted: true}
+}
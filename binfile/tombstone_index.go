@@ -0,0 +1,182 @@
+package binfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// TombstoneIndexDir directory keeping tombstone indexes of bin files, indexes are not kept if empty
+var TombstoneIndexDir = defaultTombstoneIndexDir()
+
+// SaveTombstoneIndex whether tombstones loaded are saved as an index under TombstoneIndexDir,
+// indexes saved before are used either way
+var SaveTombstoneIndex = false
+
+const (
+	tombstoneIndexMagic = "BINTOMB2"
+	// bytes at the head and before the end of the indexed part checked as well as size and modification time
+	fingerprintSize = 4096
+)
+
+func defaultTombstoneIndexDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "binfiles", "tombstones")
+}
+
+// tombstoneIndex tombstones of the first covered bytes of a bin file of size bytes modified at modTime,
+// covered is at a record boundary
+type tombstoneIndex struct {
+	size        int64
+	modTime     int64
+	covered     int64
+	fingerprint []byte
+	tombs       Tombstones
+}
+
+// tombstoneIndexFile index filename of bin file, named by hash of its absolute path
+func tombstoneIndexFile(filename string) string {
+	if TombstoneIndexDir == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return ""
+	}
+	h := fnv.New128a()
+	_, _ = h.Write([]byte(abs))
+	return filepath.Join(TombstoneIndexDir, hex.EncodeToString(h.Sum(nil))+".idx")
+}
+
+// fileFingerprint hash of the head and the last bytes of the first covered bytes of file
+func fileFingerprint(file io.ReaderAt, covered int64) ([]byte, error) {
+	h := fnv.New128a()
+	n := int64(fingerprintSize)
+	if n > covered {
+		n = covered
+	}
+	if _, err := io.Copy(h, io.NewSectionReader(file, 0, n)); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(h, io.NewSectionReader(file, covered-n, n)); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// loadTombstoneIndex index of bin file, an empty one if there is no index or the file is changed since saved
+func loadTombstoneIndex(filename string, file io.ReaderAt, stat os.FileInfo) *tombstoneIndex {
+	empty := &tombstoneIndex{tombs: make(Tombstones)}
+	name := tombstoneIndexFile(filename)
+	if name == "" {
+		return empty
+	}
+	in, err := os.Open(name)
+	if err != nil {
+		return empty
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	idx, err := readTombstoneIndex(bufio.NewReader(in))
+	if err != nil {
+		LogDebug("invalid tombstone index %s of %s: %v\n", name, filename, err)
+		return empty
+	}
+	if idx.size != stat.Size() || idx.modTime != stat.ModTime().UnixNano() || idx.covered > idx.size {
+		return empty
+	}
+	if fp, err := fileFingerprint(file, idx.covered); err != nil || !bytes.Equal(fp, idx.fingerprint) {
+		return empty
+	}
+	return idx
+}
+
+func readTombstoneIndex(r io.Reader) (*tombstoneIndex, error) {
+	magic := make([]byte, len(tombstoneIndexMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != tombstoneIndexMagic {
+		return nil, ErrInvalidDocument
+	}
+	idx := &tombstoneIndex{fingerprint: make([]byte, 16), tombs: make(Tombstones)}
+	for _, v := range []*int64{&idx.size, &idx.modTime, &idx.covered} {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := io.ReadFull(r, idx.fingerprint); err != nil {
+		return nil, err
+	}
+	for {
+		var pos int64
+		if err := binary.Read(r, binary.LittleEndian, &pos); err == io.EOF {
+			return idx, nil
+		} else if err != nil {
+			return nil, err
+		}
+		var keySize int32
+		if err := binary.Read(r, binary.LittleEndian, &keySize); err != nil {
+			return nil, err
+		}
+		if keySize < 0 || keySize > KeySizeLimit {
+			return nil, ErrReadKey
+		}
+		key := make([]byte, keySize)
+		if _, err := io.ReadFull(r, key); err != nil {
+			return nil, err
+		}
+		idx.tombs[string(key)] = pos
+	}
+}
+
+// save index of file replacing the old one
+func (idx *tombstoneIndex) save(filename string, file io.ReaderAt, stat os.FileInfo) (err error) {
+	name := tombstoneIndexFile(filename)
+	if name == "" {
+		return nil
+	}
+	idx.size, idx.modTime = stat.Size(), stat.ModTime().UnixNano()
+	if idx.fingerprint, err = fileFingerprint(file, idx.covered); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	out, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(out.Name())
+		}
+	}()
+	w := bufio.NewWriter(out)
+	_, _ = w.WriteString(tombstoneIndexMagic)
+	_ = binary.Write(w, binary.LittleEndian, []int64{idx.size, idx.modTime, idx.covered})
+	_, _ = w.Write(idx.fingerprint)
+	for key, pos := range idx.tombs {
+		_ = binary.Write(w, binary.LittleEndian, pos)
+		_ = binary.Write(w, binary.LittleEndian, int32(len(key)))
+		_, _ = w.WriteString(key)
+	}
+	err = w.Flush()
+	if er := out.Close(); err == nil {
+		err = er
+	}
+	if err != nil {
+		return err
+	}
+	// replaced at once so concurrent loaders never read a partial index
+	return os.Rename(out.Name(), name)
+}
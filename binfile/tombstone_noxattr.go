@@ -0,0 +1,21 @@
+//go:build !darwin && !freebsd && !linux && !netbsd
+
+package binfile
+
+import (
+	"os"
+)
+
+// extended attributes are not supported, tombstones are always loaded
+
+func setNoTombstones(file *os.File) error {
+	return nil
+}
+
+func clearNoTombstones(file *os.File) error {
+	return nil
+}
+
+func hasNoTombstones(file *os.File) bool {
+	return false
+}
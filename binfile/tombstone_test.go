@@ -0,0 +1,355 @@
+package binfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// keep tombstone indexes of test files out of the user cache
+	dir, err := os.MkdirTemp("", "tombstone-index")
+	if err != nil {
+		panic(err)
+	}
+	TombstoneIndexDir = dir
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// documents are large enough for seeking windows of parallel counting to slide
+var testTombstonePadding = strings.Repeat(".", 1500)
+
+func writeTestTombstones(t *testing.T, filename string) {
+	if err := writeTestDocs(filename, NONE,
+		&Doc{Key: []byte("a"), Content: []byte("a1" + testTombstonePadding)},
+		&Doc{Key: []byte("b"), Content: []byte("b1" + testTombstonePadding)},
+		&Doc{Key: []byte("c"), Content: []byte("c1" + testTombstonePadding)},
+	); err != nil {
+		t.Fatal(err)
+	}
+	bw := NewBinWriter(filename, NONE)
+	if err := bw.Open(); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b"} {
+		if _, err := bw.Delete([]byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = bw.Close()
+	// a is written again after deleted
+	if err := writeTestDocs(filename, NONE, &Doc{Key: []byte("a"), Content: []byte("a2" + testTombstonePadding)}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testDocContents(docs []*Doc) string {
+	s := ""
+	for _, doc := range docs {
+		if doc.Deleted {
+			s += "-" + string(doc.Key) + " "
+		} else {
+			s += strings.TrimRight(string(doc.Content), ".") + " "
+		}
+	}
+	return s
+}
+
+func TestTombstones(t *testing.T) {
+	root := getTestDir("tombstones")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+	writeTestTombstones(t, filename)
+
+	if s := testDocContents(readTestDocs(t, filename, NONE)); s != "c1 a2 " {
+		t.Errorf("unexpected live docs %s", s)
+	}
+	cases := []struct {
+		opt      IterOption
+		expected string
+	}{
+		{IterOption{End: -1, ShowDeleted: true}, "a1 b1 c1 a2 "},
+		{IterOption{End: -1, ShowTombstones: true}, "c1 -a -b a2 "},
+		{IterOption{End: -1, ShowDeleted: true, ShowTombstones: true}, "a1 b1 c1 -a -b a2 "},
+	}
+	for _, c := range cases {
+		it, err := NewDocIterator(filename, NONE, &c.opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var docs []*Doc
+		for it.Next() {
+			docs = append(docs, it.Doc())
+		}
+		it.Close()
+		if it.Err() != nil {
+			t.Fatal(it.Err())
+		}
+		if s := testDocContents(docs); s != c.expected {
+			t.Errorf("option %+v: expect %s, got %s", c.opt, c.expected, s)
+		}
+	}
+
+	rd, err := NewBinReader(filename, NONE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+	for _, workers := range []int{1, 3} {
+		if count := rd.Count(&CountOption{End: -1, WorkerCount: workers}); count != 2 {
+			t.Errorf("%d workers: expect 2 live docs counted, got %d", workers, count)
+		}
+		if count := rd.Count(&CountOption{End: -1, WorkerCount: workers, Deleted: true}); count != 4 {
+			t.Errorf("%d workers: expect 4 docs counted with deleted, got %d", workers, count)
+		}
+	}
+	bounds, err := docRanges(filename, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ranges start at record boundaries, tombstones included
+	starts := map[int64]bool{}
+	for pos := int64(0); pos < fileSize(rd.(*binReader).file); {
+		starts[pos] = true
+		size, err := recordSizeAt(rd.(*binReader).file, pos)
+		if err != nil {
+			t.Fatalf("record size at %d error: %v", pos, err)
+		}
+		pos += size
+	}
+	for _, bound := range bounds[:len(bounds)-1] {
+		if !starts[bound] {
+			t.Errorf("range bound %d is not a record boundary: %v", bound, bounds)
+		}
+	}
+}
+
+func TestMergeTombstones(t *testing.T) {
+	root := getTestDir("tombstones-merge")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	first := filepath.Join(root, "first.bin")
+	second := filepath.Join(root, "second.bin")
+	if err := writeTestDocs(first, NONE,
+		&Doc{Key: []byte("b"), Content: []byte("b0")},
+		&Doc{Key: []byte("d"), Content: []byte("d0")},
+	); err != nil {
+		t.Fatal(err)
+	}
+	writeTestTombstones(t, second)
+
+	// tombstones of the second file delete documents of the first one
+	output := filepath.Join(root, "merged.bin")
+	if _, err := Merge(&MergeOption{Inputs: []string{first, second}, Output: output, SourceCompress: NONE, TargetCompress: NONE}); err != nil {
+		t.Fatal(err)
+	}
+	if s := testDocContents(readTestDocs(t, output, NONE)); s != "d0 c1 a2 " {
+		t.Errorf("unexpected merged docs %s", s)
+	}
+
+	// with dedupe, documents of keys deleted by former inputs are dropped,
+	// while rewritten after deleted in the same input are kept
+	deduped := filepath.Join(root, "deduped.bin")
+	if _, err := Merge(&MergeOption{Inputs: []string{second, first}, Output: deduped, SourceCompress: NONE, TargetCompress: NONE, Dedupe: true}); err != nil {
+		t.Fatal(err)
+	}
+	if s := testDocContents(readTestDocs(t, deduped, NONE)); s != "c1 a2 d0 " {
+		t.Errorf("unexpected deduped docs %s", s)
+	}
+
+	// tombstones of later inputs are written, so documents of former inputs are deleted
+	_ = os.Remove(deduped)
+	if _, err := Merge(&MergeOption{Inputs: []string{first, second}, Output: deduped, SourceCompress: NONE, TargetCompress: NONE, Dedupe: true}); err != nil {
+		t.Fatal(err)
+	}
+	if s := testDocContents(readTestDocs(t, deduped, NONE)); s != "d0 c1 a2 " {
+		t.Errorf("unexpected deduped docs %s", s)
+	}
+	// documents of newer inputs win over tombstones of older ones
+	newest := filepath.Join(root, "newest.bin")
+	older := time.Now().Add(-time.Hour)
+	_ = os.Chtimes(second, older, older)
+	if _, err := Merge(&MergeOption{Inputs: []string{first, second}, Output: newest, SourceCompress: NONE, TargetCompress: NONE, NewestWins: true}); err != nil {
+		t.Fatal(err)
+	}
+	if s := testDocContents(readTestDocs(t, newest, NONE)); s != "b0 d0 c1 a2 " {
+		t.Errorf("unexpected newest docs %s", s)
+	}
+}
+
+func TestLoadTombstones(t *testing.T) {
+	root := getTestDir("tombstones-load")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	filename := filepath.Join(root, "docs.bin")
+	deleteKeys := func(keys ...string) {
+		bw := NewBinWriter(filename, NONE)
+		if err := bw.Open(); err != nil {
+			t.Fatal(err)
+		}
+		defer bw.Close()
+		for _, key := range keys {
+			if _, err := bw.Delete([]byte(key)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := writeTestDocs(filename, NONE,
+		&Doc{Key: []byte("a"), Content: []byte("a1")},
+		&Doc{Key: []byte("b"), Content: []byte("b1")},
+	); err != nil {
+		t.Fatal(err)
+	}
+	// invalid bytes before tombstone of b
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = file.Write([]byte{0xff, 0xff, 0xff, 0x7f, 'x', 'y', 'z'})
+	_ = file.Close()
+	deleteKeys("b")
+
+	// index is saved only on request
+	tombs, err := LoadTombstones(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tombs["b"]; !ok || len(tombs) != 1 {
+		t.Fatalf("expect tombstone of b after invalid bytes, got %v", tombs)
+	}
+	if _, err = os.Stat(tombstoneIndexFile(filename)); !os.IsNotExist(err) {
+		t.Fatalf("expect no tombstone index saved, got %v", err)
+	}
+	SaveTombstoneIndex = true
+	defer func() {
+		SaveTombstoneIndex = false
+	}()
+	if _, err = LoadTombstones(filename); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(tombstoneIndexFile(filename)); err != nil {
+		t.Fatalf("tombstone index not saved: %v", err)
+	}
+
+	// records appended are loaded
+	deleteKeys("a")
+	if tombs, err = LoadTombstones(filename); err != nil {
+		t.Fatal(err)
+	}
+	if len(tombs) != 2 || tombs["a"] <= tombs["b"] {
+		t.Fatalf("expect tombstones of b and a, got %v", tombs)
+	}
+	if file, err = os.Open(filename); err != nil {
+		t.Fatal(err)
+	}
+	stat, _ := file.Stat()
+	idx := loadTombstoneIndex(filename, file, stat)
+	_ = file.Close()
+	if idx.covered != stat.Size() || len(idx.tombs) != 2 {
+		t.Errorf("expect index of %d bytes with 2 tombstones, got %d bytes with %v", stat.Size(), idx.covered, idx.tombs)
+	}
+
+	// index of a file rewritten in the middle with the same size is not used
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := strings.LastIndex(string(data), "a")
+	data[i] = 'c'
+	if err = os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := stat.ModTime().Add(time.Second)
+	_ = os.Chtimes(filename, later, later)
+	if tombs, err = LoadTombstones(filename); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tombs["c"]; !ok || len(tombs) != 2 {
+		t.Errorf("expect tombstones of b and c in rewritten file, got %v", tombs)
+	}
+
+	// index of a file replaced is not used
+	if err = os.Remove(filename); err != nil {
+		t.Fatal(err)
+	}
+	if err = writeTestDocs(filename, NONE, &Doc{Key: []byte("c"), Content: []byte("c1")}); err != nil {
+		t.Fatal(err)
+	}
+	if tombs, err = LoadTombstones(filename); err != nil {
+		t.Fatal(err)
+	}
+	if len(tombs) != 0 {
+		t.Errorf("expect no tombstones in rewritten file, got %v", tombs)
+	}
+	if _, err = LoadTombstones(filepath.Join(root, "missing.bin")); err == nil {
+		t.Error("expect error loading tombstones of missing file")
+	}
+}
+
+func TestNoTombstonesFlag(t *testing.T) {
+	root := getTestDir("tombstones-flag")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	flagged := func(filename string) bool {
+		file, err := os.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		return hasNoTombstones(file)
+	}
+	live := filepath.Join(root, "live.bin")
+	if err := writeTestDocs(live, NONE, &Doc{Key: []byte("a"), Content: []byte("a1")}); err != nil {
+		t.Fatal(err)
+	}
+	if !flagged(live) {
+		t.Skip("no tombstones flag is not supported")
+	}
+
+	// flag is cleared before tombstones are written by batches
+	deleted := filepath.Join(root, "deleted.bin")
+	bw := NewBatchWriter(deleted, NONE, 0)
+	if err := bw.Open(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = bw.Write(&Doc{Key: []byte("b"), Content: []byte("b1")})
+	if err := bw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !flagged(deleted) {
+		t.Error("expect batch file without tombstones flagged")
+	}
+	_, _ = bw.Delete([]byte("b"))
+	if err := bw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if flagged(deleted) {
+		t.Error("expect flag cleared for tombstones")
+	}
+	if tombs, err := LoadTombstones(deleted); err != nil || len(tombs) != 1 {
+		t.Errorf("expect tombstone of b, got %v %v", tombs, err)
+	}
+
+	// files concatenated keep the flag only if none has tombstones
+	concat := filepath.Join(root, "concat.bin")
+	if _, err := FilesConcat(concat, live); err != nil {
+		t.Fatal(err)
+	}
+	if !flagged(concat) {
+		t.Error("expect concatenated file without tombstones flagged")
+	}
+	if _, err := FilesConcat(concat, deleted); err != nil {
+		t.Fatal(err)
+	}
+	if flagged(concat) {
+		t.Error("expect flag cleared for tombstones concatenated")
+	}
+	if tombs, err := LoadTombstones(concat); err != nil || len(tombs) != 1 {
+		t.Errorf("expect tombstone of b concatenated, got %v %v", tombs, err)
+	}
+}
@@ -0,0 +1,29 @@
+//go:build darwin || freebsd || linux || netbsd
+
+package binfile
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// noTombstonesAttr extended attribute set on bin files which have no tombstones
+const noTombstonesAttr = "user.binfiles.notombstones"
+
+func setNoTombstones(file *os.File) error {
+	return unix.Fsetxattr(int(file.Fd()), noTombstonesAttr, nil, 0)
+}
+
+func clearNoTombstones(file *os.File) error {
+	if !hasNoTombstones(file) {
+		return nil
+	}
+	return unix.Fremovexattr(int(file.Fd()), noTombstonesAttr)
+}
+
+// hasNoTombstones false if the attribute is not set or not supported
+func hasNoTombstones(file *os.File) bool {
+	_, err := unix.Fgetxattr(int(file.Fd()), noTombstonesAttr, nil)
+	return err == nil
+}
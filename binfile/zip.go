@@ -0,0 +1,125 @@
+package binfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/skiloop/binfiles/workers"
+)
+
+// ErrStopZipWalk can be returned by the handler to stop walking without error.
+var ErrStopZipWalk = errors.New("stop zip walk")
+
+var (
+	zipMagic      = []byte("PK\x03\x04")
+	zipEmptyMagic = []byte("PK\x05\x06")
+)
+
+// IsZipFile checks whether file is a zip archive by its magic header
+func IsZipFile(filename string) bool {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	magic := make([]byte, 4)
+	if _, err = io.ReadFull(file, magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, zipMagic) || bytes.Equal(magic, zipEmptyMagic)
+}
+
+// WalkZip invokes handler for each entry of zip archive in the order of the central directory.
+// The reader passed to handler is closed when handler returns.
+//
+// Return ErrStopZipWalk from handler to stop iteration early without error.
+func WalkZip(filename string, handler func(f *zip.File, r io.Reader) error) error {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = zr.Close()
+	}()
+	for _, f := range zr.File {
+		if err = walkZipEntry(f, handler); err != nil {
+			if errors.Is(err, ErrStopZipWalk) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func walkZipEntry(f *zip.File, handler func(f *zip.File, r io.Reader) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	return handler(f, rc)
+}
+
+func packageZip(option *PackageOption, bw BinWriter, ch, stop chan any, pattern *regexp.Regexp, keys *keyDeriver) (err error) {
+	LogDebug("package zip file\n")
+	workers.RunJobs(option.WorkerCount, stop, func(no int) {
+		packageWorker(ch, no, bw)
+	}, func() {
+		zipSeeder(option, ch, stop, pattern, keys)
+	})
+	LogInfo("package done\n")
+	return nil
+}
+
+func zipSeeder(option *PackageOption, ch, stop chan any, pattern *regexp.Regexp, keys *keyDeriver) {
+	LogInfo("seeder from %s starts\n", option.Path)
+	defer func() {
+		LogDebug("seeder stops\n")
+		ch <- nil
+	}()
+	buf := GlobalMemoryPool.GetCompressorBuffer()
+	defer GlobalMemoryPool.PutCompressorBuffer(buf)
+	err := WalkZip(option.Path, func(f *zip.File, r io.Reader) error {
+		if f.FileInfo().IsDir() {
+			LogDebug("skip directory %s\n", f.Name)
+			return nil
+		}
+		if pattern != nil && !pattern.MatchString(filepath.Base(f.Name)) {
+			LogDebug("skip %s\n", f.Name)
+			return nil
+		}
+		content, err := readAll(r, option.InputCompress, buf)
+		if err != nil {
+			// a broken entry should not stop the others
+			LogError("read zip entry %s error: %v\n", f.Name, err)
+			return nil
+		}
+		doc, err := keys.doc(f.Name, content)
+		if err != nil {
+			LogError("key of %s error: %v\n", f.Name, err)
+			return nil
+		}
+		if option.Attrs {
+			doc.Attrs = fileAttrs(f.Modified, f.Mode(), int64(f.UncompressedSize64), option.InputCompress)
+		}
+		select {
+		case ch <- doc:
+			return nil
+		case <-stop:
+			return errWorkersStopped
+		}
+	})
+	if err != nil && !errors.Is(err, errWorkersStopped) {
+		LogError("walk zip file error: %v\n", err)
+	}
+}
@@ -0,0 +1,70 @@
+package binfile
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func writeTestZip(filename string, entries map[string][]byte) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	zw := zip.NewWriter(file)
+	if _, err = zw.Create("dir/"); err != nil {
+		return err
+	}
+	for name, content := range entries {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func TestPackageZip(t *testing.T) {
+	root := getTestDir("zip")
+	_ = os.MkdirAll(root, 0755)
+	defer os.RemoveAll(root)
+	a, _ := Compress([]byte("content a"), GZIP)
+	b, _ := Compress([]byte("content b"), GZIP)
+	c, _ := Compress([]byte("content c"), GZIP)
+	src := filepath.Join(root, "src.zip")
+	err := writeTestZip(src, map[string][]byte{
+		"a.json":     a,
+		"dir/b.json": b,
+		"dir/c.txt":  c,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsZipFile(src) {
+		t.Fatal("expect zip file detected")
+	}
+	dst := filepath.Join(root, "dst.bin")
+	opt := &PackageOption{Path: src, WorkerCount: 2, InputCompress: GZIP, Pattern: `\.json$`, KeyStrategy: KeyRelative}
+	if err = Package(opt, NewBinWriter(dst, NONE)); err != nil {
+		t.Fatal(err)
+	}
+	docs := readTestDocs(t, dst, NONE)
+	sort.Slice(docs, func(i, j int) bool {
+		return string(docs[i].Key) < string(docs[j].Key)
+	})
+	expected := [][2]string{{"a.json", "content a"}, {"dir/b.json", "content b"}}
+	if len(docs) != len(expected) {
+		t.Fatalf("expect %d docs, got %d", len(expected), len(docs))
+	}
+	for i, e := range expected {
+		if string(docs[i].Key) != e[0] || string(docs[i].Content) != e[1] {
+			t.Errorf("doc %d: expect %s=%s, got %s=%s", i, e[0], e[1], docs[i].Key, docs[i].Content)
+		}
+	}
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
 	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/alecthomas/kong"
 
@@ -15,6 +21,8 @@ import (
 
 type ListCmd struct {
 	KeyOnly   bool   `short:"k" help:"list key only" default:"false"`
+	Attrs     bool   `short:"a" help:"show document attributes" default:"false"`
+	Deleted   bool   `help:"show deleted documents and tombstones" default:"false"`
 	SkipError bool   `help:"skip error docs and continue reading" default:"false"`
 	Limit     int32  `short:"l" help:"limit of list number, 0 means unlimited" default:"0"`
 	Input     string `arg:"" help:"input file name"`
@@ -22,17 +30,24 @@ type ListCmd struct {
 }
 
 type ReadCmd struct {
-	SkipError bool   `help:"skip error docs and continue reading" default:"false"`
-	Limit     int32  `short:"l" help:"number of documents to read, 0 means read all" default:"1"`
-	Input     string `arg:"" help:"input file name"`
-	Offset    int64  `arg:"" optional:"" help:"start position" default:"0"`
-	Output    string `short:"o" help:"output file name, empty to std output" default:""`
-	OutType   string `short:"c" help:"output compression type, only works when output not empty" enum:"gzip,bz2,xz,br,brotli,lz4,none" default:"none"`
+	Follow     bool          `short:"f" help:"wait for documents appended at the end of file and print them, output, limit, lock, committed and key pattern are not supported" default:"false"`
+	Interval   time.Duration `help:"interval of polling for appended documents in follow mode" default:"1s"`
+	OffsetFile string        `help:"file saving the position of follow mode, reading resumes from it" default:""`
+	SkipError  bool          `help:"skip error docs and continue reading" default:"false"`
+	Deleted    bool          `help:"read deleted documents as well" default:"false"`
+	Lock       bool          `help:"take a shared lock of file and read documents written before it, writers locking file are waited" default:"false"`
+	Committed  bool          `help:"read only documents completely written when reading starts, a trailing half written one is not read" default:"false"`
+	Limit      int32         `short:"l" help:"number of documents to read, 0 means read all" default:"1"`
+	Input      string        `arg:"" help:"input file name"`
+	Offset     int64         `arg:"" optional:"" help:"start position" default:"0"`
+	Output     string        `short:"o" help:"output file name, empty to std output" default:""`
+	OutType    string        `short:"c" help:"output compression type, only works when output not empty" enum:"gzip,bz2,xz,br,brotli,lz4,none" default:"none"`
 }
 
 type CountCmd struct {
 	KeyOnly     bool   `short:"k" help:"count without decode content" default:"false"`
 	SkipError   bool   `help:"skip error docs and continue reading" default:"false"`
+	Deleted     bool   `help:"count deleted documents as well" default:"false"`
 	WorkerCount int    `short:"w" help:"number of workers, when 0 or negative number of system processors will be used" default:"0"`
 	Input       string `arg:"" help:"input file name"`
 	Offset      int64  `arg:"" optional:"" help:"start position" default:"0"`
@@ -40,11 +55,67 @@ type CountCmd struct {
 }
 
 type SearchCmd struct {
-	NoSkipError bool   `help:"continue searching when encounter invalid doc" default:"false"`
-	Pretty      bool   `short:"p" help:"value is a json, and pretty output when found" default:"false"`
+	NoSkipError bool     `help:"continue searching when encounter invalid doc" default:"false"`
+	Pretty      bool     `short:"p" help:"value is a json, and pretty output when found" default:"false"`
+	All         bool     `short:"a" help:"print offsets and keys of all matches instead of the first document" default:"false"`
+	Content     bool     `help:"print content of matches as well, implies all" default:"false"`
+	CountOnly   bool     `short:"c" help:"print number of matches only, implies all" default:"false"`
+	Invert      bool     `help:"select documents with keys not matching, implies all" default:"false"`
+	Limit       int64    `short:"l" help:"max number of matches, 0 means unlimited" default:"0"`
+	Patterns    []string `short:"e" help:"more key patterns, documents matching any pattern are selected, implies all"`
+	PatternFile string   `short:"f" help:"file of key patterns one per line, implies all" default:""`
+	WorkerCount int      `short:"w" help:"number of workers for all matches, when 0 or negative number of system processors will be used" default:"0"`
+	Input       string   `arg:"" help:"input file name"`
+	Key         string   `arg:"" optional:"" help:"key to search, regex supported"`
+	Offset      int64    `arg:"" optional:"" help:"position to search from" default:"0"`
+}
+
+// all matches are searched
+func (c *SearchCmd) all() bool {
+	return c.All || c.Content || c.CountOnly || c.Invert || len(c.Patterns) > 0 || c.PatternFile != ""
+}
+
+type GrepCmd struct {
+	IgnoreCase  bool   `short:"i" help:"match content case-insensitively" default:"false"`
+	Context     int    `short:"C" help:"bytes of content printed around each match" default:"20"`
+	MaxMatches  int    `short:"m" help:"max matches printed of each document, 0 means all" default:"0"`
+	CountOnly   bool   `short:"c" help:"print number of matched documents only" default:"false"`
+	Limit       int64  `short:"l" help:"max number of matched documents, 0 means unlimited" default:"0"`
+	NoSkipError bool   `help:"stop at invalid doc instead of seeking for next one" default:"false"`
+	WorkerCount int    `short:"w" help:"number of workers, when 0 or negative number of system processors will be used" default:"0"`
 	Input       string `arg:"" help:"input file name"`
-	Key         string `arg:"" help:"key to search, regex supported"`
-	Offset      int64  `arg:"" optional:"" help:"position to search from" default:"0"`
+	Pattern     string `arg:"" help:"content regex pattern"`
+	Offset      int64  `arg:"" optional:"" help:"position to grep from" default:"0"`
+}
+
+type QueryCmd struct {
+	Fields      []string `short:"f" help:"paths of fields printed, such as .user.name, whole document if not specified"`
+	CountOnly   bool     `short:"c" help:"print number of matched documents only" default:"false"`
+	Limit       int64    `short:"l" help:"max number of matched documents, 0 means unlimited" default:"0"`
+	NoSkipError bool     `help:"stop at invalid doc instead of seeking for next one" default:"false"`
+	WorkerCount int      `short:"w" help:"number of workers, when 0 or negative number of system processors will be used" default:"0"`
+	Input       string   `arg:"" help:"input file name"`
+	Filter      string   `arg:"" optional:"" help:"filter such as '.status == 200 and .lang in [\"en\",\"de\"]', all json documents if empty"`
+}
+
+type PeekCmd struct {
+	Count   int    `short:"n" help:"number of documents" default:"10"`
+	KeyOnly bool   `short:"k" help:"print offsets and keys only" default:"false"`
+	Input   string `arg:"" help:"input file name"`
+}
+
+type SampleCmd struct {
+	Count   int    `short:"n" help:"number of documents" default:"10"`
+	Seed    int64  `help:"seed of random sampling, same samples with the same seed, random if 0" default:"0"`
+	KeyOnly bool   `short:"k" help:"print offsets and keys only" default:"false"`
+	Input   string `arg:"" help:"input file name"`
+}
+
+type GetCmd struct {
+	All    bool     `short:"a" help:"print all live documents of each key instead of the latest one" default:"false"`
+	Pretty bool     `short:"p" help:"value is a json, and pretty output" default:"false"`
+	Input  string   `arg:"" help:"input file name"`
+	Keys   []string `arg:"" optional:"" help:"keys to get, read from stdin line by line if not specified"`
 }
 
 type SeekCmd struct {
@@ -54,15 +125,122 @@ type SeekCmd struct {
 
 type PackageCmd struct {
 	WorkerCount       int    `short:"w" help:"number of workers, when 0 or negative number of system processors will be used" default:"0"`
-	Path              string `arg:"" help:"input path or tar file path"`
+	Path              string `arg:"" help:"input path, tar or zip file path"`
 	Output            string `arg:"" help:"output bin file path"`
 	InputCompressType string `short:"c" help:"input file compression type" enum:"gzip,bz2,xz,br,brotli,lz4,none" default:"none"`
 	TarCompressType   string `short:"t" help:"tar file compression type" enum:"gzip,bz2,xz,br,brotli,lz4,none" default:"gzip"`
 	Pattern           string `short:"p" help:"source file pattern, the matched will be packaged, all files package if empty" default:""`
+	KeyStrategy       string `short:"k" help:"how keys are derived from files" enum:"base,relative,full,strip-ext,regex,hash" default:"base"`
+	KeyRegex          string `help:"regex for regex key strategy, the first capture group is used as key" default:""`
+	Attrs             bool   `short:"a" help:"keep mtime, mode, size and compression of files as document attributes" default:"false"`
+	FullPath          bool   `help:"use full path of files and tar entries as key, same as --key-strategy full" default:"false"`
+	Recursive         bool   `short:"r" help:"package files in sub directories too" default:"false"`
 }
 type VersionCmd struct {
 }
 
+type SplitCmd struct {
+	Size              int64  `short:"b" help:"max bytes of each output file" default:"0"`
+	Count             int64  `short:"n" help:"max number of documents of each output file" default:"0"`
+	Shards            int    `help:"number of output files, documents are placed by key hash" default:"0"`
+	WorkerCount       int    `short:"w" help:"number of workers for shards, when 0 or negative number of system processors will be used" default:"0"`
+	InputCompressType string `short:"i" help:"input document compression type" enum:"gzip,bz2,xz,br,brotli,lz4,none" default:"gzip"`
+	PackageType       string `short:"c" help:"package compression type of output files" enum:"gzip,bz2,xz,br,brotli,lz4,none" default:"none"`
+	Input             string `arg:"" help:"input bin file"`
+	Target            string `arg:"" help:"output file prefix, output files are named as target.N"`
+}
+
+type SortCmd struct {
+	Memory      int64  `short:"m" help:"memory limit in MB for documents held in memory" default:"256"`
+	WorkerCount int    `short:"w" help:"number of workers, when 0 or negative number of system processors will be used" default:"0"`
+	TempDir     string `short:"T" help:"directory for temporary files, system temp directory if empty" default:""`
+	Input       string `arg:"" help:"input bin file"`
+	Output      string `arg:"" help:"output bin file"`
+}
+
+type CompactCmd struct {
+	Sort              bool   `help:"write documents in key order instead of the original order" default:"false"`
+	Memory            int64  `short:"m" help:"memory limit in MB for documents or keys held in memory while sorting" default:"256"`
+	WorkerCount       int    `short:"w" help:"number of workers, when 0 or negative number of system processors will be used" default:"0"`
+	TempDir           string `short:"T" help:"directory for temporary files, system temp directory if empty" default:""`
+	InputCompressType string `short:"i" help:"input document compression type" enum:"gzip,bz2,xz,br,brotli,lz4,none" default:"gzip"`
+	PackageType       string `short:"c" help:"package compression type of output file" enum:"gzip,bz2,xz,br,brotli,lz4,none" default:"none"`
+	Input             string `arg:"" help:"input bin file"`
+	Output            string `arg:"" help:"output bin file"`
+}
+
+type DiffCmd struct {
+	Format      string `short:"f" help:"output format" enum:"text,jsonl" default:"text"`
+	Raw         bool   `help:"compare stored content without decompressing" default:"false"`
+	CompressA   string `help:"document compression type of the first file, auto to detect" enum:"auto,gzip,bz2,xz,br,brotli,lz4,none" default:"auto"`
+	CompressB   string `help:"document compression type of the second file, auto to detect" enum:"auto,gzip,bz2,xz,br,brotli,lz4,none" default:"auto"`
+	Partitions  int    `help:"number of key hash partitions held in memory one at a time, by memory limit if 0" default:"0"`
+	Memory      int64  `short:"m" help:"memory limit in MB for keys and hashes held in memory, used when partitions is 0" default:"256"`
+	WorkerCount int    `short:"w" help:"number of workers, when 0 or negative number of system processors will be used" default:"0"`
+	TempDir     string `short:"T" help:"directory for temporary files, system temp directory if empty" default:""`
+	A           string `arg:"" help:"first bin file"`
+	B           string `arg:"" help:"second bin file"`
+}
+
+type StatsCmd struct {
+	Json        bool   `short:"j" help:"output as json" default:"false"`
+	KeyOnly     bool   `short:"k" help:"do not decompress documents" default:"false"`
+	Top         int    `short:"t" help:"number of largest documents and key prefixes" default:"10"`
+	PrefixLen   int    `help:"key prefix length in bytes" default:"4"`
+	PrefixSep   string `help:"key prefix separator, the part of key before the first separator is used as prefix" default:""`
+	WorkerCount int    `short:"w" help:"number of workers, when 0 or negative number of system processors will be used" default:"0"`
+	Input       string `arg:"" help:"input bin file"`
+}
+
+type ExtractCmd struct {
+	OutType     string `short:"c" help:"compression type of extracted files" enum:"gzip,bz2,xz,br,brotli,lz4,none" default:"none"`
+	Collision   string `help:"what to do when file exists" enum:"rename,overwrite,skip" default:"rename"`
+	WorkerCount int    `short:"w" help:"number of workers, when 0 or negative number of system processors will be used" default:"0"`
+	Input       string `arg:"" help:"input bin file"`
+	Output      string `arg:"" help:"output directory"`
+}
+
+type ToTarCmd struct {
+	Raw    bool   `help:"write document content as is without decompression" default:"false"`
+	Input  string `arg:"" help:"input bin file"`
+	Output string `arg:"" help:"output tar file, compressed by suffix .gz, .tgz, .xz or .bz2"`
+}
+
+type ExportCmd struct {
+	Format string `short:"f" help:"output format, use to-tar for tar archives" enum:"jsonl" default:"jsonl"`
+	Exact  bool   `help:"keep content byte for byte, json content not compact is exported as a string" default:"false"`
+	Input  string `arg:"" help:"input bin file"`
+	Output string `arg:"" optional:"" help:"output file, stdout if not specified"`
+}
+
+type ImportCmd struct {
+	KeyField     string        `help:"dot separated path of key field" default:"key"`
+	ContentField string        `help:"dot separated path of content field, whole line is used if empty" default:"content"`
+	SkipInvalid  bool          `help:"skip invalid lines instead of abort" default:"false"`
+	BatchSize    int           `help:"write documents in batches of this many bytes, locking file once a batch for concurrent importers, 0 to write one by one" default:"0"`
+	RotateSize   int64         `help:"rotate output file once it reaches this many bytes, output is a pattern with {seq} or {time} then" default:"0"`
+	RotateCount  int64         `help:"rotate output file once it has this many documents" default:"0"`
+	RotateAge    time.Duration `help:"rotate output file this long after it is opened" default:"0"`
+	PackageType  string        `help:"package compression type of rotated files, compressed in background" enum:"gzip,bz2,xz,br,brotli,lz4,none" default:"none"`
+	Manifest     string        `help:"json lines file listing rotated files" default:""`
+	Output       string        `arg:"" help:"output bin file path, or pattern of rotated files like data-{time}-{seq}.bin"`
+	Input        string        `arg:"" optional:"" help:"input json lines file, stdin if not specified or -"`
+}
+
+type MergeCmd struct {
+	Dedupe            bool     `short:"u" help:"keep only the first document of the same key" default:"false"`
+	NewestWins        bool     `short:"n" help:"resolve key conflicts by keeping the document from the newest file" default:"false"`
+	SkipInvalid       bool     `help:"skip invalid input files instead of abort" default:"false"`
+	InputCompressType string   `short:"i" help:"input document compression type, auto to detect for each file" enum:"auto,gzip,bz2,xz,br,brotli,lz4,none" default:"auto"`
+	Output            string   `arg:"" help:"output bin file path"`
+	Inputs            []string `arg:"" help:"input bin files"`
+}
+
+type DeleteCmd struct {
+	File string   `arg:"" help:"bin file path"`
+	Keys []string `arg:"" help:"keys of documents to delete"`
+}
+
 type ListTarCmd struct {
 	Limit  int32  `short:"l" help:"limit of list number, 0 means unlimited" default:"0"`
 	Input  string `arg:"" help:"input file name"`
@@ -70,22 +248,45 @@ type ListTarCmd struct {
 }
 
 var client struct {
-	Verbose      bool              `short:"v" help:"verbose" default:"false"`
-	Debug        bool              `short:"d" help:"debug" default:"false"`
-	KeySizeLimit int32             `short:"L" help:"max size of document key in bytes" default:"1000"`
-	Step         int32             `short:"s" help:"how many docs to skip before next doc is processed, for count command means verbose step" default:"0"`
-	LogLevel     string            `help:"log level" enum:"debug,info,warn,error,fatal" default:"info"`
-	KeyPattern   string            `help:"key regex pattern for key searching" default:""`
-	CompressType string            `short:"z" help:"compression type, none if do not want to compress" enum:"gzip,xz,br,lz4,bz2,none" default:"gzip"`
-	Version      VersionCmd        `cmd:"" help:"print version" default:"withargs"`
-	List         ListCmd           `cmd:"" aliases:"l,ls" help:"List documents from position."`
-	Read         ReadCmd           `cmd:"" aliases:"r,ra" help:"Read documents from position"`
-	Count        CountCmd          `cmd:"" aliases:"c" help:"count document file in bin file from position"`
-	Search       SearchCmd         `cmd:"" aliases:"s" help:"search document by key"`
-	Seek         SeekCmd           `cmd:"" aliases:"k,sk" help:"seek for next document from position"`
-	Package      PackageCmd        `cmd:"" aliases:"p" help:"package files into bin file"`
-	Repack       binfile.RepackCmd `cmd:"" aliases:"a" help:"repack bin file into other bin format"`
-	ListTar      ListTarCmd        `cmd:"" aliases:"t" help:"list tar archive"`
+	Verbose        bool              `short:"v" help:"verbose" default:"false"`
+	Debug          bool              `short:"d" help:"debug" default:"false"`
+	KeySizeLimit   int32             `short:"L" help:"max size of document key in bytes" default:"1000"`
+	Step           int32             `short:"s" help:"how many docs to skip before next doc is processed, for count command means verbose step" default:"0"`
+	LogLevel       string            `help:"log level" enum:"debug,info,warn,error,fatal" default:"info"`
+	KeyPattern     string            `help:"key regex pattern for key searching" default:""`
+	Progress       bool              `short:"P" help:"show progress of long operations" default:"false"`
+	ProgressStep   time.Duration     `help:"interval of progress report" default:"1s"`
+	WriteStats     bool              `help:"print statistics of written documents" default:"false"`
+	WriteStatsJson string            `help:"write statistics of written documents as json to file, - for standard output" default:""`
+	LockTimeout    time.Duration     `help:"max time waiting for the file lock when writing, 0 to wait forever" default:"1m"`
+	TombstoneIndex bool              `help:"save tombstones loaded as an index in the user cache directory, later reads of unchanged files use it" default:"false"`
+	CompressType   string            `short:"z" help:"compression type, none if do not want to compress" enum:"gzip,xz,br,lz4,bz2,none" default:"gzip"`
+	Version        VersionCmd        `cmd:"" help:"print version" default:"withargs"`
+	List           ListCmd           `cmd:"" aliases:"l,ls" help:"List documents from position."`
+	Read           ReadCmd           `cmd:"" aliases:"r,ra" help:"Read documents from position"`
+	Count          CountCmd          `cmd:"" aliases:"c" help:"count document file in bin file from position"`
+	Search         SearchCmd         `cmd:"" aliases:"s" help:"search document by key"`
+	Seek           SeekCmd           `cmd:"" aliases:"k,sk" help:"seek for next document from position"`
+	Get            GetCmd            `cmd:"" aliases:"g" help:"get documents by exact keys"`
+	Head           PeekCmd           `cmd:"" help:"print the first documents"`
+	Tail           PeekCmd           `cmd:"" help:"print the last documents"`
+	Sample         SampleCmd         `cmd:"" help:"print documents sampled at random"`
+	Grep           GrepCmd           `cmd:"" help:"match decompressed content of documents, documents are selected by key pattern as well"`
+	Query          QueryCmd          `cmd:"" aliases:"q" help:"filter json documents by path expressions and print selected fields"`
+	Package        PackageCmd        `cmd:"" aliases:"p" help:"package files, tar or zip archive into bin file"`
+	Repack         binfile.RepackCmd `cmd:"" aliases:"a" help:"repack bin file into other bin format"`
+	ListTar        ListTarCmd        `cmd:"" aliases:"t" help:"list tar archive"`
+	Merge          MergeCmd          `cmd:"" aliases:"m" help:"merge bin files into one"`
+	Split          SplitCmd          `cmd:"" help:"split bin file by size, document count or key hash"`
+	Sort           SortCmd           `cmd:"" help:"sort bin file by key"`
+	Stats          StatsCmd          `cmd:"" help:"analyse documents of bin file"`
+	Extract        ExtractCmd        `cmd:"" aliases:"x" help:"extract documents to files named by keys"`
+	ToTar          ToTarCmd          `cmd:"" help:"export documents as tar archive"`
+	Export         ExportCmd         `cmd:"" help:"export documents as json lines"`
+	Import         ImportCmd         `cmd:"" help:"build bin file from json lines"`
+	Delete         DeleteCmd         `cmd:"" help:"delete documents by appending tombstones"`
+	Compact        CompactCmd        `cmd:"" help:"keep only the latest live document of each key"`
+	Diff           DiffCmd           `cmd:"" help:"compare documents of two bin files by key"`
 }
 
 func newReader(filename string, compress string) binfile.BinReader {
@@ -118,6 +319,8 @@ func listDocs(br binfile.BinReader) {
 		Step:       client.Step,
 		SkipError:  client.List.SkipError,
 		KeyPattern: client.KeyPattern,
+		Attrs:      client.List.Attrs,
+		Deleted:    client.List.Deleted,
 	}
 	br.List(&opt, client.List.KeyOnly)
 }
@@ -132,6 +335,9 @@ func readDocs(br binfile.BinReader) {
 		Output:      client.Read.Output,
 		SkipError:   client.Read.SkipError,
 		KeyPattern:  client.KeyPattern,
+		Deleted:     client.Read.Deleted,
+		Lock:        client.Read.Lock,
+		Committed:   client.Read.Committed,
 	}
 	br.ReadDocs(&opt)
 }
@@ -154,6 +360,7 @@ func countDocs(br binfile.BinReader) {
 		End:         client.Count.End,
 		VerboseStep: step,
 		SkipError:   client.Count.SkipError,
+		Deleted:     client.Count.Deleted,
 	})
 	if count >= 0 {
 		fmt.Printf("%d\n", count)
@@ -203,6 +410,226 @@ func searchDocs(br binfile.BinReader) {
 	_, _ = buf.WriteTo(os.Stdout)
 }
 
+func getDocs() {
+	keys := client.Get.Keys
+	if len(keys) == 0 {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				keys = append(keys, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			binfile.LogError("read keys error: %v\n", err)
+			return
+		}
+	}
+	bkeys := make([][]byte, len(keys))
+	for i, key := range keys {
+		bkeys[i] = []byte(key)
+	}
+	found, err := binfile.GetDocs(client.Get.Input, binfile.CompressTypes[client.CompressType], bkeys,
+		&binfile.GetOption{All: client.Get.All, Decompress: true})
+	if err != nil {
+		binfile.LogError("get error: %v\n", err)
+		return
+	}
+	printed := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if printed[key] {
+			continue
+		}
+		printed[key] = true
+		docs, ok := found[key]
+		if !ok {
+			binfile.LogWarn("document with key %s not found\n", key)
+			continue
+		}
+		for _, f := range docs {
+			if !client.Get.Pretty {
+				fmt.Printf("%10d\t%s\t%s\n", f.Offset, f.Doc.Key, f.Doc.Content)
+				continue
+			}
+			buf, err := JsonPrettify(f.Doc.Content)
+			if err != nil {
+				binfile.LogError("json prettify of %s failed: %v\n", key, err)
+				continue
+			}
+			_, _ = buf.WriteTo(os.Stdout)
+		}
+	}
+}
+
+func searchAllDocs() {
+	var patterns []string
+	if client.Search.Key != "" {
+		patterns = append(patterns, client.Search.Key)
+	}
+	patterns = append(patterns, client.Search.Patterns...)
+	if client.Search.PatternFile != "" {
+		more, err := binfile.ReadPatternFile(client.Search.PatternFile)
+		if err != nil {
+			binfile.LogError("read pattern file error: %v\n", err)
+			return
+		}
+		patterns = append(patterns, more...)
+	}
+	wc := client.Search.WorkerCount
+	if wc <= 0 {
+		wc = runtime.NumCPU()
+	}
+	var handler func(m *binfile.Match) error
+	if !client.Search.CountOnly {
+		handler = func(m *binfile.Match) error {
+			if m.Doc == nil {
+				fmt.Printf("%10d\t%s\n", m.Offset, m.Key)
+				return nil
+			}
+			if !client.Search.Pretty {
+				fmt.Printf("%10d\t%s\t%s\n", m.Offset, m.Key, m.Doc.Content)
+				return nil
+			}
+			fmt.Printf("%10d\t%s\n", m.Offset, m.Key)
+			buf, err := JsonPrettify(m.Doc.Content)
+			if err != nil {
+				binfile.LogError("json prettify of %s failed: %v\n", m.Key, err)
+				return nil
+			}
+			_, err = buf.WriteTo(os.Stdout)
+			return err
+		}
+	}
+	count, err := binfile.SearchAll(client.Search.Input, binfile.CompressTypes[client.CompressType], &binfile.SearchAllOption{
+		Patterns:    patterns,
+		Invert:      client.Search.Invert,
+		Offset:      client.Search.Offset,
+		Limit:       client.Search.Limit,
+		Content:     client.Search.Content,
+		SkipError:   !client.Search.NoSkipError,
+		WorkerCount: wc,
+	}, handler)
+	if err != nil {
+		binfile.LogError("search error: %v\n", err)
+	}
+	if client.Search.CountOnly {
+		fmt.Printf("%d\n", count)
+	}
+}
+
+func grepDocs() {
+	wc := client.Grep.WorkerCount
+	if wc <= 0 {
+		wc = runtime.NumCPU()
+	}
+	// snippets are printed in one line
+	escaper := strings.NewReplacer("\n", "\\n", "\r", "\\r", "\t", "\\t")
+	var handler func(m *binfile.GrepMatch) error
+	if !client.Grep.CountOnly {
+		handler = func(m *binfile.GrepMatch) error {
+			fmt.Printf("%10d\t%s\t%d\t%s\n", m.Offset, m.Key, m.Start, escaper.Replace(string(m.Snippet)))
+			return nil
+		}
+	}
+	count, err := binfile.Grep(client.Grep.Input, binfile.CompressTypes[client.CompressType], &binfile.GrepOption{
+		Pattern:     client.Grep.Pattern,
+		IgnoreCase:  client.Grep.IgnoreCase,
+		KeyPattern:  client.KeyPattern,
+		Context:     client.Grep.Context,
+		MaxMatches:  client.Grep.MaxMatches,
+		Offset:      client.Grep.Offset,
+		Limit:       client.Grep.Limit,
+		SkipError:   !client.Grep.NoSkipError,
+		WorkerCount: wc,
+	}, handler)
+	if err != nil {
+		binfile.LogError("grep error: %v\n", err)
+	}
+	if client.Grep.CountOnly {
+		fmt.Printf("%d\n", count)
+	}
+}
+
+func queryDocs() {
+	wc := client.Query.WorkerCount
+	if wc <= 0 {
+		wc = runtime.NumCPU()
+	}
+	var handler func(m *binfile.Match) error
+	if !client.Query.CountOnly {
+		handler = func(m *binfile.Match) error {
+			fmt.Printf("%10d\t%s\t%s\n", m.Offset, m.Key, m.Doc.Content)
+			return nil
+		}
+	}
+	count, err := binfile.QueryDocs(client.Query.Input, binfile.CompressTypes[client.CompressType], &binfile.QueryOption{
+		Filter:      client.Query.Filter,
+		Fields:      client.Query.Fields,
+		Limit:       client.Query.Limit,
+		SkipError:   !client.Query.NoSkipError,
+		WorkerCount: wc,
+	}, handler)
+	if err != nil {
+		binfile.LogError("query error: %v\n", err)
+	}
+	if client.Query.CountOnly {
+		fmt.Printf("%d\n", count)
+	}
+}
+
+func peekDocs(input string, keyOnly bool, peek func(filename string, compressType int, opt *binfile.PeekOption) ([]binfile.Found, error), opt *binfile.PeekOption) {
+	opt.Decompress = !keyOnly
+	docs, err := peek(input, binfile.CompressTypes[client.CompressType], opt)
+	for _, f := range docs {
+		if keyOnly {
+			fmt.Printf("%10d\t%s\n", f.Offset, f.Doc.Key)
+		} else {
+			fmt.Printf("%10d\t%s\t%s\n", f.Offset, f.Doc.Key, f.Doc.Content)
+		}
+	}
+	if err != nil {
+		binfile.LogError("read %s error: %v\n", input, err)
+	}
+}
+
+// followUnsupported flags of read not working in follow mode
+var followUnsupported = []string{"output", "out-type", "limit", "lock", "committed", "key-pattern"}
+
+func followDocs(kctx *kong.Context) {
+	given := map[string]bool{}
+	for _, p := range kctx.Path {
+		if p.Flag != nil {
+			given[p.Flag.Name] = true
+		}
+	}
+	for _, name := range followUnsupported {
+		if given[name] {
+			binfile.LogError("--%s is not supported in follow mode\n", name)
+			return
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err := binfile.Follow(ctx, client.Read.Input, binfile.CompressTypes[client.CompressType], &binfile.FollowOption{
+		Offset:     client.Read.Offset,
+		OffsetFile: client.Read.OffsetFile,
+		Interval:   client.Read.Interval,
+		Decompress: true,
+	}, func(doc *binfile.Doc, offset int64) error {
+		switch {
+		case doc.Deleted:
+			binfile.LogInfo("%s deleted at %d\n", doc.Key, offset)
+		case binfile.Verbose:
+			fmt.Printf("%-20s\t%s\n", doc.Key, doc.Content)
+		default:
+			fmt.Println(string(doc.Content))
+		}
+		return nil
+	})
+	if err != nil {
+		binfile.LogError("follow error: %v\n", err)
+	}
+}
+
 func seekDoc(br binfile.BinReader) {
 	next, doc := br.Next(&binfile.SeekOption{
 		Offset:     client.Seek.Offset,
@@ -236,6 +663,13 @@ func packageDocs(bw binfile.BinWriter) {
 		InputCompress: ct,
 		TarCompress:   client.Package.TarCompressType,
 		WorkerCount:   client.Package.WorkerCount,
+		KeyStrategy:   client.Package.KeyStrategy,
+		KeyRegex:      client.Package.KeyRegex,
+		Attrs:         client.Package.Attrs,
+		Recursive:     client.Package.Recursive,
+	}
+	if client.Package.FullPath {
+		opt.KeyStrategy = binfile.KeyFull
 	}
 	if opt.WorkerCount <= 0 {
 		opt.WorkerCount = runtime.NumCPU()
@@ -246,6 +680,281 @@ func packageDocs(bw binfile.BinWriter) {
 	}
 }
 
+func mergeFiles() {
+	st := binfile.AutoDetect
+	if client.Merge.InputCompressType != "auto" {
+		st = binfile.CompressTypes[client.Merge.InputCompressType]
+	}
+	res, err := binfile.Merge(&binfile.MergeOption{
+		Inputs:         client.Merge.Inputs,
+		Output:         client.Merge.Output,
+		SourceCompress: st,
+		TargetCompress: binfile.CompressTypes[client.CompressType],
+		Dedupe:         client.Merge.Dedupe,
+		NewestWins:     client.Merge.NewestWins,
+		SkipInvalid:    client.Merge.SkipInvalid,
+	})
+	if err != nil {
+		binfile.LogError("merge error: %v\n", err)
+	}
+	if res != nil {
+		binfile.LogInfo("%d files merged, %d invalid, %d documents written, %d duplicated, %d bytes copied\n",
+			res.Files, res.Invalid, res.Docs, res.Duplicates, res.Copied)
+	}
+}
+
+func splitFile() {
+	wc := client.Split.WorkerCount
+	if wc <= 0 {
+		wc = runtime.NumCPU()
+	}
+	files, err := binfile.Split(&binfile.SplitOption{
+		Input:           client.Split.Input,
+		Target:          client.Split.Target,
+		SourceCompress:  binfile.CompressTypes[client.Split.InputCompressType],
+		TargetCompress:  binfile.CompressTypes[client.CompressType],
+		PackageCompress: binfile.CompressTypes[client.Split.PackageType],
+		Size:            client.Split.Size,
+		Count:           client.Split.Count,
+		Shards:          client.Split.Shards,
+		WorkerCount:     wc,
+	})
+	if err != nil {
+		binfile.LogError("split error: %v\n", err)
+	}
+	for _, file := range files {
+		fmt.Println(file)
+	}
+}
+
+func sortFile() {
+	wc := client.Sort.WorkerCount
+	if wc <= 0 {
+		wc = runtime.NumCPU()
+	}
+	err := binfile.Sort(&binfile.SortOption{
+		Input:        client.Sort.Input,
+		Output:       client.Sort.Output,
+		CompressType: binfile.CompressTypes[client.CompressType],
+		MemoryLimit:  client.Sort.Memory * 1024 * 1024,
+		WorkerCount:  wc,
+		TempDir:      client.Sort.TempDir,
+	})
+	if err != nil {
+		binfile.LogError("sort error: %v\n", err)
+	}
+}
+
+func compactFile() {
+	wc := client.Compact.WorkerCount
+	if wc <= 0 {
+		wc = runtime.NumCPU()
+	}
+	res, err := binfile.Compact(&binfile.CompactOption{
+		Input:           client.Compact.Input,
+		Output:          client.Compact.Output,
+		SourceCompress:  binfile.CompressTypes[client.Compact.InputCompressType],
+		TargetCompress:  binfile.CompressTypes[client.CompressType],
+		PackageCompress: binfile.CompressTypes[client.Compact.PackageType],
+		Sort:            client.Compact.Sort,
+		MemoryLimit:     client.Compact.Memory * 1024 * 1024,
+		WorkerCount:     wc,
+		TempDir:         client.Compact.TempDir,
+	})
+	if err != nil {
+		binfile.LogError("compact error: %v\n", err)
+	}
+	if res != nil {
+		binfile.LogInfo("%d documents written, %d overwritten, %d deleted and %d tombstones dropped, %d bytes reclaimed\n",
+			res.Docs, res.Overwritten, res.Deleted, res.Tombstones, res.Reclaimed())
+	}
+}
+
+// docCompressType compression type by name, detected from the first document if auto
+func docCompressType(filename, name string) (int, error) {
+	if name != "auto" {
+		return binfile.CompressTypes[name], nil
+	}
+	return binfile.DetectDocCompression(filename)
+}
+
+func diffFiles() {
+	ca, err := docCompressType(client.Diff.A, client.Diff.CompressA)
+	if err != nil {
+		binfile.LogError("detect compression type of %s error: %v\n", client.Diff.A, err)
+		return
+	}
+	cb, err := docCompressType(client.Diff.B, client.Diff.CompressB)
+	if err != nil {
+		binfile.LogError("detect compression type of %s error: %v\n", client.Diff.B, err)
+		return
+	}
+	wc := client.Diff.WorkerCount
+	if wc <= 0 {
+		wc = runtime.NumCPU()
+	}
+	res, err := binfile.Diff(&binfile.DiffOption{
+		A:           client.Diff.A,
+		B:           client.Diff.B,
+		CompressA:   ca,
+		CompressB:   cb,
+		Raw:         client.Diff.Raw,
+		Partitions:  client.Diff.Partitions,
+		MemoryLimit: client.Diff.Memory * 1024 * 1024,
+		WorkerCount: wc,
+		TempDir:     client.Diff.TempDir,
+	}, func(e *binfile.DiffEntry) error {
+		if client.Diff.Format == "jsonl" {
+			data, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s\n", data)
+			return nil
+		}
+		fmt.Printf("%s\t%s\t%d\t%d\n", e.Kind, e.Key, e.OffsetA, e.OffsetB)
+		return nil
+	})
+	if err != nil {
+		binfile.LogError("diff error: %v\n", err)
+	}
+	if res != nil {
+		binfile.LogInfo("%d only in %s, %d only in %s, %d changed, %d same\n",
+			res.OnlyA, client.Diff.A, res.OnlyB, client.Diff.B, res.Changed, res.Same)
+	}
+}
+
+func fileStats() {
+	wc := client.Stats.WorkerCount
+	if wc <= 0 {
+		wc = runtime.NumCPU()
+	}
+	stats, err := binfile.AnalyseFile(&binfile.FileStatsOption{
+		Filename:     client.Stats.Input,
+		CompressType: binfile.CompressTypes[client.CompressType],
+		WorkerCount:  wc,
+		Top:          client.Stats.Top,
+		PrefixLen:    client.Stats.PrefixLen,
+		PrefixSep:    client.Stats.PrefixSep,
+		KeyOnly:      client.Stats.KeyOnly,
+	})
+	if err != nil {
+		binfile.LogError("stats error: %v\n", err)
+		return
+	}
+	if client.Stats.Json {
+		_ = stats.WriteJSON(os.Stdout)
+	} else {
+		stats.WriteText(os.Stdout)
+	}
+}
+
+func extractDocs() {
+	wc := client.Extract.WorkerCount
+	if wc <= 0 {
+		wc = runtime.NumCPU()
+	}
+	res, err := binfile.Extract(&binfile.ExtractOption{
+		Input:        client.Extract.Input,
+		Output:       client.Extract.Output,
+		CompressType: binfile.CompressTypes[client.CompressType],
+		OutCompress:  binfile.CompressTypes[client.Extract.OutType],
+		Pattern:      client.KeyPattern,
+		Collision:    client.Extract.Collision,
+		WorkerCount:  wc,
+	})
+	if err != nil {
+		binfile.LogError("extract error: %v\n", err)
+	}
+	if res != nil {
+		binfile.LogInfo("%d files extracted, %d renamed, %d skipped, %d failed\n", res.Files, res.Renamed, res.Skipped, res.Failed)
+	}
+}
+
+func exportTar() {
+	count, err := binfile.ExportTar(&binfile.TarExportOption{
+		Input:        client.ToTar.Input,
+		Output:       client.ToTar.Output,
+		CompressType: binfile.CompressTypes[client.CompressType],
+		Raw:          client.ToTar.Raw,
+		Pattern:      client.KeyPattern,
+	})
+	if err != nil {
+		binfile.LogError("export tar error: %v\n", err)
+	}
+	binfile.LogInfo("%d documents exported\n", count)
+}
+
+func exportDocs() {
+	count, err := binfile.ExportJSONL(&binfile.JSONLExportOption{
+		Input:        client.Export.Input,
+		Output:       client.Export.Output,
+		CompressType: binfile.CompressTypes[client.CompressType],
+		Pattern:      client.KeyPattern,
+		Exact:        client.Export.Exact,
+	})
+	if err != nil {
+		binfile.LogError("export error: %v\n", err)
+	}
+	binfile.LogInfo("%d documents exported\n", count)
+}
+
+func importDocs() {
+	var rolling *binfile.RollingOption
+	if cmd := client.Import; cmd.RotateSize > 0 || cmd.RotateCount > 0 || cmd.RotateAge > 0 {
+		rolling = &binfile.RollingOption{
+			Pattern:         cmd.Output,
+			CompressType:    binfile.CompressTypes[client.CompressType],
+			PackageCompress: binfile.CompressTypes[cmd.PackageType],
+			MaxSize:         cmd.RotateSize,
+			MaxCount:        cmd.RotateCount,
+			MaxAge:          cmd.RotateAge,
+			Manifest:        cmd.Manifest,
+		}
+	}
+	res, err := binfile.ImportJSONL(&binfile.JSONLImportOption{
+		Input:        client.Import.Input,
+		Output:       client.Import.Output,
+		CompressType: binfile.CompressTypes[client.CompressType],
+		KeyField:     client.Import.KeyField,
+		ContentField: client.Import.ContentField,
+		SkipInvalid:  client.Import.SkipInvalid,
+		BatchSize:    client.Import.BatchSize,
+		Rolling:      rolling,
+	})
+	if err != nil {
+		binfile.LogError("import error: %v\n", err)
+	}
+	if res != nil {
+		binfile.LogInfo("%d lines read, %d documents imported, %d invalid\n", res.Lines, res.Docs, res.Invalid)
+	}
+}
+
+func deleteDocs() {
+	// tombstones only make sense in an existing bin file, do not create one
+	if _, err := os.Stat(client.Delete.File); err != nil {
+		binfile.LogError("open %s error: %v\n", client.Delete.File, err)
+		return
+	}
+	bw := binfile.NewBinWriter(client.Delete.File, binfile.CompressTypes[client.CompressType])
+	if err := bw.Open(); err != nil {
+		binfile.LogError("open %s error: %v\n", client.Delete.File, err)
+		return
+	}
+	defer func() {
+		_ = bw.Close()
+	}()
+	count := 0
+	for _, key := range client.Delete.Keys {
+		if _, err := bw.Delete([]byte(key)); err != nil {
+			binfile.LogError("delete %s error: %v\n", key, err)
+			return
+		}
+		count += 1
+	}
+	binfile.LogInfo("%d keys deleted from %s\n", count, client.Delete.File)
+}
+
 func execReadCmd(filename string, worker func(reader binfile.BinReader)) {
 	br := newReader(filename, client.CompressType)
 	if br == nil {
@@ -267,6 +976,48 @@ func execWriteCmd(filename string, worker func(reader binfile.BinWriter)) {
 	worker(bw)
 }
 
+// startProgress shows progress as a live line on terminal, or as log lines otherwise
+func startProgress(name string) (stop func()) {
+	p := binfile.StartProgress(name, 0)
+	live := false
+	if stat, err := os.Stderr.Stat(); err == nil {
+		live = stat.Mode()&os.ModeCharDevice != 0
+	}
+	stopWatch := binfile.WatchProgress(p, os.Stderr, client.ProgressStep, live)
+	return func() {
+		stopWatch()
+		p.Finish()
+	}
+}
+
+// startStats collects statistics of written documents, and outputs them when done
+func startStats() (stop func()) {
+	s := binfile.StartStats()
+	return func() {
+		s.Finish()
+		if client.WriteStats {
+			binfile.LogInfo("%s", s.Summary())
+		}
+		if client.WriteStatsJson == "" {
+			return
+		}
+		w := os.Stdout
+		if client.WriteStatsJson != "-" {
+			var err error
+			if w, err = os.Create(client.WriteStatsJson); err != nil {
+				binfile.LogError("create stats file error: %v\n", err)
+				return
+			}
+			defer func() {
+				_ = w.Close()
+			}()
+		}
+		if err := s.WriteJSON(w); err != nil {
+			binfile.LogError("write stats error: %v\n", err)
+		}
+	}
+}
+
 func main() {
 	ctx := kong.Parse(&client)
 	binfile.Debug = client.Debug
@@ -275,18 +1026,50 @@ func main() {
 	binfile.SetGlobalLogLevel(binfile.LogLevelToEnum(client.LogLevel))
 
 	binfile.KeySizeLimit = client.KeySizeLimit
+	binfile.WriteLockTimeout = client.LockTimeout
+	binfile.SaveTombstoneIndex = client.TombstoneIndex
+	if client.WriteStats || client.WriteStatsJson != "" {
+		stop := startStats()
+		defer stop()
+	}
+	if client.Progress {
+		stop := startProgress(strings.Fields(ctx.Command())[0])
+		defer stop()
+	}
 	switch ctx.Command() {
 	case "list <input>", "list <input> <offset>":
 		execReadCmd(client.List.Input, listDocs)
 	case "read <input>", "read <input> <offset>":
-		execReadCmd(client.Read.Input, readDocs)
+		if client.Read.Follow {
+			followDocs(ctx)
+		} else {
+			execReadCmd(client.Read.Input, readDocs)
+		}
 	case "count <input>", "count <input> <offset>":
 		execReadCmd(client.Count.Input, countDocs)
 	case "seek <input>", "seek <input> <offset>":
 		execReadCmd(client.Seek.Input, seekDoc)
-	case "search <input> <key>", "search <input> <key> <offset>":
-		execReadCmd(client.Search.Input, searchDocs)
-	case "package <output> <path>":
+	case "search <input>", "search <input> <key>", "search <input> <key> <offset>":
+		if client.Search.all() {
+			searchAllDocs()
+		} else if client.Search.Key == "" {
+			binfile.LogError("key to search is required\n")
+		} else {
+			execReadCmd(client.Search.Input, searchDocs)
+		}
+	case "get <input>", "get <input> <keys>":
+		getDocs()
+	case "head <input>":
+		peekDocs(client.Head.Input, client.Head.KeyOnly, binfile.Head, &binfile.PeekOption{Count: client.Head.Count})
+	case "tail <input>":
+		peekDocs(client.Tail.Input, client.Tail.KeyOnly, binfile.Tail, &binfile.PeekOption{Count: client.Tail.Count})
+	case "sample <input>":
+		peekDocs(client.Sample.Input, client.Sample.KeyOnly, binfile.Sample, &binfile.PeekOption{Count: client.Sample.Count, Seed: client.Sample.Seed})
+	case "grep <input> <pattern>", "grep <input> <pattern> <offset>":
+		grepDocs()
+	case "query <input>", "query <input> <filter>":
+		queryDocs()
+	case "package <path> <output>":
 		execWriteCmd(client.Package.Output, packageDocs)
 	case "repack <source> <target>":
 		err := binfile.Repack(client.Repack)
@@ -295,6 +1078,28 @@ func main() {
 		}
 	case "list-tar <input>":
 		binfile.ListTar(client.ListTar.Input, binfile.CompressionFormat(client.ListTar.Format), int(client.ListTar.Limit))
+	case "merge <output> <inputs>":
+		mergeFiles()
+	case "split <input> <target>":
+		splitFile()
+	case "sort <input> <output>":
+		sortFile()
+	case "stats <input>":
+		fileStats()
+	case "extract <input> <output>":
+		extractDocs()
+	case "to-tar <input> <output>":
+		exportTar()
+	case "export <input>", "export <input> <output>":
+		exportDocs()
+	case "import <output>", "import <output> <input>":
+		importDocs()
+	case "delete <file> <keys>":
+		deleteDocs()
+	case "compact <input> <output>":
+		compactFile()
+	case "diff <a> <b>":
+		diffFiles()
 	default:
 		binfile.LogInfo("%s\n", version.BuildVersion())
 	}
@@ -28,16 +28,16 @@ func main() {
 		return
 	}
 
-	err = filelock.Lock(*w)
+	err = filelock.Lock(w)
 	if err != nil {
 		binfile.LogInfo("lock failed: %v\n", err)
 		return
 	}
-	defer func(f os.File) {
+	defer func(f *os.File) {
 		err := filelock.UnLock(f)
 		if err != nil {
 			binfile.LogInfo("unlock failed: %v\n", err)
 		}
-	}(*w)
+	}(w)
 
 }
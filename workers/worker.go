@@ -2,6 +2,7 @@ package workers
 
 import (
 	"fmt"
+	"os"
 	"sync"
 	"time"
 )
@@ -41,7 +42,8 @@ func (jr *JobsRunner) Run() {
 	}
 	sw.Wait()
 	usage := time.Now().Sub(start)
-	fmt.Printf("all tasks done in %s\n", usage.String())
+	// report to stderr, stdout is kept for command results
+	_, _ = fmt.Fprintf(os.Stderr, "all tasks done in %s\n", usage.String())
 }
 
 func RunJobs(workerCount int, stopCh chan interface{}, task func(no int), seeder func()) {